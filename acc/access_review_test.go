@@ -0,0 +1,58 @@
+package acc
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestAccessReview(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	// Setup creates the metadata tables before any password is set
+	require.NoError(t, store.EnsureMetadataTables(), "create metadata tables")
+	_, err := store.Roles.Create(postgresql.Role{Name: "review-test-group", UseExisting: true})
+	require.NoError(t, err, "create group")
+	_, err = store.Roles.Create(postgresql.Role{
+		Name:        "review-test-user",
+		Password:    "access-review-password",
+		MemberOf:    []string{"review-test-group"},
+		UseExisting: true,
+	})
+	require.NoError(t, err, "create user")
+	_, err = store.Databases.Create(postgresql.Database{Name: "review-test-db", Owner: "review-test-user", UseExisting: true})
+	require.NoError(t, err, "create database")
+
+	review, err := store.Roles.AccessReview()
+	require.NoError(t, err)
+	assert.Empty(t, review.Warnings, "password changes are tracked")
+
+	var found *postgresql.AccessReviewRole
+	for i, role := range review.Roles {
+		if role.Name == "review-test-user" {
+			found = &review.Roles[i]
+		}
+	}
+	require.NotNil(t, found, "login role is reviewed")
+	assert.Equal(t, []string{"review-test-group"}, found.MemberOf)
+	assert.NotNil(t, found.PasswordChangedAt, "password change is tracked")
+	assert.Nil(t, found.ValidUntil)
+	assert.Contains(t, found.ConnectDatabases, "review-test-db")
+	assert.True(t, found.OwnsObjects)
+
+	var buf bytes.Buffer
+	require.NoError(t, review.WriteCsv(&buf))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, records, len(review.Roles)+1, "header and a row per role")
+	assert.Equal(t, "role", records[0][0])
+}
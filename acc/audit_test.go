@@ -0,0 +1,48 @@
+package acc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/nullstone-modules/pg-db-admin/audit"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	buf := &bytes.Buffer{}
+	auditor := &audit.Auditor{Sinks: []audit.Sink{&audit.StdoutSink{Writer: buf}, &audit.TableSink{DbOpener: store}}}
+	entry := audit.Entry{Caller: audit.Caller{Subject: "audit-tester", Method: "test"}, Source: "test", Type: "roles", Key: "audit-test-user", Action: "create"}
+	_, err := auditor.Run(context.Background(), entry, store, func(store *postgresql.Store) (any, error) {
+		return store.Roles.Create(postgresql.Role{Name: "audit-test-user", Password: "audit-test-password", UseExisting: true})
+	})
+	require.NoError(t, err, "create role")
+
+	var line struct {
+		Audit audit.Entry `json:"audit"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line), "parse stdout entry")
+	assert.Equal(t, audit.ResultSuccess, line.Audit.Result)
+	assert.Equal(t, "audit-tester", line.Audit.Caller.Subject)
+	require.NotEmpty(t, line.Audit.Statements)
+	for _, statement := range line.Audit.Statements {
+		assert.NotContains(t, statement.Sql, "audit-test-password", "password must be redacted")
+	}
+
+	db, err := store.OpenDatabase("")
+	require.NoError(t, err)
+	var count int
+	err = db.QueryRow(`SELECT count(*) FROM pg_db_admin.audit_log WHERE key = 'audit-test-user' AND caller_subject = 'audit-tester'`).Scan(&count)
+	require.NoError(t, err, "read audit log table")
+	assert.GreaterOrEqual(t, count, 1)
+}
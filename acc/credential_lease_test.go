@@ -0,0 +1,109 @@
+package acc
+
+import (
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCredentialLease(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	_, err := store.Roles.Create(postgresql.Role{Name: "lease-test-db", UseExisting: true})
+	require.NoError(t, err, "create owner")
+	_, err = store.Databases.Create(postgresql.Database{Name: "lease-test-db", Owner: "lease-test-db", UseExisting: true})
+	require.NoError(t, err, "create database")
+
+	lease, err := store.Credentials.Create(postgresql.CredentialLease{Database: "lease-test-db", Ttl: "10m"})
+	require.NoError(t, err, "create")
+	assert.NotEmpty(t, lease.Id)
+	assert.NotEmpty(t, lease.Password)
+	assert.NotEmpty(t, lease.ConnectionUrl)
+
+	access, err := store.DatabaseAccess.Read(postgresql.DatabaseAccessKey{Role: lease.Id, Database: "lease-test-db"})
+	require.NoError(t, err, "read access")
+	require.NotNil(t, access)
+	assert.Equal(t, postgresql.AccessReadOnly, access.Level)
+
+	renewed, err := store.Credentials.Update(lease.Key(), postgresql.CredentialLease{Ttl: "1h"})
+	require.NoError(t, err, "renew")
+	assert.True(t, renewed.ExpiresAt.After(lease.ExpiresAt))
+
+	swept, err := store.Credentials.Sweep(time.Now().Add(2 * time.Hour))
+	require.NoError(t, err, "sweep")
+	assert.Contains(t, swept, lease.Id)
+
+	find, err := store.Credentials.Read(lease.Key())
+	require.NoError(t, err, "read after sweep")
+	assert.Nil(t, find)
+	role, err := store.Roles.Read(lease.Id)
+	require.NoError(t, err, "read role after sweep")
+	assert.Nil(t, role)
+}
+
+func TestCredentialLease_Template(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	_, err := store.Roles.Create(postgresql.Role{Name: "lease-template-db", UseExisting: true})
+	require.NoError(t, err, "create owner")
+	_, err = store.Databases.Create(postgresql.Database{Name: "lease-template-db", Owner: "lease-template-db", UseExisting: true})
+	require.NoError(t, err, "create database")
+	_, err = store.Roles.Create(postgresql.Role{Name: "lease-template-other-db", UseExisting: true})
+	require.NoError(t, err, "create other owner")
+	_, err = store.Databases.Create(postgresql.Database{Name: "lease-template-other-db", Owner: "lease-template-other-db", UseExisting: true})
+	require.NoError(t, err, "create other database")
+	_, err = store.Roles.Create(postgresql.Role{Name: "lease-template-group", UseExisting: true})
+	require.NoError(t, err, "create template")
+	store.Credentials.Templates = map[string]string{"lease-template-db": "lease-template-group"}
+
+	// The template is configured by the operator
+	_, err = store.Credentials.Create(postgresql.CredentialLease{Database: "lease-template-db", Template: "lease-template-db"})
+	var validationErr *postgresql.ValidationError
+	require.ErrorAs(t, err, &validationErr, "requested template")
+	assert.Equal(t, "template", validationErr.Field)
+
+	lease, err := store.Credentials.Create(postgresql.CredentialLease{Database: "lease-template-db", Ttl: "10m"})
+	require.NoError(t, err, "create")
+	assert.Equal(t, "lease-template-group", lease.Template)
+	membership, err := store.RoleMembers.Read(postgresql.RoleMemberKey{Member: lease.Id, Target: "lease-template-group"})
+	require.NoError(t, err, "read membership")
+	assert.NotNil(t, membership)
+
+	// Objects owned by the lease role outside of its database are reassigned before the role is dropped
+	_, err = store.Schemas.Create(postgresql.Schema{Name: "lease_template_schema", Database: "lease-template-other-db", Owner: lease.Id})
+	require.NoError(t, err, "create owned schema")
+	_, err = store.Credentials.Drop(lease.Key())
+	require.NoError(t, err, "revoke")
+	schema, err := store.Schemas.Read(postgresql.SchemaKey{Database: "lease-template-other-db", Name: "lease_template_schema"})
+	require.NoError(t, err, "read schema")
+	require.NotNil(t, schema)
+	assert.Equal(t, "lease-template-other-db", schema.Owner)
+	role, err := store.Roles.Read(lease.Id)
+	require.NoError(t, err, "read role after revoke")
+	assert.Nil(t, role)
+
+	// Audited requests run through a recording Store, which uses the templates of its parent
+	rec, plan := store.Recording()
+	recorded, err := rec.Credentials.Create(postgresql.CredentialLease{Database: "lease-template-db", Ttl: "10m"})
+	require.NoError(t, err, "create through recording store")
+	assert.Equal(t, "lease-template-group", recorded.Template)
+	membership, err = store.RoleMembers.Read(postgresql.RoleMemberKey{Member: recorded.Id, Target: "lease-template-group"})
+	require.NoError(t, err, "read recorded membership")
+	assert.NotNil(t, membership)
+	assert.NotEmpty(t, plan.Statements)
+	_, err = store.Credentials.Drop(recorded.Key())
+	require.NoError(t, err, "revoke recorded lease")
+}
@@ -0,0 +1,125 @@
+package acc
+
+import (
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDatabaseAccess(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	_, err := store.Roles.Create(postgresql.Role{Name: "access-test-db", UseExisting: true})
+	require.NoError(t, err, "create owner")
+	_, err = store.Databases.Create(postgresql.Database{Name: "access-test-db", Owner: "access-test-db", UseExisting: true})
+	require.NoError(t, err, "create database")
+	_, err = store.Roles.Create(postgresql.Role{Name: "access-test-user", Password: "access-test-password", UseExisting: true})
+	require.NoError(t, err, "create user")
+
+	key := postgresql.DatabaseAccessKey{Role: "access-test-user", Database: "access-test-db"}
+	find, err := store.DatabaseAccess.Read(key)
+	require.NoError(t, err, "read before create")
+	assert.Nil(t, find)
+
+	_, err = store.DatabaseAccess.Create(postgresql.DatabaseAccess{Role: key.Role, Database: key.Database})
+	require.NoError(t, err, "create")
+	find, err = store.DatabaseAccess.Read(key)
+	require.NoError(t, err, "read after create")
+	assert.NotNil(t, find)
+
+	ok, err := store.DatabaseAccess.Drop(key)
+	require.NoError(t, err, "drop")
+	assert.True(t, ok)
+	find, err = store.DatabaseAccess.Read(key)
+	require.NoError(t, err, "read after drop")
+	assert.Nil(t, find)
+}
+
+func TestDatabaseAccessReadOnly(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	_, err := store.Roles.Create(postgresql.Role{Name: "readonly-test-db", UseExisting: true})
+	require.NoError(t, err, "create owner")
+	_, err = store.Databases.Create(postgresql.Database{Name: "readonly-test-db", Owner: "readonly-test-db", UseExisting: true})
+	require.NoError(t, err, "create database")
+	_, err = store.Roles.Create(postgresql.Role{Name: "readonly-test-reader", Password: "readonly-test-password", UseExisting: true})
+	require.NoError(t, err, "create reader")
+
+	access := postgresql.DatabaseAccess{Role: "readonly-test-reader", Database: "readonly-test-db", Level: postgresql.AccessReadOnly}
+	_, err = store.DatabaseAccess.Create(access)
+	require.NoError(t, err, "grant readonly access")
+
+	find, err := store.DatabaseAccess.Read(access.Key())
+	require.NoError(t, err, "read access")
+	require.NotNil(t, find)
+	assert.Equal(t, postgresql.AccessReadOnly, find.Level)
+
+	_, err = store.DatabaseAccess.Create(postgresql.DatabaseAccess{Role: "readonly-test-reader", Database: "readonly-test-db", Level: "superuser"})
+	var validationErr *postgresql.ValidationError
+	assert.ErrorAs(t, err, &validationErr, "invalid level")
+}
+
+func TestDatabaseAccessGroupConflict(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	_, err := store.Roles.Create(postgresql.Role{Name: "conflict-test-db", UseExisting: true})
+	require.NoError(t, err, "create owner")
+	_, err = store.Databases.Create(postgresql.Database{Name: "conflict-test-db", Owner: "conflict-test-db", UseExisting: true})
+	require.NoError(t, err, "create database")
+	// An app role that happens to use the access group name must not be adopted as the access group
+	_, err = store.Roles.Create(postgresql.Role{Name: "conflict-test-db_readonly", Password: "conflict-test-password", UseExisting: true})
+	require.NoError(t, err, "create conflicting role")
+	_, err = store.Roles.Create(postgresql.Role{Name: "conflict-test-reader", Password: "conflict-test-password", UseExisting: true})
+	require.NoError(t, err, "create reader")
+
+	_, err = store.DatabaseAccess.Create(postgresql.DatabaseAccess{Role: "conflict-test-reader", Database: "conflict-test-db", Level: postgresql.AccessReadOnly})
+	var validationErr *postgresql.ValidationError
+	require.ErrorAs(t, err, &validationErr, "conflicting role")
+	assert.Contains(t, validationErr.Reason, "is not a pg-db-admin readonly access group")
+
+	longName := strings.Repeat("a", postgresql.MaxIdentifierLength-2)
+	_, err = store.DatabaseAccess.Create(postgresql.DatabaseAccess{Role: "conflict-test-reader", Database: longName, Level: postgresql.AccessReadWrite})
+	require.ErrorAs(t, err, &validationErr, "group name too long")
+	assert.Equal(t, "database", validationErr.Field)
+}
+
+func TestDatabaseAccessOwner(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	_, err := store.Roles.Create(postgresql.Role{Name: "owner-access-test-db", UseExisting: true})
+	require.NoError(t, err, "create owner")
+	_, err = store.Databases.Create(postgresql.Database{Name: "owner-access-test-db", Owner: "owner-access-test-db", UseExisting: true})
+	require.NoError(t, err, "create database")
+
+	key := postgresql.DatabaseAccessKey{Role: "owner-access-test-db", Database: "owner-access-test-db"}
+	_, err = store.DatabaseAccess.Create(postgresql.DatabaseAccess{Role: key.Role, Database: key.Database})
+	require.NoError(t, err, "create")
+	find, err := store.DatabaseAccess.Read(key)
+	require.NoError(t, err, "read after create")
+	if assert.NotNil(t, find, "the owner has access to its own database") {
+		assert.Equal(t, postgresql.AccessOwner, find.Level)
+	}
+}
@@ -29,3 +29,33 @@ func TestDatabase(t *testing.T) {
 	require.NoError(t, err, "read database")
 	assert.Equal(t, ownerRole.Name, find.Owner, "mismatched owner")
 }
+
+func TestDatabase_Update(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	databaseName := "database-update-test"
+	_, err := store.Roles.Create(postgresql.Role{Name: databaseName, Password: "database-update-password", UseExisting: true})
+	require.NoError(t, err, "create owner role")
+	_, err = store.Databases.Create(postgresql.Database{Name: databaseName, Owner: databaseName, UseExisting: true})
+	require.NoError(t, err, "create database")
+
+	_, err = store.Databases.Update(databaseName, postgresql.Database{ConnectionLimit: new(5), DisableConnections: new(true)})
+	require.NoError(t, err, "update database")
+	find, err := store.Databases.Read(databaseName)
+	require.NoError(t, err, "read database")
+	assert.Equal(t, 5, *find.ConnectionLimit)
+	assert.True(t, *find.DisableConnections)
+
+	// Attributes that are not set are left unchanged
+	_, err = store.Databases.Update(databaseName, postgresql.Database{Owner: databaseName, DisableConnections: new(false)})
+	require.NoError(t, err, "update database")
+	find, err = store.Databases.Read(databaseName)
+	require.NoError(t, err, "read database")
+	assert.Equal(t, 5, *find.ConnectionLimit)
+	assert.False(t, *find.DisableConnections)
+}
@@ -0,0 +1,56 @@
+package acc
+
+import (
+	"context"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/nullstone-modules/pg-db-admin/secrets"
+	"github.com/nullstone-modules/pg-db-admin/setup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	ctx := context.Background()
+	setupStore := createStore(t)
+	defer setupStore.Close()
+	setupStore.Policy = nil
+	ensureRdsSuperuser(t, setupStore)
+	adminStore := postgresql.NewStore("")
+	secretStore, err := secrets.NewFileStore(filepath.Join(t.TempDir(), "secrets.json"))
+	require.NoError(t, err)
+
+	statuses := func(report *setup.DiagnoseReport) map[string]string {
+		result := map[string]string{}
+		for _, check := range report.Checks {
+			result[check.Name] = check.Status
+		}
+		return result
+	}
+
+	t.Run("before setup", func(t *testing.T) {
+		report, err := setup.Diagnose(ctx, setupStore, adminStore, secretStore, "admin")
+		require.NoError(t, err)
+		assert.False(t, report.Healthy)
+		assert.Equal(t, setup.CheckFail, statuses(report)["admin-secret"])
+		assert.Equal(t, setup.CheckSkip, statuses(report)["admin-login"])
+	})
+
+	t.Run("after setup", func(t *testing.T) {
+		_, err := setup.Handle(ctx, setup.Event{Setup: true}, setupStore, secretStore, "admin")
+		require.NoError(t, err, "setup")
+		report, err := setup.Diagnose(ctx, setupStore, adminStore, secretStore, "admin")
+		require.NoError(t, err)
+		assert.True(t, report.Healthy, "%+v", report.Checks)
+		checks := statuses(report)
+		for _, name := range []string{"admin-secret", "network", "admin-login", "distinct-users", "admin-attributes"} {
+			assert.Equal(t, setup.CheckPass, checks[name], name)
+		}
+	})
+}
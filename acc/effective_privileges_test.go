@@ -0,0 +1,69 @@
+package acc
+
+import (
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestEffectivePrivileges(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	_, err := store.Roles.Create(postgresql.Role{Name: "privs-test-owner", UseExisting: true})
+	require.NoError(t, err, "create owner")
+	_, err = store.Databases.Create(postgresql.Database{Name: "privs-test-db", Owner: "privs-test-owner", UseExisting: true})
+	require.NoError(t, err, "create database")
+	_, err = store.Roles.Create(postgresql.Role{Name: "privs-test-readers", UseExisting: true})
+	require.NoError(t, err, "create readers")
+	_, err = store.Roles.Create(postgresql.Role{Name: "privs-test-user", MemberOf: []string{"privs-test-readers"}, UseExisting: true})
+	require.NoError(t, err, "create user")
+
+	db, err := store.OpenDatabase("privs-test-db")
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS privs_test (id int)`)
+	require.NoError(t, err, "create table")
+	_, err = db.Exec(`GRANT SELECT ON privs_test TO "privs-test-readers"`)
+	require.NoError(t, err, "grant select")
+
+	result, err := store.Roles.EffectivePrivileges("privs-test-user", "privs-test-db")
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.False(t, result.Superuser)
+	assert.Contains(t, result.Roles, postgresql.InheritedRole{Role: "privs-test-readers", Path: []string{"privs-test-user", "privs-test-readers"}})
+
+	var tablePrivilege *postgresql.ObjectPrivilege
+	for i, p := range result.Privileges {
+		if p.ObjectType == "table" && p.Name == "privs_test" {
+			tablePrivilege = &result.Privileges[i]
+		}
+	}
+	require.NotNil(t, tablePrivilege, "inherited table privilege")
+	assert.Equal(t, "privs-test-readers", tablePrivilege.Grantee)
+	assert.True(t, tablePrivilege.Inherited)
+	assert.Equal(t, []string{"privs-test-user", "privs-test-readers"}, tablePrivilege.Path)
+	assert.Equal(t, []string{"SELECT"}, tablePrivilege.Privileges)
+
+	// PUBLIC can connect to a new database
+	assert.Contains(t, result.Privileges, postgresql.ObjectPrivilege{
+		ObjectType:  "database",
+		Name:        "privs-test-db",
+		Privileges:  []string{"CONNECT", "TEMPORARY"},
+		GrantOption: []string{},
+		Grantee:     postgresql.PublicRole,
+		Inherited:   true,
+		Path:        []string{"privs-test-user", postgresql.PublicRole},
+	})
+
+	t.Run("missing database", func(t *testing.T) {
+		result, err := store.Roles.EffectivePrivileges("privs-test-user", "privs-test-missing")
+		require.NoError(t, err)
+		assert.Nil(t, result)
+	})
+}
@@ -0,0 +1,40 @@
+package acc
+
+import (
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestIamRole(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	t.Run("cloud sql naming", func(t *testing.T) {
+		assert.Equal(t, "app@project.iam", postgresql.IamRoleName("app@project.iam.gserviceaccount.com"))
+		assert.Equal(t, "user@example.com", postgresql.IamRoleName("user@example.com"))
+	})
+
+	t.Run("unsupported flavor", func(t *testing.T) {
+		// The acceptance database is plain postgres, which does not support IAM authentication
+		_, err := store.Roles.Create(postgresql.Role{Name: "iam-test-user", Iam: true})
+		var validationErr *postgresql.ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "iam", validationErr.Field)
+	})
+
+	t.Run("read reports iam", func(t *testing.T) {
+		_, err := store.Roles.Create(postgresql.Role{Name: "iam-test-password-user", Password: "iam-secret-password", UseExisting: true})
+		require.NoError(t, err)
+		found, err := store.Roles.Read("iam-test-password-user")
+		require.NoError(t, err)
+		require.NotNil(t, found)
+		assert.False(t, found.Iam)
+	})
+}
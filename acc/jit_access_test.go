@@ -0,0 +1,93 @@
+package acc
+
+import (
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestJitAccess(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	_, err := store.Roles.Create(postgresql.Role{Name: "jit-test-group", UseExisting: true})
+	require.NoError(t, err, "create group")
+
+	jit := postgresql.JitAccess{Role: "jit-test-user", Password: "jit-test-password", MemberOf: []string{"jit-test-group"}, Ttl: "1h"}
+	created, err := store.JitAccess.Create(jit)
+	require.NoError(t, err, "create")
+	assert.True(t, created.CreatedRole)
+	assert.Equal(t, []string{"jit-test-group"}, created.MemberOf)
+
+	membership, err := store.RoleMembers.Read(postgresql.RoleMemberKey{Member: "jit-test-user", Target: "jit-test-group"})
+	require.NoError(t, err, "read membership")
+	assert.NotNil(t, membership)
+
+	swept, err := store.JitAccess.Sweep(time.Now())
+	require.NoError(t, err, "sweep before expiry")
+	assert.NotContains(t, swept, "jit-test-user")
+
+	swept, err = store.JitAccess.Sweep(time.Now().Add(2 * time.Hour))
+	require.NoError(t, err, "sweep after expiry")
+	assert.Contains(t, swept, "jit-test-user")
+
+	find, err := store.JitAccess.Read("jit-test-user")
+	require.NoError(t, err, "read after sweep")
+	assert.Nil(t, find)
+	role, err := store.Roles.Read("jit-test-user")
+	require.NoError(t, err, "read role after sweep")
+	assert.Nil(t, role)
+}
+
+func TestJitAccess_Expire(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	_, err := store.Roles.Create(postgresql.Role{Name: "jit-expire-db", UseExisting: true})
+	require.NoError(t, err, "create owner")
+	_, err = store.Databases.Create(postgresql.Database{Name: "jit-expire-db", Owner: "jit-expire-db", UseExisting: true})
+	require.NoError(t, err, "create database")
+
+	// A password cannot be set on an existing role
+	_, err = store.JitAccess.Create(postgresql.JitAccess{Role: "jit-expire-db", Password: "jit-test-password", Ttl: "1h"})
+	var validationErr *postgresql.ValidationError
+	require.ErrorAs(t, err, &validationErr, "password for existing role")
+	assert.Equal(t, "password", validationErr.Field)
+
+	// Objects owned by the temporary role are reassigned to the database owner
+	_, err = store.JitAccess.Create(postgresql.JitAccess{Role: "jit-expire-owner", Password: "jit-test-password", Ttl: "1h"})
+	require.NoError(t, err, "create owner access")
+	_, err = store.Schemas.Create(postgresql.Schema{Name: "jit_expire_schema", Database: "jit-expire-db", Owner: "jit-expire-owner"})
+	require.NoError(t, err, "create owned schema")
+	_, err = store.JitAccess.Drop("jit-expire-owner")
+	require.NoError(t, err, "expire owner access")
+	schema, err := store.Schemas.Read(postgresql.SchemaKey{Database: "jit-expire-db", Name: "jit_expire_schema"})
+	require.NoError(t, err, "read schema")
+	require.NotNil(t, schema)
+	assert.Equal(t, "jit-expire-db", schema.Owner)
+
+	// A role that was already dropped only removes the record
+	_, err = store.JitAccess.Create(postgresql.JitAccess{Role: "jit-expire-dropped", Password: "jit-test-password", Ttl: "1h"})
+	require.NoError(t, err, "create dropped access")
+	db, err := store.OpenDatabase("")
+	require.NoError(t, err)
+	_, err = db.Exec(`DROP ROLE "jit-expire-dropped"`)
+	require.NoError(t, err, "drop role")
+	swept, err := store.JitAccess.Sweep(time.Now().Add(2 * time.Hour))
+	require.NoError(t, err, "sweep dropped role")
+	assert.Contains(t, swept, "jit-expire-dropped")
+	find, err := store.JitAccess.Read("jit-expire-dropped")
+	require.NoError(t, err, "read after sweep")
+	assert.Nil(t, find)
+}
@@ -0,0 +1,58 @@
+package acc
+
+import (
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	for _, name := range []string{"list-test-a", "list-test-b", "list-test-c"} {
+		_, err := store.Roles.Create(postgresql.Role{Name: name, UseExisting: true})
+		require.NoError(t, err, "create role %s", name)
+		_, err = store.Databases.Create(postgresql.Database{Name: name, Owner: name, UseExisting: true})
+		require.NoError(t, err, "create database %s", name)
+	}
+
+	t.Run("databases are paginated", func(t *testing.T) {
+		page, err := store.Databases.List(postgresql.DatabaseFilter{
+			ListOptions: postgresql.ListOptions{Limit: 2},
+			NamePrefix:  "list-test-",
+		})
+		require.NoError(t, err)
+		require.Len(t, page.Items, 2)
+		assert.Equal(t, "list-test-b", page.NextPageToken)
+
+		page, err = store.Databases.List(postgresql.DatabaseFilter{
+			ListOptions: postgresql.ListOptions{Limit: 2, PageToken: page.NextPageToken},
+			NamePrefix:  "list-test-",
+		})
+		require.NoError(t, err)
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, "list-test-c", page.Items[0].Name)
+		assert.Equal(t, "list-test-c", page.Items[0].Owner)
+		assert.Equal(t, "", page.NextPageToken)
+	})
+
+	t.Run("system objects are excluded", func(t *testing.T) {
+		databases, err := store.Databases.List(postgresql.DatabaseFilter{ListOptions: postgresql.ListOptions{Limit: postgresql.MaxListLimit}})
+		require.NoError(t, err)
+		for _, database := range databases.Items {
+			assert.False(t, postgresql.IsSystemDatabase(database.Name), "unexpected database %s", database.Name)
+		}
+		roles, err := store.Roles.List(postgresql.RoleFilter{ListOptions: postgresql.ListOptions{Limit: postgresql.MaxListLimit}})
+		require.NoError(t, err)
+		for _, role := range roles.Items {
+			assert.False(t, postgresql.IsSystemRole(role.Name), "unexpected role %s", role.Name)
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package acc
+
+import (
+	"github.com/nullstone-modules/pg-db-admin/manifest"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestManifestApply(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	m, err := manifest.Parse([]byte(`
+databases:
+  - name: manifest-test
+    owner: manifest-test
+roles:
+  - name: manifest-test
+    password: manifest-test-password
+schemas:
+  - name: reporting
+    database: manifest-test
+    owner: manifest-test
+schemaPrivileges:
+  - role: manifest-test
+    database: manifest-test
+`))
+	require.NoError(t, err, "parse manifest")
+
+	report, err := manifest.Apply(store, m)
+	require.NoError(t, err, "apply")
+	require.Equal(t, 0, report.Failed, "failed resources")
+	require.Len(t, report.Results, 4)
+	assert.Equal(t, "roles/manifest-test", report.Results[0].Type+"/"+report.Results[0].Key, "owner is applied first")
+
+	report, err = manifest.Apply(store, m)
+	require.NoError(t, err, "re-apply")
+	for _, result := range report.Results {
+		assert.Equal(t, manifest.ActionNone, result.Action, "%s/%s should be unchanged", result.Type, result.Key)
+	}
+}
+
+func TestExport(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	_, err := store.Roles.Create(postgresql.Role{Name: "export-test", Password: "export-test-password", UseExisting: true})
+	require.NoError(t, err, "create role")
+	_, err = store.Databases.Create(postgresql.Database{Name: "export-test", Owner: "export-test", UseExisting: true})
+	require.NoError(t, err, "create database")
+	_, err = store.Roles.Create(postgresql.Role{Name: "export-test-reader", Password: "export-secret-password", UseExisting: true})
+	require.NoError(t, err, "create reader")
+	_, err = store.DatabaseAccess.Create(postgresql.DatabaseAccess{Role: "export-test-reader", Database: "export-test", Level: postgresql.AccessReadOnly})
+	require.NoError(t, err, "grant readonly access")
+
+	result, err := manifest.ExportState(store)
+	require.NoError(t, err, "export")
+
+	var found *postgresql.Role
+	for _, role := range result.Manifest.Roles {
+		if role.Name == "export-test" {
+			found = &role
+		}
+	}
+	require.NotNil(t, found, "exported role")
+	assert.Equal(t, "", found.Password, "password should be omitted")
+	assert.Len(t, result.Payloads, len(result.Manifest.Roles)+len(result.Manifest.Databases)+len(result.Manifest.RoleMembers)+
+		len(result.Manifest.Schemas)+len(result.Manifest.SchemaPrivileges)+len(result.Manifest.DefaultGrants)+len(result.Manifest.DatabaseAccess))
+
+	checker, err := postgresql.NewPolicyChecker(store)
+	require.NoError(t, err, "policy checker")
+	for _, role := range result.Manifest.Roles {
+		assert.True(t, checker.IsManagedRole(role.Name), "protected role %q should be omitted", role.Name)
+	}
+	var access *postgresql.DatabaseAccess
+	for _, cur := range result.Manifest.DatabaseAccess {
+		if cur.Role == "export-test-reader" {
+			access = &cur
+		}
+	}
+	require.NotNil(t, access, "access group membership is exported as database access")
+	assert.Equal(t, postgresql.DatabaseAccess{Role: "export-test-reader", Database: "export-test", Level: postgresql.AccessReadOnly}, *access)
+
+	// Applying the export to the same cluster should not change anything
+	report, err := manifest.Apply(store, result.Manifest)
+	require.NoError(t, err, "apply export")
+	for _, res := range report.Results {
+		assert.Equal(t, manifest.ActionNone, res.Action, "%s/%s should be unchanged", res.Type, res.Key)
+	}
+}
+
+func TestDriftCheck(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	_, err := store.Roles.Create(postgresql.Role{Name: "drift-test", Password: "drift-test-password", UseExisting: true})
+	require.NoError(t, err, "create role")
+	_, err = store.Roles.Create(postgresql.Role{Name: "drift-test-other", Password: "drift-test-password", UseExisting: true})
+	require.NoError(t, err, "create other role")
+	_, err = store.Databases.Create(postgresql.Database{Name: "drift-test", Owner: "drift-test-other", UseExisting: true})
+	require.NoError(t, err, "create database")
+
+	report, err := manifest.CheckDrift(store, &manifest.Manifest{
+		Databases: []postgresql.Database{{Name: "drift-test", Owner: "drift-test"}},
+		Roles:     []postgresql.Role{{Name: "drift-test-missing"}},
+	})
+	require.NoError(t, err, "check drift")
+	require.Len(t, report.Results, 2)
+	assert.Equal(t, 2, report.Drifted)
+	assert.Equal(t, manifest.DriftMissing, report.Results[0].Status)
+	assert.Equal(t, manifest.DriftChanged, report.Results[1].Status)
+	assert.Equal(t, []manifest.Change{{Field: "owner", From: "drift-test-other", To: "drift-test"}}, report.Results[1].Changes)
+	assert.Error(t, manifest.DriftDetected(report))
+}
+
+func TestManifestApply_Reconcile(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	_, err := store.Roles.Create(postgresql.Role{Name: "reconcile-test-group", Password: "reconcile-secret-password", UseExisting: true})
+	require.NoError(t, err, "create group")
+	_, err = store.Roles.Create(postgresql.Role{
+		Name:        "reconcile-test",
+		Password:    "reconcile-secret-password",
+		UseExisting: true,
+		MemberOf:    []string{"reconcile-test-group"},
+		Attributes:  postgresql.RoleAttributes{CreateDb: new(true)},
+	})
+	require.NoError(t, err, "create role")
+	_, err = store.Databases.Create(postgresql.Database{Name: "reconcile-test", Owner: "reconcile-test-group", UseExisting: true})
+	require.NoError(t, err, "create database")
+
+	m, err := manifest.Parse([]byte(`
+roles:
+  - name: reconcile-test
+    memberOf: []
+databases:
+  - name: reconcile-test
+    owner: reconcile-test-group
+    connectionLimit: 10
+`))
+	require.NoError(t, err, "parse manifest")
+
+	report, err := manifest.Apply(store, m)
+	require.NoError(t, err, "apply")
+	require.Equal(t, 0, report.Failed, "failed resources")
+	assert.Equal(t, []manifest.Change{{Field: "memberOf", From: "reconcile-test-group", To: nil}}, report.Results[0].Changes,
+		"unlisted memberships are removed and unset attributes are left alone")
+	assert.Equal(t, []manifest.Change{{Field: "connectionLimit", From: 0, To: 10}}, report.Results[1].Changes)
+
+	report, err = manifest.Apply(store, m)
+	require.NoError(t, err, "re-apply")
+	for _, result := range report.Results {
+		assert.Equal(t, manifest.ActionNone, result.Action, "%s/%s should be unchanged", result.Type, result.Key)
+	}
+	role, err := store.Roles.Read("reconcile-test")
+	require.NoError(t, err, "read role")
+	assert.Empty(t, role.MemberOf)
+	assert.True(t, *role.Attributes.CreateDb)
+
+	// The encoding of an existing database cannot be changed, so it is reported without being applied
+	drift, err := manifest.CheckDrift(store, &manifest.Manifest{Databases: []postgresql.Database{{Name: "reconcile-test", Encoding: "SQL_ASCII"}}})
+	require.NoError(t, err, "check drift")
+	assert.Equal(t, manifest.DriftImmutable, drift.Results[0].Status)
+	assert.Equal(t, 0, drift.Drifted)
+	assert.Equal(t, 1, drift.Immutable)
+	assert.NoError(t, manifest.DriftDetected(drift))
+}
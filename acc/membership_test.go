@@ -0,0 +1,54 @@
+package acc
+
+import (
+	"github.com/nullstone-modules/pg-db-admin/apierror"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestMembershipCycles(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	for _, name := range []string{"cycle-test-a", "cycle-test-b", "cycle-test-c"} {
+		_, err := store.Roles.Create(postgresql.Role{Name: name, UseExisting: true})
+		require.NoError(t, err)
+	}
+	// a -> b -> c
+	_, err := store.RoleMembers.Create(postgresql.RoleMember{Member: "cycle-test-a", Target: "cycle-test-b", UseExisting: true})
+	require.NoError(t, err)
+	_, err = store.RoleMembers.Create(postgresql.RoleMember{Member: "cycle-test-b", Target: "cycle-test-c", UseExisting: true})
+	require.NoError(t, err)
+
+	t.Run("refuses a grant that forms a cycle", func(t *testing.T) {
+		_, err := store.RoleMembers.Create(postgresql.RoleMember{Member: "cycle-test-c", Target: "cycle-test-a"})
+		var cycleErr *postgresql.MembershipCycleError
+		require.ErrorAs(t, err, &cycleErr)
+		assert.Equal(t, []string{"cycle-test-c", "cycle-test-a", "cycle-test-b", "cycle-test-c"}, cycleErr.Path)
+		apiErr := apierror.New(err)
+		assert.Equal(t, http.StatusConflict, apiErr.Status)
+		assert.Equal(t, apierror.CodeMembershipCycle, apiErr.Code)
+	})
+
+	t.Run("membership tree", func(t *testing.T) {
+		tree, err := store.Roles.MembershipTree("cycle-test-a")
+		require.NoError(t, err)
+		require.NotNil(t, tree)
+		require.Len(t, tree.MemberOf, 1)
+		assert.Equal(t, "cycle-test-b", tree.MemberOf[0].Role)
+		require.Len(t, tree.MemberOf[0].MemberOf, 1)
+		assert.Equal(t, "cycle-test-c", tree.MemberOf[0].MemberOf[0].Role)
+
+		missing, err := store.Roles.MembershipTree("cycle-test-missing")
+		require.NoError(t, err)
+		assert.Nil(t, missing)
+	})
+}
@@ -0,0 +1,32 @@
+package acc
+
+import (
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	dry, plan := store.DryRun()
+	_, err := dry.Roles.Create(postgresql.Role{
+		Name:     "plan-test-user",
+		Password: "plan-test-password",
+	})
+	require.NoError(t, err, "plan create role")
+
+	require.Len(t, plan.Statements, 1)
+	assert.Equal(t, `CREATE ROLE "plan-test-user" WITH LOGIN PASSWORD '********'`, plan.Statements[0].Sql)
+
+	find, err := store.Roles.Read("plan-test-user")
+	require.NoError(t, err, "read user")
+	assert.Nil(t, find, "role should not be created during dry run")
+}
@@ -0,0 +1,74 @@
+package acc
+
+import (
+	"github.com/nullstone-modules/pg-db-admin/apierror"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestProtectionPolicy(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	tests := []struct {
+		name string
+		fn   func() error
+	}{
+		{
+			name: "reserved role",
+			fn: func() error {
+				_, err := store.Roles.Create(postgresql.Role{Name: "rds_superuser", Password: "policy-test-password"})
+				return err
+			},
+		},
+		{
+			name: "membership of postgres",
+			fn: func() error {
+				_, err := store.RoleMembers.Create(postgresql.RoleMember{Member: "postgres", Target: "policy-test-app"})
+				return err
+			},
+		},
+		{
+			name: "membership in a reserved role that is not grantable",
+			fn: func() error {
+				_, err := store.RoleMembers.Create(postgresql.RoleMember{Member: "policy-test-app", Target: "rds_superuser"})
+				return err
+			},
+		},
+		{
+			name: "template database",
+			fn: func() error {
+				_, err := store.Databases.Create(postgresql.Database{Name: "template1", Owner: "policy-test-app"})
+				return err
+			},
+		},
+		{
+			name: "current user",
+			fn: func() error {
+				_, err := store.Roles.Update("pda", postgresql.Role{Name: "pda", Password: "policy-test-password"})
+				return err
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.fn()
+			require.Error(t, err)
+			apiErr := apierror.New(err)
+			assert.Equal(t, http.StatusForbidden, apiErr.Status)
+			assert.Equal(t, apierror.CodeProtectedObject, apiErr.Code)
+		})
+	}
+
+	store.Policy = &postgresql.Policy{Disabled: true}
+	_, err := store.Roles.Create(postgresql.Role{Name: "policy-test-app", UseExisting: true})
+	require.NoError(t, err, "disabled policy should not protect")
+}
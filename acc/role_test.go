@@ -2,6 +2,7 @@ package acc
 
 import (
 	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"os"
 	"testing"
@@ -25,3 +26,36 @@ func TestRole(t *testing.T) {
 	require.NoError(t, err, "read user")
 	require.NotNil(t, find)
 }
+
+func TestRole_UpdateAttributes(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	store := createStore(t)
+	defer store.Close()
+
+	_, err := store.Roles.Create(postgresql.Role{
+		Name:       "role-attributes-test",
+		Password:   "role-attributes-password",
+		Attributes: postgresql.RoleAttributes{CreateDb: new(true)},
+	})
+	require.NoError(t, err, "create role")
+
+	// Attributes that are not set are left unchanged
+	_, err = store.Roles.Update("role-attributes-test", postgresql.Role{Name: "role-attributes-test", SkipPasswordUpdate: true})
+	require.NoError(t, err, "update without attributes")
+	find, err := store.Roles.Read("role-attributes-test")
+	require.NoError(t, err, "read role")
+	assert.Equal(t, postgresql.RoleAttributes{CreateDb: new(true), CreateRole: new(false)}, find.Attributes)
+
+	_, err = store.Roles.Update("role-attributes-test", postgresql.Role{
+		Name:               "role-attributes-test",
+		SkipPasswordUpdate: true,
+		Attributes:         postgresql.RoleAttributes{CreateDb: new(false)},
+	})
+	require.NoError(t, err, "update createDb")
+	find, err = store.Roles.Read("role-attributes-test")
+	require.NoError(t, err, "read role")
+	assert.Equal(t, postgresql.RoleAttributes{CreateDb: new(false), CreateRole: new(false)}, find.Attributes)
+}
@@ -0,0 +1,67 @@
+package acc
+
+import (
+	"context"
+	"fmt"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/nullstone-modules/pg-db-admin/secrets"
+	"github.com/nullstone-modules/pg-db-admin/setup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// failingPutStore fails every write so that rotation must roll back
+type failingPutStore struct {
+	*secrets.FileStore
+}
+
+func (s failingPutStore) Put(ctx context.Context, secretId, value string) (string, error) {
+	return "", fmt.Errorf("secret store is unavailable")
+}
+
+func TestRotateAdminPassword(t *testing.T) {
+	if os.Getenv("ACC") != "1" {
+		t.Skip("Set ACC=1 to run e2e tests")
+	}
+
+	ctx := context.Background()
+	store := createStore(t)
+	defer store.Close()
+	store.Policy = nil
+	ensureRdsSuperuser(t, store)
+
+	secretStore, err := secrets.NewFileStore(filepath.Join(t.TempDir(), "secrets.json"))
+	require.NoError(t, err)
+	_, err = setup.Handle(ctx, setup.Event{Setup: true}, store, secretStore, "admin")
+	require.NoError(t, err, "setup")
+	original, err := secretStore.Get(ctx, "admin")
+	require.NoError(t, err)
+
+	t.Run("rollback", func(t *testing.T) {
+		_, err := setup.Handle(ctx, setup.Event{Setup: true, Rotate: true}, store, failingPutStore{FileStore: secretStore}, "admin")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "previous admin password was restored")
+		admin, err := postgresql.OpenDatabase(original, "")
+		require.NoError(t, err, "previous password still works")
+		admin.Close()
+	})
+
+	t.Run("rotate", func(t *testing.T) {
+		result, err := setup.Handle(ctx, setup.Event{Setup: true, Rotate: true}, store, secretStore, "admin")
+		require.NoError(t, err, "rotate")
+		assert.NotEmpty(t, result.SecretVersionId)
+		rotated, err := secretStore.Get(ctx, "admin")
+		require.NoError(t, err)
+		assert.NotEqual(t, original, rotated)
+
+		admin, err := postgresql.OpenDatabase(rotated, "")
+		require.NoError(t, err, "new password works")
+		admin.Close()
+		admin, err = postgresql.OpenDatabase(original, "")
+		assert.Error(t, err, "old password is rejected")
+		admin.Close()
+	})
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"bytes"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"net/http"
+)
+
+// AccessReviewHandler lists every login role in the cluster for an access review
+// `?format=csv` renders the review as CSV
+func AccessReviewHandler(store *postgresql.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		review, err := store.Roles.AccessReview()
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		if r.URL.Query().Get("format") != "csv" {
+			writeJson(w, http.StatusOK, review)
+			return
+		}
+		var buf bytes.Buffer
+		if err := review.WriteCsv(&buf); err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="access-review.csv"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf.Bytes())
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/nullstone-modules/pg-db-admin/audit"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+type auditContextKey struct{}
+
+// auditContext carries the recording Store and the audit entry of a request
+type auditContext struct {
+	store *postgresql.Store
+	entry *audit.Entry
+}
+
+// AuditMiddleware writes an audit entry for every request that changes state
+// Handlers execute against a Store that records statements (see requestStore)
+// GET requests and dry runs are not audited because they do not change state
+// This must run after authentication so that the caller is identified
+func AuditMiddleware(auditor *audit.Auditor, store *postgresql.Store) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !auditor.IsEnabled() || r.Method == http.MethodGet || r.Method == http.MethodHead || queryBool(r, "dryRun") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			entry := &audit.Entry{
+				Caller: audit.CallerFromContext(r.Context()),
+				Source: "http",
+				Type:   r.URL.Path,
+				Key:    routeKey(r),
+				Action: r.Method,
+			}
+			if route := mux.CurrentRoute(r); route != nil {
+				if tmpl, err := route.GetPathTemplate(); err == nil {
+					entry.Type = tmpl
+				}
+			}
+			recording, plan := store.Recording()
+			ctx := context.WithValue(r.Context(), auditContextKey{}, &auditContext{store: recording, entry: entry})
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+			start := time.Now()
+			next.ServeHTTP(sw, r.WithContext(ctx))
+			errMessage := entry.Error
+			entry.Finish(start, plan, nil)
+			if sw.status >= http.StatusBadRequest {
+				entry.Result = audit.ResultFailure
+				entry.Error = errMessage
+			}
+			auditor.Write(r.Context(), *entry)
+		})
+	}
+}
+
+// requestStore returns the Store that a handler must use for r
+// If the request is audited, this is a Store that records the executed statements
+func requestStore(r *http.Request, store *postgresql.Store) *postgresql.Store {
+	if ac, ok := r.Context().Value(auditContextKey{}).(*auditContext); ok {
+		return ac.store
+	}
+	return store
+}
+
+// setAuditKey records the key of the resource that a request acted on
+// This is used when the key is not in the path (e.g. create)
+func setAuditKey(r *http.Request, key any) {
+	if ac, ok := r.Context().Value(auditContextKey{}).(*auditContext); ok {
+		ac.entry.Key = fmt.Sprintf("%+v", key)
+	}
+}
+
+// setAuditError records the error that is reported for a request
+func setAuditError(r *http.Request, message string) {
+	if ac, ok := r.Context().Value(auditContextKey{}).(*auditContext); ok {
+		ac.entry.Error = message
+	}
+}
+
+// routeKey formats the path parameters of the matched route (e.g. `database=app,role=app-user`)
+func routeKey(r *http.Request) string {
+	vars := mux.Vars(r)
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+vars[name])
+	}
+	return strings.Join(pairs, ",")
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
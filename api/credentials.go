@@ -0,0 +1,59 @@
+package api
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/nullstone-modules/pg-db-admin/apierror"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"net/http"
+)
+
+// CreateCredentialsHandler issues a credential lease for the database in the path
+// The body is optional (e.g. `{"ttl": "15m"}`)
+// The template role is chosen by database from LEASE_TEMPLATES (see postgresql.LeaseTemplatesFromEnv)
+func CreateCredentialsHandler(store *postgresql.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lease, err := decodeOptionalBody[postgresql.CredentialLease](r)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		lease.Database = mux.Vars(r)["database"]
+		result, err := requestStore(r, store).Credentials.Create(lease)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		setAuditKey(r, result.Key())
+		writeJson(w, http.StatusCreated, result)
+	}
+}
+
+// RenewCredentialsHandler extends a credential lease by the ttl in the body (or postgresql.DefaultLeaseTtl)
+func RenewCredentialsHandler(store *postgresql.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lease, err := decodeOptionalBody[postgresql.CredentialLease](r)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		key, _ := credentialLeaseKey(r)
+		result, err := requestStore(r, store).Credentials.Update(key, lease)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		if result == nil {
+			WriteError(w, r, apierror.NotFound("not found"))
+			return
+		}
+		writeJson(w, http.StatusOK, result)
+	}
+}
+
+func credentialLeaseKey(r *http.Request) (postgresql.CredentialLeaseKey, error) {
+	vars := mux.Vars(r)
+	return postgresql.CredentialLeaseKey{
+		Database: vars["database"],
+		Id:       vars["id"],
+	}, nil
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"fmt"
+	"github.com/nullstone-modules/pg-db-admin/apierror"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"net/http"
+	"strconv"
+)
+
+// ListFunc retrieves a page of results using the pagination options parsed from the request
+type ListFunc[T any] func(r *http.Request, opts postgresql.ListOptions) (*postgresql.Page[T], error)
+
+// ListHandler produces a handler for a list endpoint
+// Pagination is controlled through the `limit` and `pageToken` query parameters
+func ListHandler[T any](list ListFunc[T]) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opts, err := parseListOptions(r)
+		if err != nil {
+			WriteError(w, r, apierror.InvalidPayload(err))
+			return
+		}
+		page, err := list(r, opts)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		writeJson(w, http.StatusOK, page)
+	}
+}
+
+func parseListOptions(r *http.Request) (postgresql.ListOptions, error) {
+	query := r.URL.Query()
+	opts := postgresql.ListOptions{PageToken: query.Get("pageToken")}
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil || limit < 1 {
+			return opts, fmt.Errorf("invalid limit %q: must be a positive integer", rawLimit)
+		}
+		opts.Limit = limit
+	}
+	return opts, nil
+}
+
+func queryBool(r *http.Request, name string) bool {
+	val, _ := strconv.ParseBool(r.URL.Query().Get(name))
+	return val
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"fmt"
+	"github.com/nullstone-modules/pg-db-admin/apierror"
+	"github.com/nullstone-modules/pg-db-admin/manifest"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"io"
+	"net/http"
+)
+
+// ApplyHandler applies a JSON or YAML manifest in the request body
+// `?dryRun=true` returns the planned statements in the report instead of executing them
+func ApplyHandler(store *postgresql.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		raw, err := io.ReadAll(r.Body)
+		if err != nil {
+			WriteError(w, r, apierror.InvalidPayload(fmt.Errorf("error reading payload: %w", err)))
+			return
+		}
+		m, err := manifest.Parse(raw)
+		if err != nil {
+			WriteError(w, r, apierror.InvalidPayload(err))
+			return
+		}
+		report, err := manifest.ApplyWithDryRun(requestStore(r, store), m, queryBool(r, "dryRun"))
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		writeJson(w, http.StatusOK, report)
+	}
+}
+
+// ExportHandler exports the live state of the cluster
+// `?format=yaml` renders only the manifest as YAML
+func ExportHandler(store *postgresql.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, err := manifest.ExportState(store)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		if r.URL.Query().Get("format") != "yaml" {
+			writeJson(w, http.StatusOK, result)
+			return
+		}
+		raw, err := manifest.ToYaml(result.Manifest)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.WriteHeader(http.StatusOK)
+		w.Write(raw)
+	}
+}
+
+// DriftHandler compares a JSON or YAML manifest in the request body against live state
+func DriftHandler(store *postgresql.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		raw, err := io.ReadAll(r.Body)
+		if err != nil {
+			WriteError(w, r, apierror.InvalidPayload(fmt.Errorf("error reading payload: %w", err)))
+			return
+		}
+		m, err := manifest.Parse(raw)
+		if err != nil {
+			WriteError(w, r, apierror.InvalidPayload(err))
+			return
+		}
+		report, err := manifest.CheckDrift(store, m)
+		if err != nil {
+			WriteError(w, r, apierror.InvalidPayload(err))
+			return
+		}
+		writeJson(w, http.StatusOK, report)
+	}
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/nullstone-io/go-rest-api"
+	"github.com/nullstone-modules/pg-db-admin/apierror"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"io"
+	"net/http"
+)
+
+// Resource exposes a rest.DataAccess as CRUD http handlers
+// This mirrors rest.Resource, but reports failures as structured json errors
+//
+// Create, Update, and Delete support `?dryRun=true`
+// Instead of executing, the planned statements are returned (see postgresql.Store.DryRun)
+type Resource[TKey any, T any] struct {
+	Store *postgresql.Store
+
+	// DataAccess selects the resource's DataAccess from a Store
+	DataAccess func(store *postgresql.Store) rest.DataAccess[TKey, T]
+
+	// KeyParser allows the resource to parse the unique key from the request
+	KeyParser rest.ResourceKeyParserFunc[TKey]
+}
+
+func (r Resource[TKey, T]) Create(w http.ResponseWriter, req *http.Request) {
+	payload, err := decodeBody[T](req)
+	if err != nil {
+		WriteError(w, req, err)
+		return
+	}
+
+	if keyer, ok := any(payload).(interface{ Key() TKey }); ok {
+		setAuditKey(req, keyer.Key())
+	}
+	access, plan := r.dataAccess(req)
+	r.Op(w, req, plan, func() (*T, error) {
+		return access.Create(payload)
+	})
+}
+
+func (r Resource[TKey, T]) Get(w http.ResponseWriter, req *http.Request) {
+	key, err := r.parseKey(req)
+	if err != nil {
+		WriteError(w, req, err)
+		return
+	}
+
+	r.Op(w, req, nil, func() (*T, error) {
+		return r.DataAccess(r.Store).Read(key)
+	})
+}
+
+func (r Resource[TKey, T]) Update(w http.ResponseWriter, req *http.Request) {
+	payload, err := decodeBody[T](req)
+	if err != nil {
+		WriteError(w, req, err)
+		return
+	}
+	key, err := r.parseKey(req)
+	if err != nil {
+		WriteError(w, req, err)
+		return
+	}
+
+	access, plan := r.dataAccess(req)
+	r.Op(w, req, plan, func() (*T, error) {
+		return access.Update(key, payload)
+	})
+}
+
+func (r Resource[TKey, T]) Delete(w http.ResponseWriter, req *http.Request) {
+	key, err := r.parseKey(req)
+	if err != nil {
+		WriteError(w, req, err)
+		return
+	}
+
+	access, plan := r.dataAccess(req)
+	r.Op(w, req, plan, func() (*T, error) {
+		var data T
+		ok, err := access.Drop(key)
+		if !ok && err == nil {
+			return nil, nil
+		}
+		return &data, err
+	})
+}
+
+// Op executes fn and writes the result
+// If plan is not nil, the plan is written instead of the result
+func (r Resource[TKey, T]) Op(w http.ResponseWriter, req *http.Request, plan *postgresql.Plan, fn func() (*T, error)) {
+	result, err := fn()
+	if err != nil {
+		WriteError(w, req, err)
+	} else if plan != nil {
+		writeJson(w, http.StatusOK, plan)
+	} else if result == nil {
+		WriteError(w, req, apierror.NotFound("not found"))
+	} else if req.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		writeJson(w, http.StatusOK, result)
+	}
+}
+
+// dataAccess selects the DataAccess for the request
+// If the request is a dry run, a Plan is returned that records the statements
+func (r Resource[TKey, T]) dataAccess(req *http.Request) (rest.DataAccess[TKey, T], *postgresql.Plan) {
+	store := requestStore(req, r.Store)
+	if !queryBool(req, "dryRun") {
+		return r.DataAccess(store), nil
+	}
+	dry, plan := store.DryRun()
+	return r.DataAccess(dry), plan
+}
+
+func (r Resource[TKey, T]) parseKey(req *http.Request) (TKey, error) {
+	key, err := r.KeyParser(req)
+	if err != nil {
+		return key, apierror.InvalidPayload(err)
+	}
+	return key, nil
+}
+
+func decodeBody[T any](req *http.Request) (T, error) {
+	var payload T
+	raw, err := io.ReadAll(req.Body)
+	if err != nil {
+		return payload, apierror.InvalidPayload(fmt.Errorf("error reading payload: %w", err))
+	}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return payload, apierror.InvalidPayload(fmt.Errorf("invalid payload: %w", err))
+	}
+	return payload, nil
+}
+
+// decodeOptionalBody parses the request body into T
+// An empty body produces the zero value of T
+func decodeOptionalBody[T any](req *http.Request) (T, error) {
+	var payload T
+	raw, err := io.ReadAll(req.Body)
+	if err != nil {
+		return payload, apierror.InvalidPayload(fmt.Errorf("error reading payload: %w", err))
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return payload, nil
+	}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return payload, apierror.InvalidPayload(fmt.Errorf("invalid payload: %w", err))
+	}
+	return payload, nil
+}
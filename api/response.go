@@ -0,0 +1,27 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/nullstone-modules/pg-db-admin/apierror"
+	"log"
+	"net/http"
+)
+
+// WriteError writes err to w as a structured json error
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := apierror.New(err)
+	log.Printf("%d %s %s: %s\n", apiErr.Status, r.Method, r.RequestURI, apiErr.Message)
+	setAuditError(r, apiErr.Message)
+	writeJson(w, apiErr.Status, apiErr)
+}
+
+func writeJson(w http.ResponseWriter, status int, obj any) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		status = http.StatusInternalServerError
+		raw, _ = json.Marshal(&apierror.Error{Status: status, Code: apierror.CodeInternal, Message: err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(raw)
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/nullstone-modules/pg-db-admin/apierror"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"net/http"
+)
+
+// MembershipsHandler returns the transitive membership tree of the role in the path
+func MembershipsHandler(store *postgresql.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tree, err := store.Roles.MembershipTree(mux.Vars(r)["name"])
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		if tree == nil {
+			WriteError(w, r, apierror.NotFound("not found"))
+			return
+		}
+		writeJson(w, http.StatusOK, tree)
+	}
+}
+
+// EffectivePrivilegesHandler reports what the role in the path can do in the database in the query
+// e.g. `GET /roles/app/effective-privileges?database=app`
+func EffectivePrivilegesHandler(store *postgresql.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, err := store.Roles.EffectivePrivileges(mux.Vars(r)["name"], r.URL.Query().Get("database"))
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		if result == nil {
+			WriteError(w, r, apierror.NotFound("not found"))
+			return
+		}
+		writeJson(w, http.StatusOK, result)
+	}
+}
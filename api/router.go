@@ -3,48 +3,83 @@ package api
 import (
 	"github.com/gorilla/mux"
 	"github.com/nullstone-io/go-rest-api"
+	"github.com/nullstone-modules/pg-db-admin/apierror"
 	"github.com/nullstone-modules/pg-db-admin/postgresql"
-	"log"
 	"net/http"
 	"strings"
 )
 
-func CreateRouter(store *postgresql.Store) *mux.Router {
+// CreateRouter creates the REST api for store
+// middlewares are applied to every matched route (e.g. auth.Middleware)
+func CreateRouter(store *postgresql.Store, middlewares ...mux.MiddlewareFunc) *mux.Router {
 	r := mux.NewRouter()
+	r.Use(middlewares...)
 
 	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%d %s %s\n", http.StatusNotFound, r.Method, r.RequestURI)
-		http.NotFound(w, r)
+		WriteError(w, r, apierror.NotFound("not found"))
 	})
 	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%d %s %s\n", http.StatusMethodNotAllowed, r.Method, r.RequestURI)
-		http.Error(w, "", http.StatusMethodNotAllowed)
+		WriteError(w, r, &apierror.Error{Status: http.StatusMethodNotAllowed, Code: apierror.CodeMethodNotAllowed, Message: "method not allowed"})
 	})
 
 	r.Methods(http.MethodDelete).Path("/skip").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 	})
 
-	databases := &rest.Resource[string, postgresql.Database]{
-		DataAccess: store.Databases,
-		KeyParser:  rest.PathParameterKeyParser("name"),
+	r.Methods(http.MethodPost).Path("/apply").HandlerFunc(ApplyHandler(store))
+	r.Methods(http.MethodGet).Path("/export").HandlerFunc(ExportHandler(store))
+	r.Methods(http.MethodPost).Path("/drift").HandlerFunc(DriftHandler(store))
+	r.Methods(http.MethodGet).Path("/access_review").HandlerFunc(AccessReviewHandler(store))
+
+	databases := &Resource[string, postgresql.Database]{
+		Store: store,
+		DataAccess: func(s *postgresql.Store) rest.DataAccess[string, postgresql.Database] {
+			return s.Databases
+		},
+		KeyParser: rest.PathParameterKeyParser("name"),
 	}
+	r.Methods(http.MethodGet).Path("/databases").HandlerFunc(ListHandler(func(r *http.Request, opts postgresql.ListOptions) (*postgresql.Page[postgresql.Database], error) {
+		return store.Databases.List(postgresql.DatabaseFilter{
+			ListOptions: opts,
+			Owner:       r.URL.Query().Get("owner"),
+			NamePrefix:  r.URL.Query().Get("prefix"),
+		})
+	}))
 	r.Methods(http.MethodPost).Path("/databases").HandlerFunc(databases.Create)
 	r.Methods(http.MethodGet).Path("/databases/{name}").HandlerFunc(databases.Get)
 	r.Methods(http.MethodPut).Path("/databases/{name}").HandlerFunc(databases.Update)
 	r.Methods(http.MethodDelete).Path("/databases/{name}").HandlerFunc(databases.Delete)
+	r.Methods(http.MethodGet).Path("/databases/{name}/sessions").HandlerFunc(ListSessionsHandler(store, databaseSessionFilter))
+	r.Methods(http.MethodDelete).Path("/databases/{name}/sessions").HandlerFunc(SignalSessionsHandler(store, databaseSessionFilter))
 
-	roles := rest.Resource[string, postgresql.Role]{
-		DataAccess: store.Roles,
-		KeyParser:  rest.PathParameterKeyParser("name"),
+	roles := Resource[string, postgresql.Role]{
+		Store: store,
+		DataAccess: func(s *postgresql.Store) rest.DataAccess[string, postgresql.Role] {
+			return s.Roles
+		},
+		KeyParser: rest.PathParameterKeyParser("name"),
 	}
+	r.Methods(http.MethodGet).Path("/roles").HandlerFunc(ListHandler(func(r *http.Request, opts postgresql.ListOptions) (*postgresql.Page[postgresql.Role], error) {
+		return store.Roles.List(postgresql.RoleFilter{
+			ListOptions: opts,
+			NamePrefix:  r.URL.Query().Get("prefix"),
+			LoginOnly:   queryBool(r, "login"),
+		})
+	}))
 	r.Methods(http.MethodPost).Path("/roles").HandlerFunc(roles.Create)
 	r.Methods(http.MethodGet).Path("/roles/{name}").HandlerFunc(roles.Get)
 	r.Methods(http.MethodPut).Path("/roles/{name}").HandlerFunc(roles.Update)
 	r.Methods(http.MethodDelete).Path("/roles/{name}").HandlerFunc(roles.Delete)
+	r.Methods(http.MethodGet).Path("/roles/{name}/memberships").HandlerFunc(MembershipsHandler(store))
+	r.Methods(http.MethodGet).Path("/roles/{name}/effective-privileges").HandlerFunc(EffectivePrivilegesHandler(store))
+	r.Methods(http.MethodGet).Path("/roles/{name}/sessions").HandlerFunc(ListSessionsHandler(store, roleSessionFilter))
+	r.Methods(http.MethodDelete).Path("/roles/{name}/sessions").HandlerFunc(SignalSessionsHandler(store, roleSessionFilter))
 
-	roleMembers := rest.Resource[postgresql.RoleMemberKey, postgresql.RoleMember]{
-		DataAccess: store.RoleMembers,
+	roleMembers := Resource[postgresql.RoleMemberKey, postgresql.RoleMember]{
+		Store: store,
+		DataAccess: func(s *postgresql.Store) rest.DataAccess[postgresql.RoleMemberKey, postgresql.RoleMember] {
+			return s.RoleMembers
+		},
 		KeyParser: func(r *http.Request) (postgresql.RoleMemberKey, error) {
 			vars := mux.Vars(r)
 			return postgresql.RoleMemberKey{
@@ -53,13 +88,46 @@ func CreateRouter(store *postgresql.Store) *mux.Router {
 			}, nil
 		},
 	}
+	r.Methods(http.MethodGet).Path("/roles/{target}/members").HandlerFunc(ListHandler(func(r *http.Request, opts postgresql.ListOptions) (*postgresql.Page[postgresql.RoleMember], error) {
+		return store.RoleMembers.List(postgresql.RoleMemberFilter{
+			ListOptions: opts,
+			Target:      mux.Vars(r)["target"],
+		})
+	}))
 	r.Methods(http.MethodPost).Path("/roles/{target}/members").HandlerFunc(roleMembers.Create)
 	r.Methods(http.MethodGet).Path("/roles/{target}/members/{member}").HandlerFunc(roleMembers.Get)
 	r.Methods(http.MethodPut).Path("/roles/{target}/members/{member}").HandlerFunc(roleMembers.Update)
 	r.Methods(http.MethodDelete).Path("/roles/{target}/members/{member}").HandlerFunc(roleMembers.Delete)
 
-	schemaPrivileges := rest.Resource[postgresql.SchemaPrivilegeKey, postgresql.SchemaPrivilege]{
-		DataAccess: store.SchemaPrivileges,
+	schemas := Resource[postgresql.SchemaKey, postgresql.Schema]{
+		Store: store,
+		DataAccess: func(s *postgresql.Store) rest.DataAccess[postgresql.SchemaKey, postgresql.Schema] {
+			return s.Schemas
+		},
+		KeyParser: func(r *http.Request) (postgresql.SchemaKey, error) {
+			vars := mux.Vars(r)
+			return postgresql.SchemaKey{
+				Database: vars["database"],
+				Name:     vars["name"],
+			}, nil
+		},
+	}
+	r.Methods(http.MethodGet).Path("/databases/{database}/schemas").HandlerFunc(ListHandler(func(r *http.Request, opts postgresql.ListOptions) (*postgresql.Page[postgresql.Schema], error) {
+		return store.Schemas.List(postgresql.SchemaFilter{
+			ListOptions: opts,
+			Database:    mux.Vars(r)["database"],
+		})
+	}))
+	r.Methods(http.MethodPost).Path("/databases/{database}/schemas").HandlerFunc(schemas.Create)
+	r.Methods(http.MethodGet).Path("/databases/{database}/schemas/{name}").HandlerFunc(schemas.Get)
+	r.Methods(http.MethodPut).Path("/databases/{database}/schemas/{name}").HandlerFunc(schemas.Update)
+	r.Methods(http.MethodDelete).Path("/databases/{database}/schemas/{name}").HandlerFunc(schemas.Delete)
+
+	schemaPrivileges := Resource[postgresql.SchemaPrivilegeKey, postgresql.SchemaPrivilege]{
+		Store: store,
+		DataAccess: func(s *postgresql.Store) rest.DataAccess[postgresql.SchemaPrivilegeKey, postgresql.SchemaPrivilege] {
+			return s.SchemaPrivileges
+		},
 		KeyParser: func(r *http.Request) (postgresql.SchemaPrivilegeKey, error) {
 			vars := mux.Vars(r)
 			return postgresql.SchemaPrivilegeKey{
@@ -68,13 +136,64 @@ func CreateRouter(store *postgresql.Store) *mux.Router {
 			}, nil
 		},
 	}
+	r.Methods(http.MethodGet).Path("/databases/{database}/schema_privileges").HandlerFunc(ListHandler(func(r *http.Request, opts postgresql.ListOptions) (*postgresql.Page[postgresql.SchemaPrivilege], error) {
+		return store.SchemaPrivileges.List(postgresql.SchemaPrivilegeFilter{
+			ListOptions: opts,
+			Database:    mux.Vars(r)["database"],
+		})
+	}))
 	r.Methods(http.MethodPost).Path("/databases/{database}/schema_privileges").HandlerFunc(schemaPrivileges.Create)
 	r.Methods(http.MethodGet).Path("/databases/{database}/schema_privileges/{role}").HandlerFunc(schemaPrivileges.Get)
 	r.Methods(http.MethodPut).Path("/databases/{database}/schema_privileges/{role}").HandlerFunc(schemaPrivileges.Update)
 	r.Methods(http.MethodDelete).Path("/databases/{database}/schema_privileges/{role}").HandlerFunc(schemaPrivileges.Delete)
 
-	defaultGrants := rest.Resource[postgresql.DefaultGrantKey, postgresql.DefaultGrant]{
-		DataAccess: store.DefaultGrants,
+	databaseAccess := Resource[postgresql.DatabaseAccessKey, postgresql.DatabaseAccess]{
+		Store: store,
+		DataAccess: func(s *postgresql.Store) rest.DataAccess[postgresql.DatabaseAccessKey, postgresql.DatabaseAccess] {
+			return s.DatabaseAccess
+		},
+		KeyParser: func(r *http.Request) (postgresql.DatabaseAccessKey, error) {
+			vars := mux.Vars(r)
+			return postgresql.DatabaseAccessKey{
+				Database: vars["database"],
+				Role:     vars["role"],
+			}, nil
+		},
+	}
+	r.Methods(http.MethodPost).Path("/databases/{database}/access").HandlerFunc(databaseAccess.Create)
+	r.Methods(http.MethodGet).Path("/databases/{database}/access/{role}").HandlerFunc(databaseAccess.Get)
+	r.Methods(http.MethodPut).Path("/databases/{database}/access/{role}").HandlerFunc(databaseAccess.Update)
+	r.Methods(http.MethodDelete).Path("/databases/{database}/access/{role}").HandlerFunc(databaseAccess.Delete)
+
+	credentials := Resource[postgresql.CredentialLeaseKey, postgresql.CredentialLease]{
+		Store: store,
+		DataAccess: func(s *postgresql.Store) rest.DataAccess[postgresql.CredentialLeaseKey, postgresql.CredentialLease] {
+			return s.Credentials
+		},
+		KeyParser: credentialLeaseKey,
+	}
+	r.Methods(http.MethodPost).Path("/databases/{database}/credentials").HandlerFunc(CreateCredentialsHandler(store))
+	r.Methods(http.MethodGet).Path("/databases/{database}/credentials/{id}").HandlerFunc(credentials.Get)
+	r.Methods(http.MethodPost).Path("/databases/{database}/credentials/{id}/renew").HandlerFunc(RenewCredentialsHandler(store))
+	r.Methods(http.MethodDelete).Path("/databases/{database}/credentials/{id}").HandlerFunc(credentials.Delete)
+
+	jitAccess := Resource[string, postgresql.JitAccess]{
+		Store: store,
+		DataAccess: func(s *postgresql.Store) rest.DataAccess[string, postgresql.JitAccess] {
+			return s.JitAccess
+		},
+		KeyParser: rest.PathParameterKeyParser("role"),
+	}
+	r.Methods(http.MethodPost).Path("/jit_access").HandlerFunc(jitAccess.Create)
+	r.Methods(http.MethodGet).Path("/jit_access/{role}").HandlerFunc(jitAccess.Get)
+	r.Methods(http.MethodPut).Path("/jit_access/{role}").HandlerFunc(jitAccess.Update)
+	r.Methods(http.MethodDelete).Path("/jit_access/{role}").HandlerFunc(jitAccess.Delete)
+
+	defaultGrants := Resource[postgresql.DefaultGrantKey, postgresql.DefaultGrant]{
+		Store: store,
+		DataAccess: func(s *postgresql.Store) rest.DataAccess[postgresql.DefaultGrantKey, postgresql.DefaultGrant] {
+			return s.DefaultGrants
+		},
 		KeyParser: func(r *http.Request) (postgresql.DefaultGrantKey, error) {
 			vars := mux.Vars(r)
 			id := vars["id"]
@@ -83,6 +202,13 @@ func CreateRouter(store *postgresql.Store) *mux.Router {
 			return key, nil
 		},
 	}
+	r.Methods(http.MethodGet).Path("/roles/{role}/default_grants").HandlerFunc(ListHandler(func(r *http.Request, opts postgresql.ListOptions) (*postgresql.Page[postgresql.DefaultGrant], error) {
+		return store.DefaultGrants.List(postgresql.DefaultGrantFilter{
+			ListOptions: opts,
+			Role:        mux.Vars(r)["role"],
+			Database:    r.URL.Query().Get("database"),
+		})
+	}))
 	r.Methods(http.MethodPost).Path("/roles/{role}/default_grants").HandlerFunc(defaultGrants.Create)
 	r.Methods(http.MethodGet).Path("/roles/{role}/default_grants/{id}").HandlerFunc(defaultGrants.Get)
 	r.Methods(http.MethodPut).Path("/roles/{role}/default_grants/{id}").HandlerFunc(defaultGrants.Update)
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/nullstone-modules/pg-db-admin/apierror"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"net/http"
+	"time"
+)
+
+// ListSessionsHandler lists the sessions of the role or database in the path
+// `?state=idle&idleFor=10m` only includes sessions that have been idle for at least 10 minutes
+func ListSessionsHandler(store *postgresql.Store, filterFn func(r *http.Request) postgresql.SessionFilter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := sessionFilter(r, filterFn)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		sessions, err := store.Sessions.List(filter)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		if sessions == nil {
+			WriteError(w, r, apierror.NotFound("not found"))
+			return
+		}
+		writeJson(w, http.StatusOK, postgresql.Page[postgresql.Session]{Items: sessions})
+	}
+}
+
+// SignalSessionsHandler terminates the sessions of the role or database in the path
+// `?signal=cancel` cancels the current query of each session instead
+// The same filters as ListSessionsHandler apply
+// `?dryRun=true` reports the sessions that would be signaled without signaling them
+func SignalSessionsHandler(store *postgresql.Store, filterFn func(r *http.Request) postgresql.SessionFilter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := sessionFilter(r, filterFn)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		signal := r.URL.Query().Get("signal")
+		if signal == "" {
+			signal = postgresql.SignalTerminate
+		}
+		signalStore := requestStore(r, store)
+		var plan *postgresql.Plan
+		if queryBool(r, "dryRun") {
+			signalStore, plan = signalStore.DryRun()
+		}
+		report, err := signalStore.Sessions.Signal(filter, signal)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		if report == nil {
+			WriteError(w, r, apierror.NotFound("not found"))
+			return
+		}
+		report.Plan = plan
+		writeJson(w, http.StatusOK, report)
+	}
+}
+
+func sessionFilter(r *http.Request, filterFn func(r *http.Request) postgresql.SessionFilter) (postgresql.SessionFilter, error) {
+	filter := filterFn(r)
+	filter.State = r.URL.Query().Get("state")
+	if raw := r.URL.Query().Get("idleFor"); raw != "" {
+		idleFor, err := time.ParseDuration(raw)
+		if err != nil {
+			return filter, &postgresql.ValidationError{Field: "idleFor", Reason: err.Error()}
+		}
+		filter.IdleFor = idleFor
+	}
+	return filter, nil
+}
+
+func databaseSessionFilter(r *http.Request) postgresql.SessionFilter {
+	return postgresql.SessionFilter{Database: mux.Vars(r)["name"]}
+}
+
+func roleSessionFilter(r *http.Request) postgresql.SessionFilter {
+	return postgresql.SessionFilter{Role: mux.Vars(r)["name"]}
+}
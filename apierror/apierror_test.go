@@ -0,0 +1,90 @@
+package apierror
+
+import (
+	"fmt"
+	"github.com/go-multierror/multierror"
+	"github.com/lib/pq"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		step   string
+		detail string
+	}{
+		{
+			name:   "internal",
+			err:    fmt.Errorf("boom"),
+			status: http.StatusInternalServerError,
+			code:   CodeInternal,
+		},
+		{
+			name:   "step error",
+			err:    &postgresql.StepError{Step: postgresql.StepCreateRole, Err: &pq.Error{Code: "42710", Message: `role "app" already exists`}},
+			status: http.StatusConflict,
+			code:   CodeAlreadyExists,
+			step:   postgresql.StepCreateRole,
+		},
+		{
+			name:   "validation error",
+			err:    &postgresql.ValidationError{Field: "name", Reason: "is required"},
+			status: http.StatusBadRequest,
+			code:   CodeInvalidPayload,
+		},
+		{
+			name:   "policy error",
+			err:    &postgresql.PolicyError{Ref: postgresql.ObjectRef{Kind: postgresql.ObjectRole, Name: "postgres"}, Reason: "it is reserved"},
+			status: http.StatusForbidden,
+			code:   CodeProtectedObject,
+		},
+		{
+			name:   "membership cycle error",
+			err:    &postgresql.MembershipCycleError{Member: "a", Target: "b", Path: []string{"a", "b", "a"}},
+			status: http.StatusConflict,
+			code:   CodeMembershipCycle,
+			detail: "a -> b -> a",
+		},
+		{
+			name:   "membership cycle reported by postgres",
+			err:    &postgresql.StepError{Step: postgresql.StepGrantMembership, Err: &pq.Error{Code: "0LP01", Message: `role "a" is a member of role "b"`}},
+			status: http.StatusConflict,
+			code:   CodeMembershipCycle,
+			step:   postgresql.StepGrantMembership,
+		},
+		{
+			name:   "other invalid grant",
+			err:    &postgresql.StepError{Step: postgresql.StepGrantMembership, Err: &pq.Error{Code: "0LP01", Message: `role "pg_database_owner" cannot have explicit members`}},
+			status: http.StatusBadRequest,
+			code:   CodeInvalidGrant,
+			step:   postgresql.StepGrantMembership,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			apiErr := New(test.err)
+			assert.Equal(t, test.status, apiErr.Status, apiErr.Message)
+			assert.Equal(t, test.code, apiErr.Code)
+			assert.Equal(t, test.step, apiErr.Step)
+			assert.Equal(t, test.detail, apiErr.Detail)
+			assert.Same(t, apiErr, New(apiErr), "an Error is returned as is")
+		})
+	}
+}
+
+func TestNew_MultipleErrors(t *testing.T) {
+	err := multierror.New([]error{
+		&postgresql.ValidationError{Field: "password", Reason: "must contain a digit"},
+		&postgresql.ValidationError{Field: "password", Reason: "is too common"},
+	})
+	apiErr := New(err)
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+	assert.Equal(t, CodeInvalidPayload, apiErr.Code)
+	assert.Len(t, apiErr.Errors, 2)
+}
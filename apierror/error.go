@@ -0,0 +1,150 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-multierror/multierror"
+	"github.com/lib/pq"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	CodeInternal           = "internal_error"
+	CodeInvalidPayload     = "invalid_payload"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeAlreadyExists      = "already_exists"
+	CodePermissionDenied   = "permission_denied"
+	CodeNotFound           = "not_found"
+	CodeObjectInUse        = "object_in_use"
+	CodeTooManyConnections = "too_many_connections"
+	CodeDependencyFailed   = "dependency_failed"
+	CodeDriftDetected      = "drift_detected"
+	CodeProtectedObject    = "protected_object"
+	CodeMembershipCycle    = "membership_cycle"
+	CodeInvalidGrant       = "invalid_grant"
+)
+
+type sqlStateMapping struct {
+	Status int
+	Code   string
+}
+
+// sqlStateMappings maps postgres SQLSTATE codes to http statuses and stable error codes
+// See https://www.postgresql.org/docs/current/errcodes-appendix.html
+var sqlStateMappings = map[pq.ErrorCode]sqlStateMapping{
+	"42710": {Status: http.StatusConflict, Code: CodeAlreadyExists},                // duplicate_object
+	"42P04": {Status: http.StatusConflict, Code: CodeAlreadyExists},                // duplicate_database
+	"42501": {Status: http.StatusForbidden, Code: CodePermissionDenied},            // insufficient_privilege
+	"3D000": {Status: http.StatusNotFound, Code: CodeNotFound},                     // invalid_catalog_name
+	"42704": {Status: http.StatusNotFound, Code: CodeNotFound},                     // undefined_object
+	"55006": {Status: http.StatusConflict, Code: CodeObjectInUse},                  // object_in_use
+	"53300": {Status: http.StatusServiceUnavailable, Code: CodeTooManyConnections}, // too_many_connections
+	"0LP01": {Status: http.StatusBadRequest, Code: CodeInvalidGrant},               // invalid_grant_operation
+}
+
+// membershipCycleRegex matches the message of a grant that postgres refuses because it would form a membership cycle
+// Other grants that are not allowed (e.g. members of pg_database_owner) are also reported as 0LP01
+var membershipCycleRegex = regexp.MustCompile(`^role ".*" is a member of role ".*"$`)
+
+// Error is a structured error that is returned to callers of the api, crud-invoke, and event handlers
+type Error struct {
+	// Status is the http status code for the error
+	Status   int    `json:"status"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	SqlState string `json:"sqlstate,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Hint     string `json:"hint,omitempty"`
+	// Step identifies the step of the operation that failed (e.g. create-database)
+	Step string `json:"step,omitempty"`
+	// Errors contains additional errors when an operation failed in multiple steps
+	// The first error determines Status and Code
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+// Error renders the structured error as json
+// This allows the structured error to flow through error-only channels (e.g. lambda errorMessage)
+func (e *Error) Error() string {
+	raw, _ := json.Marshal(e)
+	return string(raw)
+}
+
+// New converts err into a structured Error
+func New(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var multi multierror.MultipleErrors
+	if errors.As(err, &multi) && len(multi) > 0 {
+		result := newSingleError(multi[0])
+		result.Message = err.Error()
+		for _, cur := range multi {
+			result.Errors = append(result.Errors, newSingleError(cur))
+		}
+		return result
+	}
+	return newSingleError(err)
+}
+
+func newSingleError(err error) *Error {
+	result := &Error{
+		Status:  http.StatusInternalServerError,
+		Code:    CodeInternal,
+		Message: err.Error(),
+	}
+
+	var validationErr *postgresql.ValidationError
+	if errors.As(err, &validationErr) {
+		result.Status = http.StatusBadRequest
+		result.Code = CodeInvalidPayload
+	}
+
+	var policyErr *postgresql.PolicyError
+	if errors.As(err, &policyErr) {
+		result.Status = http.StatusForbidden
+		result.Code = CodeProtectedObject
+	}
+
+	var cycleErr *postgresql.MembershipCycleError
+	if errors.As(err, &cycleErr) {
+		result.Status = http.StatusConflict
+		result.Code = CodeMembershipCycle
+		result.Detail = strings.Join(cycleErr.Path, " -> ")
+	}
+
+	var stepErr *postgresql.StepError
+	if errors.As(err, &stepErr) {
+		result.Step = stepErr.Step
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		result.SqlState = string(pqErr.Code)
+		result.Detail = pqErr.Detail
+		result.Hint = pqErr.Hint
+		if mapping, ok := sqlStateMappings[pqErr.Code]; ok {
+			result.Status = mapping.Status
+			result.Code = mapping.Code
+		}
+		if pqErr.Code == "0LP01" && membershipCycleRegex.MatchString(pqErr.Message) {
+			result.Status = http.StatusConflict
+			result.Code = CodeMembershipCycle
+		}
+	}
+	return result
+}
+
+// InvalidPayload produces a 400 Bad Request error for err
+func InvalidPayload(err error) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeInvalidPayload, Message: err.Error()}
+}
+
+// NotFound produces a 404 Not Found error
+func NotFound(message string) *Error {
+	return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Message: message}
+}
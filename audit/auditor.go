@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// SinksEnvVar is a comma-separated list of sinks that receive audit entries (default: stdout)
+	// Valid values: stdout, table, webhook, none
+	SinksEnvVar = "AUDIT_SINKS"
+	// WebhookUrlEnvVar is the url that receives audit entries when the webhook sink is enabled
+	WebhookUrlEnvVar = "AUDIT_WEBHOOK_URL"
+	// WebhookAuthorizationEnvVar is sent as the Authorization header to the webhook
+	WebhookAuthorizationEnvVar = "AUDIT_WEBHOOK_AUTHORIZATION"
+
+	SinkStdout  = "stdout"
+	SinkTable   = "table"
+	SinkWebhook = "webhook"
+	SinkNone    = "none"
+)
+
+// Sink receives audit entries
+type Sink interface {
+	Write(ctx context.Context, entry Entry) error
+}
+
+// Auditor writes audit entries to every sink
+// A failure to write to a sink is logged, but does not fail the action that was audited
+type Auditor struct {
+	Sinks []Sink
+}
+
+// NewFromEnv creates an Auditor using the sinks in AUDIT_SINKS
+// The table sink writes to the metadata schema of store
+func NewFromEnv(store *postgresql.Store) (*Auditor, error) {
+	names := os.Getenv(SinksEnvVar)
+	if names == "" {
+		names = SinkStdout
+	}
+	auditor := &Auditor{Sinks: make([]Sink, 0)}
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case SinkStdout:
+			auditor.Sinks = append(auditor.Sinks, NewStdoutSink())
+		case SinkTable:
+			auditor.Sinks = append(auditor.Sinks, &TableSink{DbOpener: store})
+		case SinkWebhook:
+			url := os.Getenv(WebhookUrlEnvVar)
+			if url == "" {
+				return nil, fmt.Errorf("%s is required for the %s audit sink", WebhookUrlEnvVar, SinkWebhook)
+			}
+			auditor.Sinks = append(auditor.Sinks, NewWebhookSink(url, os.Getenv(WebhookAuthorizationEnvVar)))
+		case SinkNone, "":
+		default:
+			return nil, fmt.Errorf("unknown audit sink %q", name)
+		}
+	}
+	return auditor, nil
+}
+
+// IsEnabled returns false if there are no sinks
+func (a *Auditor) IsEnabled() bool {
+	return a != nil && len(a.Sinks) > 0
+}
+
+func (a *Auditor) Write(ctx context.Context, entry Entry) {
+	if !a.IsEnabled() {
+		return
+	}
+	for _, sink := range a.Sinks {
+		if err := sink.Write(ctx, entry); err != nil {
+			log.Printf("error writing audit entry (%T): %s\n", sink, err)
+		}
+	}
+}
+
+// Run executes fn against a Store that records the executed statements and writes entry with the outcome
+func (a *Auditor) Run(ctx context.Context, entry Entry, store *postgresql.Store, fn func(store *postgresql.Store) (any, error)) (any, error) {
+	if !a.IsEnabled() {
+		return fn(store)
+	}
+	recording, plan := store.Recording()
+	start := time.Now()
+	result, err := fn(recording)
+	entry.Finish(start, plan, err)
+	a.Write(ctx, entry)
+	return result, err
+}
@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"context"
+	"github.com/nullstone-modules/pg-db-admin/apierror"
+	"github.com/nullstone-modules/pg-db-admin/auth"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"time"
+)
+
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Entry is a structured record of an administrative action
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Caller Caller    `json:"caller"`
+	// Source is the entrypoint that received the action (e.g. http, crud-invoke, legacy, manifest, setup, sweeper)
+	Source string `json:"source"`
+	// Type is the type of resource (e.g. roles) or the route that was invoked
+	Type   string `json:"type"`
+	Key    string `json:"key"`
+	Action string `json:"action"`
+	// Statements are the statements that were executed, with passwords redacted
+	Statements []postgresql.PlannedStatement `json:"statements"`
+	Result     string                        `json:"result"`
+	Error      string                        `json:"error,omitempty"`
+	DurationMs int64                         `json:"durationMs"`
+}
+
+// Caller identifies who performed an action
+type Caller struct {
+	// Subject is the unique name of the caller (e.g. an IAM ARN, jwt subject, or hmac key id)
+	Subject string `json:"subject"`
+	// Method is how the caller was identified (e.g. iam, jwt, hmac, mtls, payload)
+	Method string `json:"method"`
+}
+
+// CallerFromContext produces a Caller from the authenticated auth.Principal in ctx
+// If there is no Principal, an empty Caller is returned
+func CallerFromContext(ctx context.Context) Caller {
+	principal := auth.PrincipalFromContext(ctx)
+	if principal == nil {
+		return Caller{}
+	}
+	return Caller{Subject: principal.Subject, Method: principal.Method}
+}
+
+// Finish completes the entry with the outcome of an action that started at start
+func (e *Entry) Finish(start time.Time, plan *postgresql.Plan, err error) {
+	e.Time = start.UTC()
+	e.DurationMs = time.Since(start).Milliseconds()
+	e.Statements = make([]postgresql.PlannedStatement, 0)
+	if plan != nil {
+		e.Statements = plan.Statements
+	}
+	e.Result = ResultSuccess
+	if err != nil {
+		e.Fail(err)
+	}
+}
+
+// Fail marks the entry as failed with the structured error message of err
+func (e *Entry) Fail(err error) {
+	e.Result = ResultFailure
+	e.Error = apierror.New(err).Message
+}
@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const auditLogTable = "audit_log"
+
+var _ Sink = &StdoutSink{}
+
+// StdoutSink writes each entry as a line of json
+type StdoutSink struct {
+	Writer io.Writer
+	sync.Mutex
+}
+
+func NewStdoutSink() *StdoutSink {
+	return &StdoutSink{Writer: os.Stdout}
+}
+
+func (s *StdoutSink) Write(ctx context.Context, entry Entry) error {
+	raw, err := json.Marshal(struct {
+		Audit Entry `json:"audit"`
+	}{Audit: entry})
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	_, err = s.Writer.Write(append(raw, '\n'))
+	return err
+}
+
+var _ Sink = &TableSink{}
+
+// TableSink inserts each entry into the pg_db_admin.audit_log table of the admin database
+type TableSink struct {
+	DbOpener postgresql.DbOpener
+	once     sync.Once
+	initErr  error
+}
+
+func (s *TableSink) Write(ctx context.Context, entry Entry) error {
+	db, err := s.DbOpener.OpenDatabase("")
+	if err != nil {
+		return err
+	}
+	s.once.Do(func() {
+		columns := `id bigserial PRIMARY KEY,
+	time timestamptz NOT NULL,
+	caller_subject text NOT NULL,
+	caller_method text NOT NULL,
+	source text NOT NULL,
+	type text NOT NULL,
+	key text NOT NULL,
+	action text NOT NULL,
+	statements jsonb NOT NULL,
+	result text NOT NULL,
+	error text NOT NULL,
+	duration_ms bigint NOT NULL`
+		s.initErr = postgresql.EnsureMetadataTable(db, auditLogTable, columns)
+	})
+	if s.initErr != nil {
+		return s.initErr
+	}
+
+	statements, err := json.Marshal(entry.Statements)
+	if err != nil {
+		return err
+	}
+	sq := fmt.Sprintf(`INSERT INTO %s (time, caller_subject, caller_method, source, type, key, action, statements, result, error, duration_ms)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`, postgresql.MetadataTable(auditLogTable))
+	_, err = db.Exec(sq, entry.Time, entry.Caller.Subject, entry.Caller.Method, entry.Source, entry.Type, entry.Key, entry.Action,
+		string(statements), entry.Result, entry.Error, entry.DurationMs)
+	return err
+}
+
+var _ Sink = &WebhookSink{}
+
+// WebhookSink posts each entry as json to Url
+type WebhookSink struct {
+	Url string
+	// Authorization is sent as the Authorization header if not empty
+	Authorization string
+	Client        *http.Client
+}
+
+func NewWebhookSink(url, authorization string) *WebhookSink {
+	return &WebhookSink{
+		Url:           url,
+		Authorization: authorization,
+		Client:        &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (s *WebhookSink) Write(ctx context.Context, entry Entry) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Url, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Authorization != "" {
+		req.Header.Set("Authorization", s.Authorization)
+	}
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting audit entry to webhook: %w", err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook responded with %d", res.StatusCode)
+	}
+	return nil
+}
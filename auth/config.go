@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"github.com/gorilla/mux"
+	"os"
+	"strconv"
+)
+
+const (
+	// JwksFileEnvVar enables bearer token authentication using the JWKS in this file
+	JwksFileEnvVar        = "AUTH_JWKS_FILE"
+	JwtIssuerEnvVar       = "AUTH_JWT_ISSUER"
+	JwtAudienceEnvVar     = "AUTH_JWT_AUDIENCE"
+	JwtSubjectClaimEnvVar = "AUTH_JWT_SUBJECT_CLAIM"
+	// HmacKeysFileEnvVar enables hmac-signed request authentication using the json object of key id => secret in this file
+	HmacKeysFileEnvVar = "AUTH_HMAC_KEYS_FILE"
+	// ClientCertEnvVar enables authentication using verified TLS client certificates
+	ClientCertEnvVar = "AUTH_MTLS"
+	// PolicyFileEnvVar enables per-route authorization using the Policy in this file
+	PolicyFileEnvVar = "AUTH_POLICY_FILE"
+)
+
+// MiddlewaresFromEnv configures authentication and authorization from env vars
+// If no authentication method is configured, no middlewares are returned
+func MiddlewaresFromEnv() ([]mux.MiddlewareFunc, error) {
+	authenticators := make([]Authenticator, 0)
+	if jwksFile := os.Getenv(JwksFileEnvVar); jwksFile != "" {
+		jwt, err := NewJwtAuthenticatorFromFile(jwksFile, os.Getenv(JwtIssuerEnvVar), os.Getenv(JwtAudienceEnvVar))
+		if err != nil {
+			return nil, err
+		}
+		if subjectClaim := os.Getenv(JwtSubjectClaimEnvVar); subjectClaim != "" {
+			jwt.SubjectClaim = subjectClaim
+		}
+		authenticators = append(authenticators, jwt)
+	}
+	if keysFile := os.Getenv(HmacKeysFileEnvVar); keysFile != "" {
+		hmac, err := NewHmacAuthenticatorFromFile(keysFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, hmac)
+	}
+	if enabled, _ := strconv.ParseBool(os.Getenv(ClientCertEnvVar)); enabled {
+		authenticators = append(authenticators, ClientCertAuthenticator{})
+	}
+	if len(authenticators) == 0 {
+		return []mux.MiddlewareFunc{}, nil
+	}
+
+	var policy *Policy
+	if policyFile := os.Getenv(PolicyFileEnvVar); policyFile != "" {
+		var err error
+		if policy, err = LoadPolicyFile(policyFile); err != nil {
+			return nil, err
+		}
+	}
+	return []mux.MiddlewareFunc{Middleware(authenticators, policy)}, nil
+}
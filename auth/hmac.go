@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	HmacKeyIdHeader     = "X-Pg-Db-Admin-Key-Id"
+	HmacTimestampHeader = "X-Pg-Db-Admin-Timestamp"
+	HmacSignatureHeader = "X-Pg-Db-Admin-Signature"
+)
+
+var _ Authenticator = &HmacAuthenticator{}
+
+// HmacAuthenticator validates requests signed with a shared secret
+// A caller signs the following string with HMAC-SHA256 and sends the hex-encoded result in X-Pg-Db-Admin-Signature:
+//
+//	<method>\n<path>\n<raw query>\n<unix timestamp>\n<hex sha256 of body>
+//
+// The timestamp is sent in X-Pg-Db-Admin-Timestamp and the key id in X-Pg-Db-Admin-Key-Id
+// A signature is only accepted once within MaxSkew so that a captured request cannot be replayed
+// Seen signatures are kept in memory, so replay protection does not span multiple instances of pg-db-admin
+// Callers that retry a request must sign it again with a new timestamp
+type HmacAuthenticator struct {
+	// Keys maps key id to shared secret; the key id is used as the Principal subject
+	Keys map[string]string
+	// MaxSkew is the maximum age (or clock skew) of a signed request
+	MaxSkew time.Duration
+
+	seen map[string]time.Time
+	sync.Mutex
+}
+
+// NewHmacAuthenticatorFromFile loads a json object of key id => secret from keysFile
+func NewHmacAuthenticatorFromFile(keysFile string) (*HmacAuthenticator, error) {
+	raw, err := os.ReadFile(keysFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading hmac keys file %q: %w", keysFile, err)
+	}
+	keys := map[string]string{}
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return nil, fmt.Errorf("invalid hmac keys file %q: %w", keysFile, err)
+	}
+	return &HmacAuthenticator{Keys: keys, MaxSkew: 5 * time.Minute}, nil
+}
+
+func (a *HmacAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	keyId := r.Header.Get(HmacKeyIdHeader)
+	if keyId == "" {
+		return nil, ErrNoCredentials
+	}
+	secret, ok := a.Keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("unknown hmac key id %q", keyId)
+	}
+
+	rawTimestamp := r.Header.Get(HmacTimestampHeader)
+	timestamp, err := strconv.ParseInt(rawTimestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s header", HmacTimestampHeader)
+	}
+	if skew := time.Since(time.Unix(timestamp, 0)); skew > a.MaxSkew || skew < -a.MaxSkew {
+		return nil, fmt.Errorf("signed request has expired")
+	}
+
+	signature, err := hex.DecodeString(r.Header.Get(HmacSignatureHeader))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s header", HmacSignatureHeader)
+	}
+	expected, err := HmacSignature(r, secret, rawTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(signature, expected) {
+		return nil, fmt.Errorf("invalid request signature")
+	}
+	if !a.markSeen(keyId, signature) {
+		return nil, fmt.Errorf("signed request has already been used")
+	}
+	return &Principal{Subject: keyId, Method: "hmac"}, nil
+}
+
+// markSeen records a valid signature and reports whether it was not seen before
+// Signatures are forgotten once they are older than MaxSkew since they are rejected as expired after that
+func (a *HmacAuthenticator) markSeen(keyId string, signature []byte) bool {
+	a.Lock()
+	defer a.Unlock()
+
+	now := time.Now()
+	if a.seen == nil {
+		a.seen = map[string]time.Time{}
+	}
+	for key, at := range a.seen {
+		// Requests may be signed up to MaxSkew in the future, so keep signatures for twice MaxSkew
+		if now.Sub(at) > 2*a.MaxSkew {
+			delete(a.seen, key)
+		}
+	}
+	key := keyId + ":" + hex.EncodeToString(signature)
+	if _, ok := a.seen[key]; ok {
+		return false
+	}
+	a.seen[key] = now
+	return true
+}
+
+// HmacSignature computes the signature for a request
+// The request body is read and replaced so that it is still available to handlers
+func HmacSignature(r *http.Request, secret, timestamp string) ([]byte, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return nil, fmt.Errorf("error reading request body: %w", err)
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewBuffer(body))
+	}
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", r.Method, r.URL.Path, r.URL.RawQuery, timestamp, hex.EncodeToString(bodyHash[:]))
+	return mac.Sum(nil), nil
+}
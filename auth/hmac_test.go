@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSignedRequest creates a request signed by keyId/secret at timestamp
+func newSignedRequest(t *testing.T, keyId, secret string, timestamp time.Time, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/roles?dryRun=true", strings.NewReader(body))
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	signature, err := HmacSignature(r, secret, ts)
+	require.NoError(t, err)
+	r.Header.Set(HmacKeyIdHeader, keyId)
+	r.Header.Set(HmacTimestampHeader, ts)
+	r.Header.Set(HmacSignatureHeader, hex.EncodeToString(signature))
+	return r
+}
+
+func TestHmacAuthenticator(t *testing.T) {
+	const body = `{"name":"app"}`
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		request func(t *testing.T) *http.Request
+		wantErr string
+	}{
+		{
+			name: "valid signature",
+			request: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, "deployer", "secret", now, body)
+			},
+		},
+		{
+			name: "clock skew within max skew",
+			request: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, "deployer", "secret", now.Add(4*time.Minute), body)
+			},
+		},
+		{
+			name: "no credentials",
+			request: func(t *testing.T) *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/roles", strings.NewReader(body))
+			},
+			wantErr: ErrNoCredentials.Error(),
+		},
+		{
+			name: "unknown key id",
+			request: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, "other", "secret", now, body)
+			},
+			wantErr: `unknown hmac key id "other"`,
+		},
+		{
+			name: "invalid timestamp",
+			request: func(t *testing.T) *http.Request {
+				r := newSignedRequest(t, "deployer", "secret", now, body)
+				r.Header.Set(HmacTimestampHeader, "yesterday")
+				return r
+			},
+			wantErr: "invalid X-Pg-Db-Admin-Timestamp header",
+		},
+		{
+			name: "expired",
+			request: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, "deployer", "secret", now.Add(-6*time.Minute), body)
+			},
+			wantErr: "signed request has expired",
+		},
+		{
+			name: "too far in the future",
+			request: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, "deployer", "secret", now.Add(6*time.Minute), body)
+			},
+			wantErr: "signed request has expired",
+		},
+		{
+			name: "wrong secret",
+			request: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, "deployer", "guess", now, body)
+			},
+			wantErr: "invalid request signature",
+		},
+		{
+			name: "invalid signature encoding",
+			request: func(t *testing.T) *http.Request {
+				r := newSignedRequest(t, "deployer", "secret", now, body)
+				r.Header.Set(HmacSignatureHeader, "not-hex")
+				return r
+			},
+			wantErr: "invalid X-Pg-Db-Admin-Signature header",
+		},
+		{
+			name: "tampered body",
+			request: func(t *testing.T) *http.Request {
+				r := newSignedRequest(t, "deployer", "secret", now, body)
+				r.Body = io.NopCloser(strings.NewReader(`{"name":"admin"}`))
+				return r
+			},
+			wantErr: "invalid request signature",
+		},
+		{
+			name: "tampered query",
+			request: func(t *testing.T) *http.Request {
+				r := newSignedRequest(t, "deployer", "secret", now, body)
+				r.URL.RawQuery = "dryRun=false"
+				return r
+			},
+			wantErr: "invalid request signature",
+		},
+		{
+			name: "tampered timestamp",
+			request: func(t *testing.T) *http.Request {
+				r := newSignedRequest(t, "deployer", "secret", now, body)
+				r.Header.Set(HmacTimestampHeader, strconv.FormatInt(now.Add(time.Second).Unix(), 10))
+				return r
+			},
+			wantErr: "invalid request signature",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &HmacAuthenticator{Keys: map[string]string{"deployer": "secret"}, MaxSkew: 5 * time.Minute}
+			r := test.request(t)
+			principal, err := a.Authenticate(r)
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, &Principal{Subject: "deployer", Method: "hmac"}, principal)
+
+			// The body is still available to handlers
+			raw, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			assert.Equal(t, body, string(raw))
+		})
+	}
+}
+
+func TestHmacAuthenticator_Replay(t *testing.T) {
+	a := &HmacAuthenticator{Keys: map[string]string{"deployer": "secret", "other": "secret"}, MaxSkew: 5 * time.Minute}
+	now := time.Now()
+
+	_, err := a.Authenticate(newSignedRequest(t, "deployer", "secret", now, "{}"))
+	require.NoError(t, err)
+	_, err = a.Authenticate(newSignedRequest(t, "deployer", "secret", now, "{}"))
+	assert.ErrorContains(t, err, "signed request has already been used")
+
+	// A request signed again with a new timestamp is accepted
+	_, err = a.Authenticate(newSignedRequest(t, "deployer", "secret", now.Add(time.Second), "{}"))
+	assert.NoError(t, err)
+	// Signatures are tracked per key id
+	_, err = a.Authenticate(newSignedRequest(t, "other", "secret", now, "{}"))
+	assert.NoError(t, err)
+
+	// Signatures older than the skew window are forgotten
+	for key := range a.seen {
+		a.seen[key] = now.Add(-11 * time.Minute)
+	}
+	_, err = a.Authenticate(newSignedRequest(t, "deployer", "secret", now.Add(2*time.Second), "{}"))
+	require.NoError(t, err)
+	assert.Len(t, a.seen, 1)
+}
+
+func TestNewHmacAuthenticatorFromFile(t *testing.T) {
+	dir := t.TempDir()
+	keysFile := filepath.Join(dir, "keys.json")
+	require.NoError(t, os.WriteFile(keysFile, []byte(`{"deployer": "secret"}`), 0600))
+
+	a, err := NewHmacAuthenticatorFromFile(keysFile)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"deployer": "secret"}, a.Keys)
+	assert.Equal(t, 5*time.Minute, a.MaxSkew)
+
+	_, err = NewHmacAuthenticatorFromFile(filepath.Join(dir, "missing.json"))
+	assert.ErrorContains(t, err, "error reading hmac keys file")
+
+	invalidFile := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalidFile, []byte(`["secret"]`), 0600))
+	_, err = NewHmacAuthenticatorFromFile(invalidFile)
+	assert.ErrorContains(t, err, "invalid hmac keys file")
+}
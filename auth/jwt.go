@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var _ Authenticator = &JwtAuthenticator{}
+
+// JwtAuthenticator validates OIDC/JWT bearer tokens against a local JWKS
+// Keys are loaded once; there is no network access to an identity provider
+type JwtAuthenticator struct {
+	Keys     map[string]crypto.PublicKey
+	Issuer   string
+	Audience string
+	// SubjectClaim is the claim used as the Principal subject (default: sub)
+	SubjectClaim string
+	// Leeway is the allowed clock skew when validating exp/nbf
+	Leeway time.Duration
+}
+
+// NewJwtAuthenticatorFromFile loads the JWKS from jwksFile
+func NewJwtAuthenticatorFromFile(jwksFile, issuer, audience string) (*JwtAuthenticator, error) {
+	raw, err := os.ReadFile(jwksFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading jwks file %q: %w", jwksFile, err)
+	}
+	keys, err := ParseJwks(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwks file %q: %w", jwksFile, err)
+	}
+	return &JwtAuthenticator{
+		Keys:         keys,
+		Issuer:       issuer,
+		Audience:     audience,
+		SubjectClaim: "sub",
+		Leeway:       time.Minute,
+	}, nil
+}
+
+func (a *JwtAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := a.Verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bearer token: %w", err)
+	}
+	subjectClaim := a.SubjectClaim
+	if subjectClaim == "" {
+		subjectClaim = "sub"
+	}
+	subject, _ := claims[subjectClaim].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("invalid bearer token: missing %q claim", subjectClaim)
+	}
+	return &Principal{Subject: subject, Method: "jwt", Claims: claims}, nil
+}
+
+// Verify checks the token signature and standard claims and returns the token claims
+func (a *JwtAuthenticator) Verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJwtPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed header: %w", err)
+	}
+	key, ok := a.Keys[header.Kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", header.Kid)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %w", err)
+	}
+	if err := verifyJwtSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	claims := map[string]any{}
+	if err := decodeJwtPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed claims: %w", err)
+	}
+	if err := a.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (a *JwtAuthenticator) validateClaims(claims map[string]any) error {
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("missing exp claim")
+	}
+	if now.Add(-a.Leeway).After(time.Unix(int64(exp), 0)) {
+		return fmt.Errorf("token is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(a.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("token is not valid yet")
+	}
+	if a.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != a.Issuer {
+			return fmt.Errorf("unexpected issuer %q", iss)
+		}
+	}
+	if a.Audience != "" && !hasAudience(claims["aud"], a.Audience) {
+		return fmt.Errorf("token is not intended for audience %q", a.Audience)
+	}
+	return nil
+}
+
+func hasAudience(aud any, want string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == want
+	case []any:
+		for _, cur := range v {
+			if s, _ := cur.(string); s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeJwtPart(part string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func verifyJwtSignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("signing algorithm %q does not match rsa key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, signature); err != nil {
+			return fmt.Errorf("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return fmt.Errorf("signing algorithm %q does not match ecdsa key", alg)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("invalid signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+	return nil
+}
+
+// ParseJwks parses a JSON Web Key Set into public keys indexed by key id
+// Only RSA and EC signing keys are supported
+func ParseJwks(raw []byte) (map[string]crypto.PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+			if err != nil {
+				return nil, fmt.Errorf("key %q has invalid modulus: %w", jwk.Kid, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+			if err != nil {
+				return nil, fmt.Errorf("key %q has invalid exponent: %w", jwk.Kid, err)
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch jwk.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				return nil, fmt.Errorf("key %q has unsupported curve %q", jwk.Kid, jwk.Crv)
+			}
+			x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+			if err != nil {
+				return nil, fmt.Errorf("key %q has invalid x coordinate: %w", jwk.Kid, err)
+			}
+			y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if err != nil {
+				return nil, fmt.Errorf("key %q has invalid y coordinate: %w", jwk.Kid, err)
+			}
+			keys[jwk.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys found")
+	}
+	return keys, nil
+}
@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testJwtKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newTestJwtKeys(t *testing.T) testJwtKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return testJwtKeys{rsa: rsaKey, ec: ecKey}
+}
+
+func (k testJwtKeys) authenticator() *JwtAuthenticator {
+	return &JwtAuthenticator{
+		Keys:         map[string]crypto.PublicKey{"rsa": &k.rsa.PublicKey, "ec": &k.ec.PublicKey},
+		Issuer:       "https://issuer.example.com",
+		Audience:     "pg-db-admin",
+		SubjectClaim: "sub",
+		Leeway:       time.Minute,
+	}
+}
+
+// sign creates a token signed with the key identified by kid
+// The alg header may differ from the key type to exercise algorithm confusion
+func (k testJwtKeys) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	header, err := json.Marshal(map[string]any{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch {
+	case alg == "none":
+	case alg == "HS256":
+		// Alg confusion: a token signed with the public key as an hmac secret
+		mac := hmac.New(sha256.New, k.rsa.PublicKey.N.Bytes())
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case kid == "ec":
+		r, s, err := ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		require.NoError(t, err)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	default:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"sub": "deployer",
+		"iss": "https://issuer.example.com",
+		"aud": "pg-db-admin",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func withClaims(changes map[string]any) map[string]any {
+	claims := validClaims()
+	for key, value := range changes {
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+	}
+	return claims
+}
+
+func TestJwtAuthenticator_Verify(t *testing.T) {
+	keys := newTestJwtKeys(t)
+	tamper := func(token string) string {
+		parts := strings.Split(token, ".")
+		payload, _ := json.Marshal(withClaims(map[string]any{"sub": "admin"}))
+		parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+		return strings.Join(parts, ".")
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{
+			name:  "valid rsa token",
+			token: keys.sign(t, "RS256", "rsa", validClaims()),
+		},
+		{
+			name:  "valid ecdsa token",
+			token: keys.sign(t, "ES256", "ec", validClaims()),
+		},
+		{
+			name:  "audience array",
+			token: keys.sign(t, "RS256", "rsa", withClaims(map[string]any{"aud": []string{"other", "pg-db-admin"}})),
+		},
+		{
+			name:  "expired within leeway",
+			token: keys.sign(t, "RS256", "rsa", withClaims(map[string]any{"exp": time.Now().Add(-30 * time.Second).Unix()})),
+		},
+		{
+			name:    "malformed token",
+			token:   "not-a-token",
+			wantErr: "malformed token",
+		},
+		{
+			name:    "unknown key id",
+			token:   keys.sign(t, "RS256", "other", validClaims()),
+			wantErr: `unknown key id "other"`,
+		},
+		{
+			name:    "tampered claims",
+			token:   tamper(keys.sign(t, "RS256", "rsa", validClaims())),
+			wantErr: "invalid signature",
+		},
+		{
+			name:    "alg none",
+			token:   keys.sign(t, "none", "rsa", validClaims()),
+			wantErr: `unsupported signing algorithm "none"`,
+		},
+		{
+			name:    "hmac signed with the public key",
+			token:   keys.sign(t, "HS256", "rsa", validClaims()),
+			wantErr: `unsupported signing algorithm "HS256"`,
+		},
+		{
+			name:    "ecdsa alg with an rsa key",
+			token:   keys.sign(t, "ES256", "rsa", validClaims()),
+			wantErr: `signing algorithm "ES256" does not match rsa key`,
+		},
+		{
+			name:    "rsa alg with an ecdsa key",
+			token:   keys.sign(t, "RS256", "ec", validClaims()),
+			wantErr: `signing algorithm "RS256" does not match ecdsa key`,
+		},
+		{
+			name:    "missing exp",
+			token:   keys.sign(t, "RS256", "rsa", withClaims(map[string]any{"exp": nil})),
+			wantErr: "missing exp claim",
+		},
+		{
+			name:    "expired",
+			token:   keys.sign(t, "RS256", "rsa", withClaims(map[string]any{"exp": time.Now().Add(-2 * time.Minute).Unix()})),
+			wantErr: "token is expired",
+		},
+		{
+			name:    "not valid yet",
+			token:   keys.sign(t, "RS256", "rsa", withClaims(map[string]any{"nbf": time.Now().Add(2 * time.Minute).Unix()})),
+			wantErr: "token is not valid yet",
+		},
+		{
+			name:    "unexpected issuer",
+			token:   keys.sign(t, "RS256", "rsa", withClaims(map[string]any{"iss": "https://evil.example.com"})),
+			wantErr: `unexpected issuer "https://evil.example.com"`,
+		},
+		{
+			name:    "unexpected audience",
+			token:   keys.sign(t, "RS256", "rsa", withClaims(map[string]any{"aud": []string{"other"}})),
+			wantErr: `token is not intended for audience "pg-db-admin"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := keys.authenticator().Verify(test.token)
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				assert.Nil(t, claims)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "deployer", claims["sub"])
+		})
+	}
+}
+
+func TestJwtAuthenticator_Authenticate(t *testing.T) {
+	keys := newTestJwtKeys(t)
+	tests := []struct {
+		name          string
+		authorization string
+		subjectClaim  string
+		wantSubject   string
+		wantErr       error
+		wantErrText   string
+	}{
+		{
+			name:          "bearer token",
+			authorization: "Bearer " + keys.sign(t, "RS256", "rsa", validClaims()),
+			wantSubject:   "deployer",
+		},
+		{
+			name:          "custom subject claim",
+			authorization: "bearer " + keys.sign(t, "RS256", "rsa", withClaims(map[string]any{"email": "deployer@example.com"})),
+			subjectClaim:  "email",
+			wantSubject:   "deployer@example.com",
+		},
+		{
+			name:    "no authorization header",
+			wantErr: ErrNoCredentials,
+		},
+		{
+			name:          "basic auth",
+			authorization: "Basic dXNlcjpwYXNz",
+			wantErr:       ErrNoCredentials,
+		},
+		{
+			name:          "missing subject",
+			authorization: "Bearer " + keys.sign(t, "RS256", "rsa", withClaims(map[string]any{"sub": nil})),
+			wantErrText:   `invalid bearer token: missing "sub" claim`,
+		},
+		{
+			name:          "invalid token",
+			authorization: "Bearer " + keys.sign(t, "none", "rsa", validClaims()),
+			wantErrText:   "invalid bearer token: unsupported signing algorithm",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := keys.authenticator()
+			if test.subjectClaim != "" {
+				a.SubjectClaim = test.subjectClaim
+			}
+			r := httptest.NewRequest(http.MethodGet, "/roles", nil)
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			principal, err := a.Authenticate(r)
+			switch {
+			case test.wantErr != nil:
+				assert.ErrorIs(t, err, test.wantErr)
+			case test.wantErrText != "":
+				assert.ErrorContains(t, err, test.wantErrText)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, test.wantSubject, principal.Subject)
+				assert.Equal(t, "jwt", principal.Method)
+			}
+		})
+	}
+}
+
+func TestParseJwks(t *testing.T) {
+	keys := newTestJwtKeys(t)
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	raw := fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": %q, "e": %q},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": %q, "y": %q},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": %q, "e": %q}
+	]}`,
+		encode(keys.rsa.N.Bytes()), encode(big.NewInt(int64(keys.rsa.E)).Bytes()),
+		encode(keys.ec.X.Bytes()), encode(keys.ec.Y.Bytes()),
+		encode(keys.rsa.N.Bytes()), encode(big.NewInt(int64(keys.rsa.E)).Bytes()))
+
+	parsed, err := ParseJwks([]byte(raw))
+	require.NoError(t, err)
+	require.Len(t, parsed, 2, "encryption keys are ignored")
+	assert.True(t, keys.rsa.PublicKey.Equal(parsed["rsa"]))
+	assert.True(t, keys.ec.PublicKey.Equal(parsed["ec"]))
+
+	// Tokens verify against the parsed keys
+	a := &JwtAuthenticator{Keys: parsed}
+	_, err = a.Verify(keys.sign(t, "ES256", "ec", validClaims()))
+	assert.NoError(t, err)
+
+	_, err = ParseJwks([]byte(`{"keys": []}`))
+	assert.ErrorContains(t, err, "no signing keys found")
+	_, err = ParseJwks([]byte(`{"keys": [{"kty": "EC", "kid": "ec", "crv": "P-192"}]}`))
+	assert.ErrorContains(t, err, `key "ec" has unsupported curve "P-192"`)
+}
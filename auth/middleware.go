@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+)
+
+var (
+	// ErrNoCredentials is returned by an Authenticator when the request does not contain its type of credentials
+	ErrNoCredentials = errors.New("no credentials")
+)
+
+// Authenticator identifies the caller of a request
+// If the request does not carry credentials for this Authenticator, ErrNoCredentials is returned
+// so that the next Authenticator can be attempted
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Middleware authenticates every request using the first Authenticator that finds credentials
+// If policy is not nil, the authenticated Principal must also be authorized for the matched route
+func Middleware(authenticators []Authenticator, policy *Policy) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := authenticate(authenticators, r)
+			if err != nil {
+				log.Printf("%d %s %s: %s\n", http.StatusUnauthorized, r.Method, r.RequestURI, err)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			if policy != nil {
+				path := r.URL.Path
+				if route := mux.CurrentRoute(r); route != nil {
+					if tmpl, err := route.GetPathTemplate(); err == nil {
+						path = tmpl
+					}
+				}
+				if !policy.IsAllowed(principal, r.Method, path) {
+					log.Printf("%d %s %s: %q is not authorized\n", http.StatusForbidden, r.Method, r.RequestURI, principal.Subject)
+					http.Error(w, fmt.Sprintf("%q is not authorized to %s %s", principal.Subject, r.Method, path), http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+func authenticate(authenticators []Authenticator, r *http.Request) (*Principal, error) {
+	for _, authenticator := range authenticators {
+		principal, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return principal, nil
+	}
+	return nil, fmt.Errorf("authentication required")
+}
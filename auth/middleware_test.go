@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// headerAuthenticator authenticates requests with an X-Test-Subject header
+type headerAuthenticator struct{}
+
+func (headerAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	switch subject := r.Header.Get("X-Test-Subject"); subject {
+	case "":
+		return nil, ErrNoCredentials
+	case "invalid":
+		return nil, errors.New("invalid test credentials")
+	default:
+		return &Principal{Subject: subject, Method: "test"}, nil
+	}
+}
+
+func newTestRouter(policy *Policy) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(Middleware([]Authenticator{headerAuthenticator{}}, policy))
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if principal := PrincipalFromContext(r.Context()); principal != nil {
+			w.Write([]byte(principal.Subject))
+		}
+	}
+	router.HandleFunc("/roles/{name}", handler).Methods(http.MethodGet, http.MethodDelete)
+	router.HandleFunc("/databases/{name}", handler).Methods(http.MethodDelete)
+	return router
+}
+
+func TestMiddleware(t *testing.T) {
+	policy := &Policy{Rules: []Rule{
+		{Principals: []string{"deployer"}, Methods: []string{"*"}, Paths: []string{"*"}, Effect: EffectAllow},
+		{Principals: []string{"deployer"}, Methods: []string{"DELETE"}, Paths: []string{"/databases/{name}"}, Effect: EffectDeny},
+		{Principals: []string{"auditor"}, Methods: []string{"GET"}, Paths: []string{"/roles/{name}"}, Effect: EffectAllow},
+	}}
+
+	tests := []struct {
+		name       string
+		policy     *Policy
+		method     string
+		path       string
+		subject    string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "no credentials", policy: policy, method: http.MethodGet, path: "/roles/app", wantStatus: http.StatusUnauthorized, wantBody: "authentication required"},
+		{name: "invalid credentials", policy: policy, method: http.MethodGet, path: "/roles/app", subject: "invalid", wantStatus: http.StatusUnauthorized, wantBody: "invalid test credentials"},
+		{name: "allowed by route template", policy: policy, method: http.MethodGet, path: "/roles/app", subject: "auditor", wantStatus: http.StatusOK, wantBody: "auditor"},
+		{name: "method denied", policy: policy, method: http.MethodDelete, path: "/roles/app", subject: "auditor", wantStatus: http.StatusForbidden, wantBody: `"auditor" is not authorized to DELETE /roles/{name}`},
+		{name: "deny rule", policy: policy, method: http.MethodDelete, path: "/databases/app", subject: "deployer", wantStatus: http.StatusForbidden, wantBody: `"deployer" is not authorized to DELETE /databases/{name}`},
+		{name: "no policy allows authenticated principals", method: http.MethodDelete, path: "/databases/app", subject: "auditor", wantStatus: http.StatusOK, wantBody: "auditor"},
+		{name: "no policy still requires authentication", method: http.MethodDelete, path: "/databases/app", wantStatus: http.StatusUnauthorized, wantBody: "authentication required"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.path, nil)
+			if test.subject != "" {
+				r.Header.Set("X-Test-Subject", test.subject)
+			}
+			w := httptest.NewRecorder()
+			newTestRouter(test.policy).ServeHTTP(w, r)
+
+			assert.Equal(t, test.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), test.wantBody)
+			if test.wantStatus == http.StatusUnauthorized {
+				assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestMiddleware_AuthenticatorOrder(t *testing.T) {
+	hmac := &HmacAuthenticator{Keys: map[string]string{"deployer": "secret"}}
+	router := mux.NewRouter()
+	router.Use(Middleware([]Authenticator{hmac, headerAuthenticator{}}, nil))
+	router.HandleFunc("/roles/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(PrincipalFromContext(r.Context()).Method))
+	})
+
+	// The first authenticator has no credentials, so the next one is attempted
+	r := httptest.NewRequest(http.MethodGet, "/roles/app", nil)
+	r.Header.Set("X-Test-Subject", "deployer")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "test", w.Body.String())
+
+	// Invalid credentials are rejected even if a later authenticator would accept the request
+	r.Header.Set(HmacKeyIdHeader, "unknown")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), `unknown hmac key id "unknown"`)
+}
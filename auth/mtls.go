@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"net/http"
+)
+
+var _ Authenticator = ClientCertAuthenticator{}
+
+// ClientCertAuthenticator identifies the caller from a TLS client certificate
+// Certificate verification is performed by the TLS server (see tls.Config.ClientCAs)
+// This only accepts requests with a verified certificate chain
+type ClientCertAuthenticator struct{}
+
+func (ClientCertAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	claims := map[string]any{
+		"serialNumber": cert.SerialNumber.String(),
+		"issuer":       cert.Issuer.String(),
+	}
+	if len(cert.DNSNames) > 0 {
+		claims["dnsNames"] = cert.DNSNames
+	}
+	uris := make([]string, 0)
+	for _, uri := range cert.URIs {
+		uris = append(uris, uri.String())
+	}
+	if len(uris) > 0 {
+		claims["uris"] = uris
+	}
+
+	subject := cert.Subject.CommonName
+	if subject == "" && len(uris) > 0 {
+		// SPIFFE-style certificates identify the workload with a URI SAN instead of a common name
+		subject = uris[0]
+	}
+	return &Principal{Subject: subject, Method: "mtls", Claims: claims}, nil
+}
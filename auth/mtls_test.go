@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestClientCertAuthenticator(t *testing.T) {
+	spiffeId, _ := url.Parse("spiffe://example.com/ns/ops/sa/deployer")
+	issuer := pkix.Name{CommonName: "ops-ca"}
+
+	tests := []struct {
+		name        string
+		tls         *tls.ConnectionState
+		wantSubject string
+		wantClaims  map[string]any
+		wantErr     error
+	}{
+		{
+			name:    "plain http",
+			wantErr: ErrNoCredentials,
+		},
+		{
+			name: "unverified client certificate",
+			tls: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+				{Subject: pkix.Name{CommonName: "deployer"}, SerialNumber: big.NewInt(1)},
+			}},
+			wantErr: ErrNoCredentials,
+		},
+		{
+			name: "common name",
+			tls: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+				{Subject: pkix.Name{CommonName: "deployer"}, Issuer: issuer, SerialNumber: big.NewInt(42), DNSNames: []string{"deployer.example.com"}},
+			}}},
+			wantSubject: "deployer",
+			wantClaims: map[string]any{
+				"serialNumber": "42",
+				"issuer":       "CN=ops-ca",
+				"dnsNames":     []string{"deployer.example.com"},
+			},
+		},
+		{
+			name: "uri san",
+			tls: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+				{Issuer: issuer, SerialNumber: big.NewInt(7), URIs: []*url.URL{spiffeId}},
+			}}},
+			wantSubject: "spiffe://example.com/ns/ops/sa/deployer",
+			wantClaims: map[string]any{
+				"serialNumber": "7",
+				"issuer":       "CN=ops-ca",
+				"uris":         []string{"spiffe://example.com/ns/ops/sa/deployer"},
+			},
+		},
+		{
+			name: "common name takes precedence over uri san",
+			tls: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+				{Subject: pkix.Name{CommonName: "deployer"}, Issuer: issuer, SerialNumber: big.NewInt(7), URIs: []*url.URL{spiffeId}},
+			}}},
+			wantSubject: "deployer",
+			wantClaims: map[string]any{
+				"serialNumber": "7",
+				"issuer":       "CN=ops-ca",
+				"uris":         []string{"spiffe://example.com/ns/ops/sa/deployer"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/roles", nil)
+			r.TLS = test.tls
+			principal, err := ClientCertAuthenticator{}.Authenticate(r)
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, &Principal{Subject: test.wantSubject, Method: "mtls", Claims: test.wantClaims}, principal)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Policy authorizes principals to invoke routes
+// A request is allowed if at least one allow Rule matches and no deny Rule matches
+//
+// Example: allow `deployer` to create roles, but not drop databases
+//
+//	{"rules": [
+//	  {"principals": ["deployer"], "methods": ["*"], "paths": ["*"], "effect": "allow"},
+//	  {"principals": ["deployer"], "methods": ["DELETE"], "paths": ["/databases/{name}"], "effect": "deny"}
+//	]}
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+type Rule struct {
+	// Principals contains subjects that this rule applies to; "*" matches every principal
+	Principals []string `json:"principals"`
+	// Methods contains http methods that this rule applies to; "*" matches every method
+	Methods []string `json:"methods"`
+	// Paths contains route path templates (e.g. `/roles/{name}`) that this rule applies to
+	// A path ending in "*" matches any route with that prefix; "*" matches every route
+	Paths []string `json:"paths"`
+	// Effect is either allow or deny
+	Effect string `json:"effect"`
+}
+
+func LoadPolicyFile(policyFile string) (*Policy, error) {
+	raw, err := os.ReadFile(policyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy file %q: %w", policyFile, err)
+	}
+	var policy Policy
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		return nil, fmt.Errorf("invalid policy file %q: %w", policyFile, err)
+	}
+	for i, rule := range policy.Rules {
+		if rule.Effect != EffectAllow && rule.Effect != EffectDeny {
+			return nil, fmt.Errorf("invalid policy file %q: rule %d has invalid effect %q", policyFile, i, rule.Effect)
+		}
+	}
+	return &policy, nil
+}
+
+// IsAllowed determines whether principal may invoke the route identified by method and path
+func (p *Policy) IsAllowed(principal *Principal, method, path string) bool {
+	allowed := false
+	for _, rule := range p.Rules {
+		if !rule.matches(principal, method, path) {
+			continue
+		}
+		if rule.Effect == EffectDeny {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+func (r Rule) matches(principal *Principal, method, path string) bool {
+	return matchesAny(r.Principals, func(s string) bool { return s == "*" || (principal != nil && s == principal.Subject) }) &&
+		matchesAny(r.Methods, func(s string) bool { return s == "*" || strings.EqualFold(s, method) }) &&
+		matchesAny(r.Paths, func(s string) bool {
+			if prefix, ok := strings.CutSuffix(s, "*"); ok {
+				return strings.HasPrefix(path, prefix)
+			}
+			return s == path
+		})
+}
+
+func matchesAny(patterns []string, fn func(s string) bool) bool {
+	for _, pattern := range patterns {
+		if fn(pattern) {
+			return true
+		}
+	}
+	return false
+}
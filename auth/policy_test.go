@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicy_IsAllowed(t *testing.T) {
+	policy := &Policy{Rules: []Rule{
+		{Principals: []string{"deployer"}, Methods: []string{"*"}, Paths: []string{"*"}, Effect: EffectAllow},
+		{Principals: []string{"deployer"}, Methods: []string{"DELETE"}, Paths: []string{"/databases/{name}"}, Effect: EffectDeny},
+		{Principals: []string{"auditor"}, Methods: []string{"get"}, Paths: []string{"/roles/*", "/access_review"}, Effect: EffectAllow},
+		{Principals: []string{"*"}, Methods: []string{"GET"}, Paths: []string{"/health"}, Effect: EffectAllow},
+		{Principals: []string{"*"}, Methods: []string{"*"}, Paths: []string{"/credentials*"}, Effect: EffectDeny},
+	}}
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		method    string
+		path      string
+		want      bool
+	}{
+		{name: "wildcard allow", principal: &Principal{Subject: "deployer"}, method: http.MethodPost, path: "/roles", want: true},
+		{name: "deny wins over allow", principal: &Principal{Subject: "deployer"}, method: http.MethodDelete, path: "/databases/{name}", want: false},
+		{name: "deny only matches its method", principal: &Principal{Subject: "deployer"}, method: http.MethodPut, path: "/databases/{name}", want: true},
+		{name: "deny prefix matches every principal", principal: &Principal{Subject: "deployer"}, method: http.MethodPost, path: "/credentials/{name}", want: false},
+		{name: "prefix path", principal: &Principal{Subject: "auditor"}, method: http.MethodGet, path: "/roles/{name}/effective-privileges", want: true},
+		{name: "prefix does not match the bare path", principal: &Principal{Subject: "auditor"}, method: http.MethodGet, path: "/roles", want: false},
+		{name: "methods are case-insensitive", principal: &Principal{Subject: "auditor"}, method: http.MethodGet, path: "/access_review", want: true},
+		{name: "method not allowed", principal: &Principal{Subject: "auditor"}, method: http.MethodPut, path: "/roles/{name}", want: false},
+		{name: "exact path does not match a concrete path", principal: &Principal{Subject: "auditor"}, method: http.MethodGet, path: "/access_review/extra", want: false},
+		{name: "wildcard principal", principal: &Principal{Subject: "anyone"}, method: http.MethodGet, path: "/health", want: true},
+		{name: "no matching rule", principal: &Principal{Subject: "anyone"}, method: http.MethodGet, path: "/roles", want: false},
+		{name: "nil principal only matches wildcards", principal: nil, method: http.MethodGet, path: "/health", want: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, policy.IsAllowed(test.principal, test.method, test.path))
+		})
+	}
+
+	assert.False(t, (&Policy{}).IsAllowed(&Principal{Subject: "deployer"}, http.MethodGet, "/roles"), "an empty policy denies everything")
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+
+	policy, err := LoadPolicyFile(write("valid.json", `{"rules": [
+		{"principals": ["deployer"], "methods": ["*"], "paths": ["*"], "effect": "allow"},
+		{"principals": ["deployer"], "methods": ["DELETE"], "paths": ["/databases/{name}"], "effect": "deny"}
+	]}`))
+	require.NoError(t, err)
+	assert.Equal(t, &Policy{Rules: []Rule{
+		{Principals: []string{"deployer"}, Methods: []string{"*"}, Paths: []string{"*"}, Effect: EffectAllow},
+		{Principals: []string{"deployer"}, Methods: []string{"DELETE"}, Paths: []string{"/databases/{name}"}, Effect: EffectDeny},
+	}}, policy)
+
+	_, err = LoadPolicyFile(write("effect.json", `{"rules": [{"principals": ["*"], "methods": ["*"], "paths": ["*"], "effect": "permit"}]}`))
+	assert.ErrorContains(t, err, `rule 0 has invalid effect "permit"`)
+	_, err = LoadPolicyFile(write("invalid.json", `{"rules": `))
+	assert.ErrorContains(t, err, "invalid policy file")
+	_, err = LoadPolicyFile(filepath.Join(dir, "missing.json"))
+	assert.ErrorContains(t, err, "error reading policy file")
+}
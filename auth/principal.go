@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"context"
+)
+
+// Principal identifies the caller of a request
+type Principal struct {
+	// Subject is the unique name of the caller (e.g. the `sub` claim, hmac key id, or client certificate common name)
+	Subject string `json:"subject"`
+	// Method is the authentication method that identified the caller (jwt, hmac, mtls)
+	Method string `json:"method"`
+	// Claims contains additional attributes about the caller (e.g. jwt claims)
+	Claims map[string]any `json:"claims,omitempty"`
+}
+
+type principalContextKey struct{}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// PrincipalFromContext retrieves the authenticated caller
+// This returns nil if the request was not authenticated by this package
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalContextKey{}).(*Principal)
+	return principal
+}
@@ -3,15 +3,22 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/nullstone-io/go-lambda-api-sdk/function_url"
 	"github.com/nullstone-modules/pg-db-admin/api"
-	"github.com/nullstone-modules/pg-db-admin/aws/secrets"
+	"github.com/nullstone-modules/pg-db-admin/audit"
+	"github.com/nullstone-modules/pg-db-admin/auth"
 	crud_invoke "github.com/nullstone-modules/pg-db-admin/crud-invoke"
 	"github.com/nullstone-modules/pg-db-admin/legacy"
+	"github.com/nullstone-modules/pg-db-admin/manifest"
 	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/nullstone-modules/pg-db-admin/rdsiam"
+	"github.com/nullstone-modules/pg-db-admin/review"
+	"github.com/nullstone-modules/pg-db-admin/secrets"
 	"github.com/nullstone-modules/pg-db-admin/setup"
+	"github.com/nullstone-modules/pg-db-admin/sweeper"
 	"log"
 	"os"
 	"time"
@@ -22,59 +29,163 @@ const (
 	dbSetupConnUrlSecretIdEnvVar = "DB_SETUP_CONN_URL_SECRET_ID"
 	// adminConnUrlSecretIdEnvVar is a secret id containing a connection url for performing db admin operations
 	dbAdminConnUrlSecretIdEnvVar = "DB_ADMIN_CONN_URL_SECRET_ID"
+	// dbAdminIamAuthEnvVar authenticates the admin role with RDS IAM auth tokens instead of the password in the admin secret
+	dbAdminIamAuthEnvVar = "DB_ADMIN_IAM_AUTH"
 )
 
 func main() {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
+	// By default, secrets are stored in AWS Secrets Manager
+	// SECRET_STORE_BACKEND can override this (e.g. `file` for local testing)
+	secretStore, err := secrets.NewFromEnv(secrets.BackendAws)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
 
-	var dbSetupConnUrl string
+	// Connection urls are resolved lazily on first use
+	// If the secret is empty at cold start (e.g. before setup runs) or the credentials are rotated,
+	//   the store will retrieve the secret again instead of using stale credentials
+	setupStore := postgresql.NewStore("")
 	if setupConnUrlSecretId := os.Getenv(dbSetupConnUrlSecretIdEnvVar); setupConnUrlSecretId == "" {
 		log.Println("Skipping setup connection url secret")
 	} else {
-		log.Printf("Retrieving setup connection url secret (%s)\n", setupConnUrlSecretId)
-		var err error
-		dbSetupConnUrl, err = secrets.GetString(ctx, setupConnUrlSecretId)
-		if err != nil {
-			log.Println(err.Error())
-		}
+		setupStore = postgresql.NewLazyStore(secretConnUrlResolver(secretStore, "setup", setupConnUrlSecretId))
 	}
+	// Setup creates the admin role, which the protection policy refuses to manage through any other path
+	setupStore.Policy = nil
+	if setupStore.PasswordPolicy, err = postgresql.PasswordPolicyFromEnv(); err != nil {
+		log.Fatalln(err.Error())
+	}
+	defer setupStore.Close()
 	adminConnUrlSecretId := os.Getenv(dbAdminConnUrlSecretIdEnvVar)
-	log.Printf("Retrieving admin connection url secret (%s)\n", adminConnUrlSecretId)
-	dbAdminConnUrl, err := secrets.GetString(ctx, adminConnUrlSecretId)
+	adminStore := postgresql.NewLazyStore(secretConnUrlResolver(secretStore, "admin", adminConnUrlSecretId))
+	if adminStore.Policy, err = postgresql.PolicyFromEnv(); err != nil {
+		log.Fatalln(err.Error())
+	}
+	if adminStore.PasswordPolicy, err = postgresql.PasswordPolicyFromEnv(); err != nil {
+		log.Fatalln(err.Error())
+	}
+	if adminStore.Credentials.Templates, err = postgresql.LeaseTemplatesFromEnv(); err != nil {
+		log.Fatalln(err.Error())
+	}
+	if os.Getenv(dbAdminIamAuthEnvVar) == "true" {
+		// The admin secret still provides the host and username of the admin role
+		log.Println("Using RDS IAM authentication for admin role")
+		adminStore.AuthToken = &rdsiam.TokenProvider{}
+	}
+	defer adminStore.Close()
+
+	auditor, err := audit.NewFromEnv(adminStore)
 	if err != nil {
-		log.Println(err.Error())
+		log.Fatalln(err.Error())
 	}
 
-	setupStore := postgresql.NewStore(dbSetupConnUrl)
-	defer setupStore.Close()
-	adminStore := postgresql.NewStore(dbAdminConnUrl)
-	defer adminStore.Close()
+	lambda.Start(HandleRequest(secretStore, setupStore, adminStore, auditor))
+}
 
-	lambda.Start(HandleRequest(setupStore, adminStore))
+func secretConnUrlResolver(secretStore secrets.SecretStore, name, secretId string) postgresql.ConnUrlResolver {
+	return func(ctx context.Context) (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		log.Printf("Retrieving %s connection url secret (%s)\n", name, secretId)
+		return secretStore.Get(ctx, secretId)
+	}
 }
 
-func HandleRequest(setupStore, adminStore *postgresql.Store) func(ctx context.Context, rawEvent json.RawMessage) (any, error) {
+// HandleRequest routes each type of event to its handler
+// Events that change state are written to the audit log; lambda invocations are identified by the `lambda` caller method
+func HandleRequest(secretStore secrets.SecretStore, setupStore, adminStore *postgresql.Store, auditor *audit.Auditor) func(ctx context.Context, rawEvent json.RawMessage) (any, error) {
+	invoker := audit.Caller{Method: "lambda"}
 	return func(ctx context.Context, rawEvent json.RawMessage) (any, error) {
 		if ok, event := setup.IsEvent(rawEvent); ok {
 			log.Println("Initial Setup Event")
-			return setup.Handle(ctx, event, setupStore, os.Getenv(dbAdminConnUrlSecretIdEnvVar))
+			entry := audit.Entry{Caller: invoker, Source: "setup", Type: "setup", Action: "setup"}
+			if event.Rotate {
+				entry.Action = "rotate"
+			}
+			result, err := auditor.Run(ctx, entry, setupStore, func(store *postgresql.Store) (any, error) {
+				return setup.Handle(ctx, event, store, secretStore, os.Getenv(dbAdminConnUrlSecretIdEnvVar))
+			})
+			if err == nil {
+				// Setup may have written new admin credentials, force the admin store to retrieve them
+				adminStore.Invalidate()
+				// Metadata tables are created by the admin role so that it owns them
+				if err = adminStore.EnsureMetadataTables(); err != nil {
+					err = fmt.Errorf("error creating metadata tables: %w", err)
+				}
+			}
+			return result, err
+		}
+		if ok, _ := setup.IsDiagnoseEvent(rawEvent); ok {
+			log.Println("Diagnose Event")
+			return setup.Diagnose(ctx, setupStore, adminStore, secretStore, os.Getenv(dbAdminConnUrlSecretIdEnvVar))
 		}
 		if ok, event := crud_invoke.IsEvent(rawEvent); ok {
 			log.Println("Invocation (CRUD) Event", event.Tf.Action, event.Type)
-			return crud_invoke.Handle(ctx, event, adminStore)
+			if event.Tf.Action == "plan" {
+				return crud_invoke.Handle(ctx, event, adminStore)
+			}
+			entry := audit.Entry{
+				Caller: invoker,
+				Source: "crud-invoke",
+				Type:   event.Type,
+				Key:    crud_invoke.EventKey(adminStore, event),
+				Action: event.Tf.Action,
+			}
+			if event.Caller != "" {
+				entry.Caller = audit.Caller{Subject: event.Caller, Method: "payload"}
+			}
+			return auditor.Run(ctx, entry, adminStore, func(store *postgresql.Store) (any, error) {
+				return crud_invoke.Handle(ctx, event, store)
+			})
+		}
+
+		if ok, event := manifest.IsEvent(rawEvent); ok {
+			log.Println("Apply Manifest Event")
+			if event.DryRun {
+				return manifest.Handle(ctx, event, adminStore)
+			}
+			entry := audit.Entry{Caller: invoker, Source: "manifest", Type: "manifest", Action: "apply"}
+			return auditor.Run(ctx, entry, adminStore, func(store *postgresql.Store) (any, error) {
+				return manifest.Handle(ctx, event, store)
+			})
+		}
+		if ok, event := manifest.IsDriftEvent(rawEvent); ok {
+			log.Println("Drift Check Event")
+			return manifest.HandleDrift(ctx, event, adminStore)
+		}
+		if ok, event := manifest.IsExportEvent(rawEvent); ok {
+			log.Println("Export Event")
+			return manifest.HandleExport(ctx, event, adminStore)
+		}
+		if ok, event := review.IsEvent(rawEvent); ok {
+			log.Println("Access Review Event")
+			return review.Handle(ctx, event, adminStore)
+		}
+		if ok, event := sweeper.IsEvent(rawEvent); ok {
+			log.Println("Sweep Event")
+			entry := audit.Entry{Caller: invoker, Source: "sweeper", Type: "sweep", Action: "sweep"}
+			return auditor.Run(ctx, entry, adminStore, func(store *postgresql.Store) (any, error) {
+				return sweeper.Handle(ctx, event, store)
+			})
 		}
 
 		if ok, event := isFunctionUrlEvent(rawEvent); ok {
-			router := api.CreateRouter(adminStore)
+			router := api.CreateRouter(adminStore, api.AuditMiddleware(auditor, adminStore))
 			log.Println("Function URL Event", event.RequestContext.HTTP.Method, event.RequestContext.HTTP.Path)
+			// The function url uses AWS_IAM authorization, the IAM caller is recorded in the audit log
+			if iam := event.RequestContext.Authorizer; iam != nil && iam.IAM != nil {
+				ctx = auth.WithPrincipal(ctx, &auth.Principal{Subject: iam.IAM.UserARN, Method: "iam"})
+			}
 			res, err := function_url.Handle(ctx, event, router)
 			log.Println("Function URL Response", res.StatusCode)
 			return res, err
 		}
 		if ok, event := legacy.IsEvent(rawEvent); ok {
 			log.Println("Legacy Event", event.Type)
-			return legacy.Handle(ctx, event, adminStore)
+			entry := audit.Entry{Caller: invoker, Source: "legacy", Type: event.Type, Key: event.Key(), Action: "create"}
+			return auditor.Run(ctx, entry, adminStore, func(store *postgresql.Store) (any, error) {
+				return legacy.Handle(ctx, event, store)
+			})
 		}
 		log.Println("Unknown Event", string(rawEvent))
 		return nil, nil
@@ -0,0 +1,29 @@
+resource "aws_cloudwatch_event_rule" "drift_check" {
+  count = var.drift_check.enabled ? 1 : 0
+
+  name                = "${var.name}-drift-check"
+  description         = "Scheduled drift check for ${var.name}"
+  schedule_expression = var.drift_check.schedule
+  tags                = var.tags
+}
+
+resource "aws_cloudwatch_event_target" "drift_check" {
+  count = var.drift_check.enabled ? 1 : 0
+
+  rule = aws_cloudwatch_event_rule.drift_check[0].name
+  arn  = aws_lambda_function.db_admin.arn
+  input = jsonencode({
+    driftCheck  = jsondecode(var.drift_check.manifest)
+    failOnDrift = true
+  })
+}
+
+resource "aws_lambda_permission" "drift_check" {
+  count = var.drift_check.enabled ? 1 : 0
+
+  statement_id_prefix = "AllowDriftCheck"
+  function_name       = aws_lambda_function.db_admin.function_name
+  action              = "lambda:InvokeFunction"
+  principal           = "events.amazonaws.com"
+  source_arn          = aws_cloudwatch_event_rule.drift_check[0].arn
+}
@@ -12,6 +12,11 @@ resource "aws_lambda_function" "db_admin" {
   environment {
     variables = {
       DB_ADMIN_CONN_URL_SECRET_ID = aws_secretsmanager_secret.admin_role_conn_url.id
+      AUDIT_SINKS                 = join(",", var.audit.sinks)
+      AUDIT_WEBHOOK_URL           = var.audit.webhook_url
+      PASSWORD_POLICY             = var.password_policy == null ? "" : jsonencode(var.password_policy)
+      LEASE_TEMPLATES             = jsonencode(var.lease_templates)
+      DB_ADMIN_IAM_AUTH           = tostring(var.iam_auth)
 
       // RESET_FUNCTION does 2 things:
       // 1. Waits for lambda invocation of initial setup
@@ -31,6 +31,9 @@ resource "aws_iam_role_policy" "db_admin" {
   policy = data.aws_iam_policy_document.db_admin.json
 }
 
+data "aws_region" "this" {}
+data "aws_caller_identity" "this" {}
+
 data "aws_iam_policy_document" "db_admin" {
   statement {
     sid = "AllowDbAccess"
@@ -44,6 +47,17 @@ data "aws_iam_policy_document" "db_admin" {
     ]
   }
 
+  dynamic "statement" {
+    for_each = var.iam_auth ? [1] : []
+
+    content {
+      sid       = "AllowIamDbAuth"
+      effect    = "Allow"
+      resources = ["arn:aws:rds-db:${data.aws_region.this.name}:${data.aws_caller_identity.this.account_id}:dbuser:*/nullstone_admin_role_*"]
+      actions   = ["rds-db:connect"]
+    }
+  }
+
   statement {
     sid       = "AllowDbSetup"
     effect    = "Allow"
@@ -42,7 +42,7 @@ resource "time_sleep" "wait_for_db" {
 
 resource "aws_lambda_invocation" "db_admin_setup" {
   function_name = aws_lambda_function.db_admin_setup.function_name
-  input         = jsonencode({ setup : true })
+  input         = jsonencode({ setup : true, iam : var.iam_auth })
 
   depends_on = [time_sleep.wait_for_db]
 }
@@ -0,0 +1,26 @@
+resource "aws_cloudwatch_event_rule" "sweeper" {
+  count = var.sweeper.enabled ? 1 : 0
+
+  name                = "${var.name}-sweeper"
+  description         = "Scheduled removal of expired temporary access for ${var.name}"
+  schedule_expression = var.sweeper.schedule
+  tags                = var.tags
+}
+
+resource "aws_cloudwatch_event_target" "sweeper" {
+  count = var.sweeper.enabled ? 1 : 0
+
+  rule  = aws_cloudwatch_event_rule.sweeper[0].name
+  arn   = aws_lambda_function.db_admin.arn
+  input = jsonencode({ sweep = true })
+}
+
+resource "aws_lambda_permission" "sweeper" {
+  count = var.sweeper.enabled ? 1 : 0
+
+  statement_id_prefix = "AllowSweeper"
+  function_name       = aws_lambda_function.db_admin.function_name
+  action              = "lambda:InvokeFunction"
+  principal           = "events.amazonaws.com"
+  source_arn          = aws_cloudwatch_event_rule.sweeper[0].arn
+}
@@ -82,3 +82,95 @@ EOF
     subnet_ids           = []
   }
 }
+
+variable "drift_check" {
+  description = <<EOF
+Configuration for a scheduled drift check of the db-admin lambda function.
+- enabled: Set to true to invoke the drift check on a schedule (default: false)
+- schedule: EventBridge schedule expression (default: rate(1 hour))
+- manifest: JSON manifest of the expected resources
+When drift is detected, the invocation fails so that it is reported by the error-rate alarm.
+EOF
+
+  type = object({
+    enabled  = optional(bool, false)
+    schedule = optional(string, "rate(1 hour)")
+    manifest = optional(string, "{}")
+  })
+
+  default = {}
+}
+
+variable "sweeper" {
+  description = <<EOF
+Configuration for the scheduled sweeper of the db-admin lambda function.
+The sweeper revokes expired JIT access and credential leases, terminates their sessions, and drops temporary roles.
+- enabled: Set to false to disable the sweeper (default: true)
+- schedule: EventBridge schedule expression (default: rate(5 minutes))
+EOF
+
+  type = object({
+    enabled  = optional(bool, true)
+    schedule = optional(string, "rate(5 minutes)")
+  })
+
+  default = {}
+}
+
+variable "lease_templates" {
+  description = <<EOF
+Template role of credential leases for each database (see LEASE_TEMPLATES in the README).
+Lease roles inherit the privileges of the template through membership; "*" applies to every other database.
+Databases without a template grant lease roles database access at the requested level instead.
+EOF
+  type        = map(string)
+  default     = {}
+}
+
+variable "audit" {
+  description = <<EOF
+Configuration for the audit log of administrative actions.
+- sinks: List of sinks that receive audit entries: stdout, table, webhook (default: ["stdout"])
+  stdout writes json lines to CloudWatch logs; table writes to pg_db_admin.audit_log in the admin database.
+- webhook_url: URL that receives each audit entry as json (required for the webhook sink)
+EOF
+
+  type = object({
+    sinks       = optional(list(string), ["stdout"])
+    webhook_url = optional(string, "")
+  })
+
+  default = {}
+}
+
+variable "password_policy" {
+  description = <<EOF
+Password policy that is enforced on role passwords (see PASSWORD_POLICY in the README).
+If null, passwords are not validated. Set to {} to enforce the defaults.
+Omitted fields keep their defaults: minLength = 12, rejectRoleName = true, and a denylist of common passwords.
+EOF
+
+  type = object({
+    disabled              = optional(bool)
+    minLength             = optional(number)
+    requireUppercase      = optional(bool)
+    requireLowercase      = optional(bool)
+    requireDigit          = optional(bool)
+    requireSymbol         = optional(bool)
+    rejectRoleName        = optional(bool)
+    denylist              = optional(list(string))
+    disableCommonDenylist = optional(bool)
+    requireScram          = optional(bool)
+  })
+
+  default = null
+}
+
+variable "iam_auth" {
+  description = <<EOF
+If true, the db-admin lambda authenticates as its admin role with RDS IAM auth tokens instead of a stored password.
+Setup grants rds_iam to the admin role; the RDS instance must have IAM database authentication enabled.
+EOF
+  type        = bool
+  default     = false
+}
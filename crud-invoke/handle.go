@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/nullstone-io/go-rest-api"
+	"github.com/nullstone-modules/pg-db-admin/apierror"
 	"github.com/nullstone-modules/pg-db-admin/postgresql"
 )
 
@@ -12,10 +13,20 @@ import (
 // When the resource has an attribute `lifecycle_scope = "CRUD"`,
 //   the payload will contain `tf` member with information about the action and previous input
 
+const (
+	actionCreate = "create"
+	actionUpdate = "update"
+	actionDelete = "delete"
+	actionPlan   = "plan"
+)
+
 type Event struct {
 	Type string          `json:"type"`
 	Data json.RawMessage `json:"data"`
 	Tf   EventTf         `json:"tf"`
+	// Caller optionally identifies who invoked the event (e.g. the ARN from `aws_caller_identity`)
+	// This is recorded in the audit log
+	Caller string `json:"caller"`
 }
 
 type EventTf struct {
@@ -31,13 +42,35 @@ func IsEvent(rawEvent json.RawMessage) (bool, Event) {
 	return event.Tf.Action != "", event
 }
 
+// Handle executes the CRUD event against store
+// Errors are returned as *apierror.Error so that the caller receives the same structured errors as the http api
+//
+// If the action is `plan`, the statements that would be executed are returned instead of executing them
+// A plan is created for `create` if there is no previous input; otherwise, it is created for `update`
 func Handle(ctx context.Context, event Event, store *postgresql.Store) (any, error) {
+	action := event.Tf.Action
+	var plan *postgresql.Plan
+	if action == actionPlan {
+		store, plan = store.DryRun()
+		action = actionCreate
+		if event.Tf.PrevInput != nil {
+			action = actionUpdate
+		}
+	}
+
 	crudHandler := CrudByName(store, event.Type)
 	if crudHandler == nil {
-		return nil, fmt.Errorf("unknown event 'type' %q", event.Type)
+		return nil, apierror.InvalidPayload(fmt.Errorf("unknown event 'type' %q", event.Type))
 	}
 
-	return crudHandler.Handle(event.Tf.Action, event.Data)
+	result, err := crudHandler.Handle(action, event.Data)
+	if err != nil {
+		return nil, apierror.New(err)
+	}
+	if plan != nil {
+		return plan, nil
+	}
+	return result, nil
 }
 
 func CrudByName(s *postgresql.Store, name string) CrudHandler {
@@ -48,17 +81,38 @@ func CrudByName(s *postgresql.Store, name string) CrudHandler {
 		return Crud[string, postgresql.Role]{DataAccess: s.Roles}
 	case "role_members":
 		return Crud[postgresql.RoleMemberKey, postgresql.RoleMember]{DataAccess: s.RoleMembers}
+	case "schemas":
+		return Crud[postgresql.SchemaKey, postgresql.Schema]{DataAccess: s.Schemas}
 	case "schema_privileges":
 		return Crud[postgresql.SchemaPrivilegeKey, postgresql.SchemaPrivilege]{DataAccess: s.SchemaPrivileges}
 	case "default_grants":
 		return Crud[postgresql.DefaultGrantKey, postgresql.DefaultGrant]{DataAccess: s.DefaultGrants}
+	case "database_access":
+		return Crud[postgresql.DatabaseAccessKey, postgresql.DatabaseAccess]{DataAccess: s.DatabaseAccess}
+	case "jit_access":
+		return Crud[string, postgresql.JitAccess]{DataAccess: s.JitAccess}
 	default:
 		return nil
 	}
 }
 
+// EventKey formats the key of the resource in event
+// If the event cannot be parsed, an empty string is returned
+func EventKey(s *postgresql.Store, event Event) string {
+	crudHandler := CrudByName(s, event.Type)
+	if crudHandler == nil {
+		return ""
+	}
+	key, err := crudHandler.Key(event.Data)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%+v", key)
+}
+
 type CrudHandler interface {
 	Handle(action string, raw json.RawMessage) (any, error)
+	Key(raw json.RawMessage) (any, error)
 }
 
 type Keyer[TKey any] interface {
@@ -72,17 +126,25 @@ type Crud[TKey any, T Keyer[TKey]] struct {
 func (h Crud[TKey, T]) Handle(action string, raw json.RawMessage) (any, error) {
 	var obj T
 	if err := json.Unmarshal(raw, &obj); err != nil {
-		return nil, fmt.Errorf("unable to parse input payload: %w", err)
+		return nil, apierror.InvalidPayload(fmt.Errorf("unable to parse input payload: %w", err))
 	}
 
 	switch action {
-	case "create":
+	case actionCreate:
 		return h.DataAccess.Create(obj)
-	case "update":
+	case actionUpdate:
 		return h.DataAccess.Update(obj.Key(), obj)
-	case "delete":
+	case actionDelete:
 		return h.DataAccess.Drop(obj.Key())
 	default:
-		return nil, fmt.Errorf("unknown event 'action' %q", action)
+		return nil, apierror.InvalidPayload(fmt.Errorf("unknown event 'action' %q", action))
+	}
+}
+
+func (h Crud[TKey, T]) Key(raw json.RawMessage) (any, error) {
+	var obj T
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
 	}
+	return obj.Key(), nil
 }
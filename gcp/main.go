@@ -10,21 +10,78 @@ package pg_db_admin
 // This entrypoint does not run code; it only registers a trigger that is used by the runtime upon execution
 
 import (
+	"context"
 	"fmt"
 	_ "github.com/GoogleCloudPlatform/functions-framework-go/funcframework"
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
 	"github.com/nullstone-modules/pg-db-admin/api"
+	"github.com/nullstone-modules/pg-db-admin/audit"
+	"github.com/nullstone-modules/pg-db-admin/auth"
 	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/nullstone-modules/pg-db-admin/secrets"
 	"os"
+	"time"
 )
 
 var (
 	dbConnUrlEnvVar = "DB_CONN_URL"
+	// dbConnUrlSecretIdEnvVar is a secret id containing the connection url
+	// If set, the connection url is retrieved from the secret store (GCP Secret Manager by default) instead of DB_CONN_URL
+	dbConnUrlSecretIdEnvVar = "DB_CONN_URL_SECRET_ID"
 )
 
 func init() {
 	fmt.Println("Initializing pg-db-admin...")
-	store := postgresql.NewStore(os.Getenv(dbConnUrlEnvVar))
-	router := api.CreateRouter(store)
+	store := postgresql.NewStore(loadConnUrl())
+	policy, err := postgresql.PolicyFromEnv()
+	if err != nil {
+		panic(err.Error())
+	}
+	store.Policy = policy
+	if store.PasswordPolicy, err = postgresql.PasswordPolicyFromEnv(); err != nil {
+		panic(err.Error())
+	}
+	if store.Credentials.Templates, err = postgresql.LeaseTemplatesFromEnv(); err != nil {
+		panic(err.Error())
+	}
+	// The function has no setup step, so metadata tables are created at startup
+	// If this fails, the access review reports that password changes are not tracked
+	if err := store.EnsureMetadataTables(); err != nil {
+		fmt.Printf("Unable to create metadata tables: %s\n", err)
+	}
+	// The function is protected by the cloud functions invoker role
+	// Additional authentication can be configured in code (see auth.MiddlewaresFromEnv)
+	middlewares, err := auth.MiddlewaresFromEnv()
+	if err != nil {
+		panic(fmt.Sprintf("error configuring authentication: %s", err))
+	}
+	auditor, err := audit.NewFromEnv(store)
+	if err != nil {
+		panic(fmt.Sprintf("error configuring audit log: %s", err))
+	}
+	// The audit middleware must run after authentication to identify the caller
+	middlewares = append(middlewares, api.AuditMiddleware(auditor, store))
+	router := api.CreateRouter(store, middlewares...)
 	functions.HTTP("pg-db-admin", router.ServeHTTP)
 }
+
+func loadConnUrl() string {
+	secretId := os.Getenv(dbConnUrlSecretIdEnvVar)
+	if secretId == "" {
+		return os.Getenv(dbConnUrlEnvVar)
+	}
+
+	secretStore, err := secrets.NewFromEnv(secrets.BackendGcp)
+	if err != nil {
+		fmt.Println(err.Error())
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	fmt.Printf("Retrieving connection url secret (%s)\n", secretId)
+	connUrl, err := secretStore.Get(ctx, secretId)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	return connUrl
+}
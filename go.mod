@@ -15,6 +15,7 @@ require (
 	github.com/nullstone-io/go-lambda-api-sdk v0.0.0-20220829133353-4a8c1d845640
 	github.com/nullstone-io/go-rest-api v0.0.0-20220913221656-e752d22f9894
 	github.com/stretchr/testify v1.8.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -36,5 +37,4 @@ require (
 	go.uber.org/atomic v1.4.0 // indirect
 	go.uber.org/multierr v1.1.0 // indirect
 	go.uber.org/zap v1.10.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
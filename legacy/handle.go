@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"strings"
 )
 
 const (
@@ -61,3 +62,15 @@ func Handle(ctx context.Context, event AdminEvent, store *postgresql.Store) (any
 		return nil, fmt.Errorf("unknown event %q", event.Type)
 	}
 }
+
+// Key formats the metadata that identifies the resource of the event (e.g. for the audit log)
+// The password is excluded
+func (e AdminEvent) Key() string {
+	parts := make([]string, 0)
+	for _, name := range []string{"databaseName", "username"} {
+		if value := e.Metadata[name]; value != "" {
+			parts = append(parts, name+"="+value)
+		}
+	}
+	return strings.Join(parts, ",")
+}
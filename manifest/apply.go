@@ -0,0 +1,266 @@
+package manifest
+
+import (
+	"fmt"
+	"github.com/nullstone-io/go-rest-api"
+	"github.com/nullstone-modules/pg-db-admin/apierror"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionNone   = "none"
+	// ActionImmutable indicates that the resource differs only in fields that cannot be changed after it is created
+	ActionImmutable = "immutable"
+	// ActionSkip indicates that the resource was not applied because a dependency failed
+	ActionSkip = "skip"
+)
+
+// Report contains the result of applying each resource in a manifest
+// Results are in the order the resources were applied
+type Report struct {
+	Results []Result `json:"results"`
+	// Failed is the number of resources that failed or were skipped
+	Failed int `json:"failed"`
+	// Plan contains the statements that would be executed if the manifest was applied with a dry-run store
+	Plan *postgresql.Plan `json:"plan,omitempty"`
+}
+
+type Result struct {
+	Type    string          `json:"type"`
+	Key     string          `json:"key"`
+	Action  string          `json:"action"`
+	Changes []Change        `json:"changes,omitempty"`
+	Error   *apierror.Error `json:"error,omitempty"`
+}
+
+// Change describes a field that differs between the live state and the manifest
+type Change struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+	// Immutable is true if the field can only be set when the resource is created, so the difference is never applied
+	Immutable bool `json:"immutable,omitempty"`
+}
+
+// reconcileFunc compares a resource against live state and applies the changes
+// If apply is false, the action that would be taken is returned without applying it
+type reconcileFunc func(store *postgresql.Store, apply bool) (string, []Change, error)
+
+// Apply reconciles store with the desired state in m
+// Resources are applied in dependency order; only resources that are missing or differ from live state are changed
+// If a resource fails, resources that depend on it are skipped
+//
+// An error is returned only if the manifest is invalid (e.g. duplicate resources, dependency cycles)
+// Failures of individual resources are reported in the Report
+func Apply(store *postgresql.Store, m *Manifest) (*Report, error) {
+	g, err := buildGraph(m)
+	if err != nil {
+		return nil, err
+	}
+	sorted, err := g.sort()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Results: make([]Result, 0, len(sorted))}
+	actions := map[string]string{}
+	for _, n := range sorted {
+		result := Result{Type: n.typ, Key: n.key}
+		if failed := failedDependency(n, actions); failed != "" {
+			result.Action = ActionSkip
+			result.Error = &apierror.Error{
+				Status:  http.StatusFailedDependency,
+				Code:    apierror.CodeDependencyFailed,
+				Message: fmt.Sprintf("dependency %q failed", failed),
+			}
+		} else {
+			// During a dry run, a database that is planned for creation does not exist yet
+			// Resources inside it cannot be introspected, so they are planned for creation without executing
+			if store.IsDryRun() && actions[nodeId(TypeDatabases, n.database)] == ActionCreate {
+				result.Action = ActionCreate
+			} else {
+				log.Printf("[Apply] Reconciling %s\n", n.id)
+				result.Action, result.Changes, err = n.reconcile(store, true)
+				if err != nil {
+					result.Error = apierror.New(err)
+				}
+			}
+		}
+		if result.Error != nil {
+			report.Failed++
+			actions[n.id] = ActionSkip
+		} else {
+			actions[n.id] = result.Action
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+// failedDependency returns the id of the first dependency of n that failed or was skipped
+func failedDependency(n *node, actions map[string]string) string {
+	for _, dep := range n.deps {
+		if actions[dep] == ActionSkip {
+			return dep
+		}
+	}
+	return ""
+}
+
+// reconcile creates desired if it does not exist or updates it if diff reports any changes
+// If apply is false, only the comparison is performed
+func reconcile[TKey any, T any](access rest.DataAccess[TKey, T], key TKey, desired T, apply bool, diff func(live, desired T) []Change) (string, []Change, error) {
+	live, err := access.Read(key)
+	if err != nil {
+		return ActionNone, nil, err
+	}
+	if live == nil {
+		if apply {
+			_, err = access.Create(desired)
+		}
+		return ActionCreate, nil, err
+	}
+	changes := diff(*live, desired)
+	if len(changes) == 0 {
+		return ActionNone, nil, nil
+	}
+	if !slices.ContainsFunc(changes, func(c Change) bool { return !c.Immutable }) {
+		return ActionImmutable, changes, nil
+	}
+	if apply {
+		_, err = access.Update(key, desired)
+	}
+	return ActionUpdate, changes, err
+}
+
+// noDiff is used for resources that are only compared by existence
+func noDiff[T any](live, desired T) []Change {
+	return nil
+}
+
+func databaseReconciler(obj postgresql.Database) reconcileFunc {
+	return func(store *postgresql.Store, apply bool) (string, []Change, error) {
+		return reconcile[string, postgresql.Database](store.Databases, obj.Key(), obj, apply, diffDatabase)
+	}
+}
+
+// roleReconciler compares attributes and memberships of the role
+// Passwords cannot be introspected, so the password of an existing role is not changed
+// If the role specifies memberOf, memberships that are not listed are revoked unless they are managed by other resources
+func roleReconciler(obj postgresql.Role, managed managedMemberships) reconcileFunc {
+	obj.SkipPasswordUpdate = true
+	obj.ExclusiveMemberOf = obj.MemberOf != nil
+	return func(store *postgresql.Store, apply bool) (string, []Change, error) {
+		desired := obj
+		if desired.ExclusiveMemberOf {
+			var err error
+			if desired.RetainMemberOf, err = managed.resolve(store); err != nil {
+				return ActionNone, nil, err
+			}
+		}
+		return reconcile[string, postgresql.Role](store.Roles, obj.Key(), desired, apply, func(live, desired postgresql.Role) []Change {
+			changes := make([]Change, 0)
+			diffAttribute := func(field string, from, to *bool) {
+				if to != nil && (from == nil || *from != *to) {
+					changes = append(changes, Change{Field: field, From: from, To: *to})
+				}
+			}
+			diffAttribute("attributes.createDb", live.Attributes.CreateDb, desired.Attributes.CreateDb)
+			diffAttribute("attributes.createRole", live.Attributes.CreateRole, desired.Attributes.CreateRole)
+			if live.Iam != desired.Iam {
+				changes = append(changes, Change{Field: "iam", From: live.Iam, To: desired.Iam})
+			}
+			for _, target := range desired.MemberOf {
+				if !slices.Contains(live.MemberOf, target) {
+					changes = append(changes, Change{Field: "memberOf", From: nil, To: target})
+				}
+			}
+			for _, target := range desired.UnlistedMemberOf(live.MemberOf) {
+				changes = append(changes, Change{Field: "memberOf", From: target, To: nil})
+			}
+			return changes
+		})
+	}
+}
+
+func roleMemberReconciler(obj postgresql.RoleMember) reconcileFunc {
+	return func(store *postgresql.Store, apply bool) (string, []Change, error) {
+		return reconcile[postgresql.RoleMemberKey, postgresql.RoleMember](store.RoleMembers, obj.Key(), obj, apply, func(live, desired postgresql.RoleMember) []Change {
+			// The admin option is only added, never revoked
+			if desired.WithAdminOption && !live.WithAdminOption {
+				return []Change{{Field: "withAdminOption", From: false, To: true}}
+			}
+			return nil
+		})
+	}
+}
+
+func schemaReconciler(obj postgresql.Schema) reconcileFunc {
+	return func(store *postgresql.Store, apply bool) (string, []Change, error) {
+		return reconcile[postgresql.SchemaKey, postgresql.Schema](store.Schemas, obj.Key(), obj, apply, func(live, desired postgresql.Schema) []Change {
+			if desired.Owner != "" && desired.Owner != live.Owner {
+				return []Change{{Field: "owner", From: live.Owner, To: desired.Owner}}
+			}
+			return nil
+		})
+	}
+}
+
+func schemaPrivilegeReconciler(obj postgresql.SchemaPrivilege) reconcileFunc {
+	return func(store *postgresql.Store, apply bool) (string, []Change, error) {
+		return reconcile[postgresql.SchemaPrivilegeKey, postgresql.SchemaPrivilege](store.SchemaPrivileges, obj.Key(), obj, apply, noDiff[postgresql.SchemaPrivilege])
+	}
+}
+
+func defaultGrantReconciler(obj postgresql.DefaultGrant) reconcileFunc {
+	return func(store *postgresql.Store, apply bool) (string, []Change, error) {
+		return reconcile[postgresql.DefaultGrantKey, postgresql.DefaultGrant](store.DefaultGrants, obj.Key(), obj, apply, noDiff[postgresql.DefaultGrant])
+	}
+}
+
+func databaseAccessReconciler(obj postgresql.DatabaseAccess) reconcileFunc {
+	return func(store *postgresql.Store, apply bool) (string, []Change, error) {
+		return reconcile[postgresql.DatabaseAccessKey, postgresql.DatabaseAccess](store.DatabaseAccess, obj.Key(), obj, apply, func(live, desired postgresql.DatabaseAccess) []Change {
+			if desired.Level == "" {
+				desired.Level = postgresql.AccessOwner
+			}
+			if live.Level != desired.Level {
+				return []Change{{Field: "level", From: live.Level, To: desired.Level}}
+			}
+			return nil
+		})
+	}
+}
+
+// diffDatabase compares the attributes that are set in desired
+// Encoding, collation, and lcCtype can only be set when a database is created, so their differences are marked immutable
+func diffDatabase(live, desired postgresql.Database) []Change {
+	changes := make([]Change, 0)
+	diffString := func(field, from, to string, immutable bool) {
+		if to != "" && !strings.EqualFold(to, "DEFAULT") && from != to {
+			changes = append(changes, Change{Field: field, From: from, To: to, Immutable: immutable})
+		}
+	}
+	diffString("owner", live.Owner, desired.Owner, false)
+	diffString("encoding", live.Encoding, desired.Encoding, true)
+	diffString("collation", live.Collation, desired.Collation, true)
+	diffString("lcCtype", live.LcCtype, desired.LcCtype, true)
+	diffString("tablespaceName", live.TablespaceName, desired.TablespaceName, false)
+	// postgres uses -1 (read as 0) to indicate no connection limit
+	if to := desired.ConnectionLimit; to != nil && max(*to, 0) != *live.ConnectionLimit {
+		changes = append(changes, Change{Field: "connectionLimit", From: *live.ConnectionLimit, To: max(*to, 0)})
+	}
+	if to := desired.IsTemplate; to != nil && *to != *live.IsTemplate {
+		changes = append(changes, Change{Field: "isTemplate", From: *live.IsTemplate, To: *to})
+	}
+	if to := desired.DisableConnections; to != nil && *to != *live.DisableConnections {
+		changes = append(changes, Change{Field: "disableConnections", From: *live.DisableConnections, To: *to})
+	}
+	return changes
+}
@@ -0,0 +1,106 @@
+package manifest
+
+import (
+	"fmt"
+	"github.com/nullstone-modules/pg-db-admin/apierror"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"log"
+	"net/http"
+)
+
+const (
+	DriftInSync  = "in_sync"
+	DriftChanged = "drifted"
+	DriftMissing = "missing"
+	// DriftImmutable indicates that the resource differs only in fields that cannot be changed (e.g. database encoding)
+	// These differences cannot be fixed by applying the manifest, so they do not count as drift
+	DriftImmutable = "immutable"
+	DriftError     = "error"
+)
+
+// DriftReport contains the comparison of each resource in a manifest against live state
+type DriftReport struct {
+	Results []DriftResult `json:"results"`
+	// Drifted is the number of resources that are missing or differ from live state
+	Drifted int `json:"drifted"`
+	// Errors is the number of resources that could not be introspected
+	Errors int `json:"errors"`
+	// Immutable is the number of resources that differ only in fields that cannot be changed
+	Immutable int `json:"immutable"`
+}
+
+type DriftResult struct {
+	Type   string `json:"type"`
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	// Changes lists each field that differs; From is the live value, To is the expected value
+	Changes []Change        `json:"changes,omitempty"`
+	Error   *apierror.Error `json:"error,omitempty"`
+}
+
+// CheckDrift compares every resource in m against live state without changing anything
+func CheckDrift(store *postgresql.Store, m *Manifest) (*DriftReport, error) {
+	g, err := buildGraph(m)
+	if err != nil {
+		return nil, err
+	}
+	sorted, err := g.sort()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DriftReport{Results: make([]DriftResult, 0, len(sorted))}
+	missing := map[string]bool{}
+	for _, n := range sorted {
+		result := DriftResult{Type: n.typ, Key: n.key, Status: DriftInSync}
+		if n.database != "" && missing[nodeId(TypeDatabases, n.database)] {
+			// The database does not exist, so nothing inside it can exist either
+			result.Status = DriftMissing
+		} else {
+			action, changes, err := n.reconcile(store, false)
+			switch {
+			case err != nil:
+				result.Status = DriftError
+				result.Error = apierror.New(err)
+			case action == ActionCreate:
+				result.Status = DriftMissing
+			case action == ActionUpdate:
+				result.Status = DriftChanged
+				result.Changes = changes
+			case action == ActionImmutable:
+				result.Status = DriftImmutable
+				result.Changes = changes
+			}
+		}
+
+		switch result.Status {
+		case DriftMissing:
+			missing[n.id] = true
+			report.Drifted++
+		case DriftChanged:
+			report.Drifted++
+		case DriftError:
+			report.Errors++
+		case DriftImmutable:
+			report.Immutable++
+		}
+		if result.Status != DriftInSync {
+			log.Printf("[Drift] %s: %s\n", n.id, result.Status)
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+// DriftDetected produces an error that summarizes report
+// If no drift or errors were found, nil is returned
+func DriftDetected(report *DriftReport) error {
+	if report.Drifted == 0 && report.Errors == 0 {
+		return nil
+	}
+	return &apierror.Error{
+		Status:  http.StatusConflict,
+		Code:    apierror.CodeDriftDetected,
+		Message: fmt.Sprintf("drift detected: %d resources drifted, %d resources could not be inspected", report.Drifted, report.Errors),
+	}
+}
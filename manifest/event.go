@@ -0,0 +1,130 @@
+package manifest
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nullstone-modules/pg-db-admin/apierror"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+)
+
+// Event applies a manifest
+// Apply contains the manifest as a json object or as a string containing a JSON/YAML document
+// e.g. `{"apply": {"roles": [...], "databases": [...]}}`
+type Event struct {
+	Apply json.RawMessage `json:"apply"`
+	// DryRun returns the planned statements in the Report instead of executing them
+	DryRun bool `json:"dryRun"`
+}
+
+func IsEvent(rawEvent json.RawMessage) (bool, Event) {
+	var event Event
+	if err := json.Unmarshal(rawEvent, &event); err != nil {
+		return false, event
+	}
+	return isPresent(event.Apply), event
+}
+
+func Handle(ctx context.Context, event Event, store *postgresql.Store) (*Report, error) {
+	m, err := parseEventManifest(event.Apply)
+	if err != nil {
+		return nil, err
+	}
+	return ApplyWithDryRun(store, m, event.DryRun)
+}
+
+// parseEventManifest parses a manifest that is embedded in an event as a json object or a JSON/YAML string
+func parseEventManifest(raw json.RawMessage) (*Manifest, error) {
+	var doc string
+	if err := json.Unmarshal(raw, &doc); err == nil {
+		raw = []byte(doc)
+	}
+	m, err := Parse(raw)
+	if err != nil {
+		return nil, apierror.InvalidPayload(err)
+	}
+	return m, nil
+}
+
+// ApplyWithDryRun applies m to store
+// If dryRun is true, the manifest is applied to a dry-run store and the planned statements are attached to the Report
+func ApplyWithDryRun(store *postgresql.Store, m *Manifest, dryRun bool) (*Report, error) {
+	var plan *postgresql.Plan
+	if dryRun {
+		store, plan = store.DryRun()
+	}
+	report, err := Apply(store, m)
+	if err != nil {
+		return nil, apierror.InvalidPayload(err)
+	}
+	report.Plan = plan
+	return report, nil
+}
+
+// ExportEvent exports the live state of the cluster
+// e.g. `{"export": true}`
+type ExportEvent struct {
+	Export bool `json:"export"`
+}
+
+func IsExportEvent(rawEvent json.RawMessage) (bool, ExportEvent) {
+	var event ExportEvent
+	if err := json.Unmarshal(rawEvent, &event); err != nil {
+		return false, event
+	}
+	return event.Export, event
+}
+
+func HandleExport(ctx context.Context, event ExportEvent, store *postgresql.Store) (*Export, error) {
+	result, err := ExportState(store)
+	if err != nil {
+		return nil, apierror.New(err)
+	}
+	return result, nil
+}
+
+// DriftEvent compares a manifest against live state
+// e.g. `{"driftCheck": {"roles": [...], "databases": [...]}, "failOnDrift": true}`
+//
+// This can be sent from an EventBridge schedule using a constant input
+// The same payload is also accepted in the `detail` of an EventBridge event (e.g. from a custom event bus)
+type DriftEvent struct {
+	DriftCheck json.RawMessage `json:"driftCheck"`
+	// FailOnDrift returns an error if drift is detected so that the invocation is reported as failed
+	// This allows alerting on drift through the lambda's error metrics
+	FailOnDrift bool `json:"failOnDrift"`
+}
+
+func IsDriftEvent(rawEvent json.RawMessage) (bool, DriftEvent) {
+	var event struct {
+		DriftEvent
+		Detail *DriftEvent `json:"detail"`
+	}
+	if err := json.Unmarshal(rawEvent, &event); err != nil {
+		return false, event.DriftEvent
+	}
+	if event.Detail != nil && isPresent(event.Detail.DriftCheck) {
+		return true, *event.Detail
+	}
+	return isPresent(event.DriftCheck), event.DriftEvent
+}
+
+func HandleDrift(ctx context.Context, event DriftEvent, store *postgresql.Store) (*DriftReport, error) {
+	m, err := parseEventManifest(event.DriftCheck)
+	if err != nil {
+		return nil, err
+	}
+	report, err := CheckDrift(store, m)
+	if err != nil {
+		return nil, apierror.InvalidPayload(err)
+	}
+	if event.FailOnDrift {
+		if err := DriftDetected(report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func isPresent(raw json.RawMessage) bool {
+	return len(raw) > 0 && string(raw) != "null"
+}
@@ -0,0 +1,221 @@
+package manifest
+
+import (
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"log"
+	"sort"
+)
+
+// Export contains the live state of a cluster
+// Manifest can be applied as-is; Payloads contain the same resources as crud-invoke payloads in dependency order
+// Passwords cannot be introspected and are omitted
+//
+// Databases, roles, and role members are marked `useExisting` so that applying them adopts the existing objects
+// Roles that pg-db-admin cannot manage (protected by the Policy or the role that pg-db-admin connects as) are omitted
+// Readonly/readwrite access groups are exported as database access of their members instead of roles
+type Export struct {
+	Manifest *Manifest `json:"manifest"`
+	Payloads []Payload `json:"payloads"`
+}
+
+// Payload matches the `type` and `data` of a crud-invoke event
+type Payload struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// accessGroup identifies the database and level of an access group role
+type accessGroup struct {
+	database string
+	level    string
+}
+
+// ExportState introspects store and produces an Export of every non-system object
+func ExportState(store *postgresql.Store) (*Export, error) {
+	m := &Manifest{}
+	checker, err := postgresql.NewPolicyChecker(store)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("[Export] Listing databases")
+	databases, err := listAll(func(opts postgresql.ListOptions) (*postgresql.Page[postgresql.Database], error) {
+		return store.Databases.List(postgresql.DatabaseFilter{ListOptions: opts})
+	})
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string]accessGroup{}
+	for _, database := range databases {
+		for _, level := range []string{postgresql.AccessReadWrite, postgresql.AccessReadOnly} {
+			if ok, err := store.DatabaseAccess.IsAccessGroup(database.Name, level); err != nil {
+				return nil, err
+			} else if ok {
+				groups[postgresql.AccessGroupName(database.Name, level)] = accessGroup{database: database.Name, level: level}
+			}
+		}
+	}
+
+	log.Println("[Export] Listing roles")
+	roles, err := listAll(func(opts postgresql.ListOptions) (*postgresql.Page[postgresql.Role], error) {
+		return store.Roles.List(postgresql.RoleFilter{ListOptions: opts})
+	})
+	if err != nil {
+		return nil, err
+	}
+	// exportable is true for roles that are in the export; memberships and privileges of other roles are omitted
+	exportable := map[string]bool{}
+	for _, role := range roles {
+		_, isGroup := groups[role.Name]
+		exportable[role.Name] = !isGroup && checker.IsManagedRole(role.Name)
+	}
+	isExportable := func(names ...string) bool {
+		for _, name := range names {
+			if !exportable[name] {
+				return false
+			}
+		}
+		return true
+	}
+
+	targets := map[string]bool{}
+	for _, role := range roles {
+		if !exportable[role.Name] {
+			log.Printf("[Export] Skipping role %q\n", role.Name)
+			continue
+		}
+		for _, target := range role.MemberOf {
+			if !postgresql.IsSystemRole(target) {
+				targets[target] = true
+			}
+		}
+		// Memberships are exported as role members so that they can be imported individually
+		role.MemberOf = nil
+		role.UseExisting = true
+		m.Roles = append(m.Roles, role)
+	}
+
+	log.Println("[Export] Listing role members")
+	for _, target := range sortedKeys(targets) {
+		members, err := listAll(func(opts postgresql.ListOptions) (*postgresql.Page[postgresql.RoleMember], error) {
+			return store.RoleMembers.List(postgresql.RoleMemberFilter{ListOptions: opts, Target: target})
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			if group, ok := groups[target]; ok && isExportable(member.Member) {
+				m.DatabaseAccess = append(m.DatabaseAccess, postgresql.DatabaseAccess{Role: member.Member, Database: group.database, Level: group.level})
+				continue
+			}
+			if !isExportable(member.Member, member.Target) {
+				continue
+			}
+			member.UseExisting = true
+			m.RoleMembers = append(m.RoleMembers, member)
+		}
+	}
+
+	for _, database := range databases {
+		if checker.Check(postgresql.ObjectRef{Kind: postgresql.ObjectDatabase, Name: database.Name}) != nil {
+			log.Printf("[Export] Skipping database %q\n", database.Name)
+			continue
+		}
+		// Applying the export leaves the owner unchanged if the owner is not exported
+		if !isExportable(database.Owner) {
+			database.Owner = ""
+		}
+		database.UseExisting = true
+		m.Databases = append(m.Databases, database)
+		if database.DisableConnections != nil && *database.DisableConnections {
+			continue
+		}
+
+		log.Printf("[Export] Inspecting database %q\n", database.Name)
+		schemas, err := listAll(func(opts postgresql.ListOptions) (*postgresql.Page[postgresql.Schema], error) {
+			return store.Schemas.List(postgresql.SchemaFilter{ListOptions: opts, Database: database.Name})
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, schema := range schemas {
+			if !isExportable(schema.Owner) {
+				schema.Owner = ""
+			}
+			m.Schemas = append(m.Schemas, schema)
+		}
+
+		privileges, err := listAll(func(opts postgresql.ListOptions) (*postgresql.Page[postgresql.SchemaPrivilege], error) {
+			return store.SchemaPrivileges.List(postgresql.SchemaPrivilegeFilter{ListOptions: opts, Database: database.Name})
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, privilege := range privileges {
+			if isExportable(privilege.Role) {
+				m.SchemaPrivileges = append(m.SchemaPrivileges, privilege)
+			}
+		}
+
+		grants, err := listAll(func(opts postgresql.ListOptions) (*postgresql.Page[postgresql.DefaultGrant], error) {
+			return store.DefaultGrants.List(postgresql.DefaultGrantFilter{ListOptions: opts, Database: database.Name})
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, grant := range grants {
+			if isExportable(grant.Role, grant.Target) {
+				m.DefaultGrants = append(m.DefaultGrants, grant)
+			}
+		}
+	}
+
+	payloads, err := m.Payloads()
+	if err != nil {
+		return nil, err
+	}
+	return &Export{Manifest: m, Payloads: payloads}, nil
+}
+
+// Payloads converts the resources in m to crud-invoke payloads in dependency order
+func (m *Manifest) Payloads() ([]Payload, error) {
+	g, err := buildGraph(m)
+	if err != nil {
+		return nil, err
+	}
+	sorted, err := g.sort()
+	if err != nil {
+		return nil, err
+	}
+	payloads := make([]Payload, 0, len(sorted))
+	for _, n := range sorted {
+		payloads = append(payloads, Payload{Type: n.typ, Data: n.obj})
+	}
+	return payloads, nil
+}
+
+// listAll retrieves every page from list
+func listAll[T any](list func(opts postgresql.ListOptions) (*postgresql.Page[T], error)) ([]T, error) {
+	opts := postgresql.ListOptions{Limit: postgresql.MaxListLimit}
+	items := make([]T, 0)
+	for {
+		page, err := list(opts)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+		if page.NextPageToken == "" {
+			return items, nil
+		}
+		opts.PageToken = page.NextPageToken
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
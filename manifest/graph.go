@@ -0,0 +1,248 @@
+package manifest
+
+import (
+	"fmt"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"slices"
+	"strings"
+)
+
+const (
+	TypeDatabases        = "databases"
+	TypeRoles            = "roles"
+	TypeRoleMembers      = "role_members"
+	TypeSchemas          = "schemas"
+	TypeSchemaPrivileges = "schema_privileges"
+	TypeDefaultGrants    = "default_grants"
+	TypeDatabaseAccess   = "database_access"
+)
+
+// node is a single resource in the manifest
+// deps refer to the ids of other nodes that must be applied first
+type node struct {
+	id   string
+	typ  string
+	key  string
+	deps []string
+	// database is the database that the resource lives in, if the resource lives inside a database
+	database  string
+	obj       any
+	reconcile reconcileFunc
+}
+
+func nodeId(typ, key string) string {
+	return typ + "/" + key
+}
+
+// graph contains the nodes of a manifest in the order they were added
+type graph struct {
+	nodes []*node
+	byId  map[string]*node
+}
+
+func (g *graph) add(n *node) error {
+	n.id = nodeId(n.typ, n.key)
+	if _, ok := g.byId[n.id]; ok {
+		return fmt.Errorf("duplicate resource %q", n.id)
+	}
+	g.nodes = append(g.nodes, n)
+	g.byId[n.id] = n
+	return nil
+}
+
+// link adds dependencies from the node to other nodes
+// Dependencies are only added if the other node is in the manifest; otherwise, the object must already exist
+func (g *graph) link() {
+	for _, n := range g.nodes {
+		deps := make([]string, 0, len(n.deps))
+		for _, dep := range n.deps {
+			if _, ok := g.byId[dep]; ok && dep != n.id && !slices.Contains(deps, dep) {
+				deps = append(deps, dep)
+			}
+		}
+		n.deps = deps
+	}
+}
+
+// sort orders the nodes so that every node comes after its dependencies
+// Nodes without a dependency relationship keep their manifest order
+func (g *graph) sort() ([]*node, error) {
+	inDegree := map[string]int{}
+	dependents := map[string][]*node{}
+	for _, n := range g.nodes {
+		inDegree[n.id] = len(n.deps)
+		for _, dep := range n.deps {
+			dependents[dep] = append(dependents[dep], n)
+		}
+	}
+
+	queue := make([]*node, 0)
+	for _, n := range g.nodes {
+		if inDegree[n.id] == 0 {
+			queue = append(queue, n)
+		}
+	}
+	sorted := make([]*node, 0, len(g.nodes))
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		sorted = append(sorted, cur)
+		for _, dependent := range dependents[cur.id] {
+			inDegree[dependent.id]--
+			if inDegree[dependent.id] == 0 {
+				queue = append(queue, dependent)
+			}
+		}
+	}
+
+	if len(sorted) < len(g.nodes) {
+		cycle := make([]string, 0)
+		for _, n := range g.nodes {
+			if inDegree[n.id] > 0 {
+				cycle = append(cycle, n.id)
+			}
+		}
+		return nil, fmt.Errorf("manifest contains a dependency cycle between %s", strings.Join(cycle, ", "))
+	}
+	return sorted, nil
+}
+
+// buildGraph creates a node for every resource in m
+func buildGraph(m *Manifest) (*graph, error) {
+	g := &graph{byId: map[string]*node{}}
+	roleId := func(name string) string { return nodeId(TypeRoles, name) }
+	dbId := func(name string) string { return nodeId(TypeDatabases, name) }
+
+	managed := findManagedMemberships(m)
+	for _, obj := range m.Roles {
+		deps := make([]string, 0)
+		for _, target := range obj.MemberOf {
+			deps = append(deps, roleId(target))
+		}
+		n := &node{typ: TypeRoles, key: obj.Name, deps: deps, obj: obj, reconcile: roleReconciler(obj, managed[obj.Key()])}
+		if err := g.add(n); err != nil {
+			return nil, err
+		}
+	}
+	for _, obj := range m.Databases {
+		n := &node{typ: TypeDatabases, key: obj.Name, deps: []string{roleId(obj.Owner)}, obj: obj, reconcile: databaseReconciler(obj)}
+		if err := g.add(n); err != nil {
+			return nil, err
+		}
+	}
+	for _, obj := range m.RoleMembers {
+		n := &node{
+			typ:  TypeRoleMembers,
+			key:  obj.Target + "/" + obj.Member,
+			deps: []string{roleId(obj.Member), roleId(obj.Target)},
+			obj:  obj, reconcile: roleMemberReconciler(obj),
+		}
+		if err := g.add(n); err != nil {
+			return nil, err
+		}
+	}
+	for _, obj := range m.Schemas {
+		n := &node{
+			typ:      TypeSchemas,
+			key:      obj.Database + "/" + obj.Name,
+			deps:     []string{dbId(obj.Database), roleId(obj.Owner)},
+			database: obj.Database,
+			obj:      obj, reconcile: schemaReconciler(obj),
+		}
+		if err := g.add(n); err != nil {
+			return nil, err
+		}
+	}
+	for _, obj := range m.SchemaPrivileges {
+		n := &node{
+			typ:      TypeSchemaPrivileges,
+			key:      obj.Database + "/" + obj.Role,
+			deps:     []string{dbId(obj.Database), roleId(obj.Role)},
+			database: obj.Database,
+			obj:      obj, reconcile: schemaPrivilegeReconciler(obj),
+		}
+		if err := g.add(n); err != nil {
+			return nil, err
+		}
+	}
+	for _, obj := range m.DefaultGrants {
+		obj.SetId()
+		n := &node{
+			typ:      TypeDefaultGrants,
+			key:      obj.Role + "/" + obj.Id,
+			deps:     []string{dbId(obj.Database), roleId(obj.Role), roleId(obj.Target)},
+			database: obj.Database,
+			obj:      obj, reconcile: defaultGrantReconciler(obj),
+		}
+		if err := g.add(n); err != nil {
+			return nil, err
+		}
+	}
+	for _, obj := range m.DatabaseAccess {
+		n := &node{
+			typ:       TypeDatabaseAccess,
+			key:       obj.Database + "/" + obj.Role,
+			deps:      []string{dbId(obj.Database), roleId(obj.Role)},
+			database:  obj.Database,
+			obj:       obj,
+			reconcile: databaseAccessReconciler(obj),
+		}
+		if err := g.add(n); err != nil {
+			return nil, err
+		}
+	}
+
+	g.link()
+	return g, nil
+}
+
+// managedMemberships are the memberships of a role that are granted by role members and database access in a manifest
+// These memberships are not revoked from a role that specifies memberOf
+type managedMemberships struct {
+	targets []string
+	// ownedDatabases contains databases that the role has owner access to, but whose owner is not in the manifest
+	ownedDatabases []string
+}
+
+// resolve returns the managed memberships, reading the live owner of each database in ownedDatabases
+func (m managedMemberships) resolve(store *postgresql.Store) ([]string, error) {
+	targets := slices.Clone(m.targets)
+	for _, name := range m.ownedDatabases {
+		database, err := store.Databases.Read(name)
+		if err != nil {
+			return nil, err
+		}
+		if database != nil {
+			targets = append(targets, database.Owner)
+		}
+	}
+	return targets, nil
+}
+
+func findManagedMemberships(m *Manifest) map[string]managedMemberships {
+	owners := map[string]string{}
+	for _, obj := range m.Databases {
+		owners[obj.Name] = obj.Owner
+	}
+	managed := map[string]managedMemberships{}
+	for _, obj := range m.RoleMembers {
+		cur := managed[obj.Member]
+		cur.targets = append(cur.targets, obj.Target)
+		managed[obj.Member] = cur
+	}
+	for _, obj := range m.DatabaseAccess {
+		cur := managed[obj.Role]
+		switch owner := owners[obj.Database]; obj.Level {
+		case "", postgresql.AccessOwner:
+			if owner != "" {
+				cur.targets = append(cur.targets, owner)
+			} else {
+				cur.ownedDatabases = append(cur.ownedDatabases, obj.Database)
+			}
+		default:
+			cur.targets = append(cur.targets, postgresql.AccessGroupName(obj.Database, obj.Level))
+		}
+		managed[obj.Role] = cur
+	}
+	return managed
+}
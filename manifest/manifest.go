@@ -0,0 +1,54 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest is a desired-state document of the objects managed by pg-db-admin
+// Each entry uses the same structure as the corresponding crud-invoke payload
+type Manifest struct {
+	Databases        []postgresql.Database        `json:"databases,omitempty"`
+	Roles            []postgresql.Role            `json:"roles,omitempty"`
+	RoleMembers      []postgresql.RoleMember      `json:"roleMembers,omitempty"`
+	Schemas          []postgresql.Schema          `json:"schemas,omitempty"`
+	SchemaPrivileges []postgresql.SchemaPrivilege `json:"schemaPrivileges,omitempty"`
+	DefaultGrants    []postgresql.DefaultGrant    `json:"defaultGrants,omitempty"`
+	DatabaseAccess   []postgresql.DatabaseAccess  `json:"databaseAccess,omitempty"`
+}
+
+// Parse decodes a manifest from either JSON or YAML
+// YAML documents are converted to JSON first so that both formats use the same field names
+func Parse(raw []byte) (*Manifest, error) {
+	if !json.Valid(raw) {
+		var doc any
+		if err := yaml.Unmarshal(raw, &doc); err != nil {
+			return nil, fmt.Errorf("invalid manifest: %w", err)
+		}
+		var err error
+		if raw, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("invalid manifest: %w", err)
+		}
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// ToYaml renders v as YAML using the same field names as its JSON representation
+func ToYaml(v any) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(doc)
+}
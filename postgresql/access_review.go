@@ -0,0 +1,131 @@
+package postgresql
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"github.com/lib/pq"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// accessReviewCsvHeader contains the columns of AccessReview.WriteCsv
+var accessReviewCsvHeader = []string{
+	"role", "superuser", "create_role", "create_db", "member_of", "password_changed_at", "valid_until", "connect_databases", "owns_objects",
+}
+
+// AccessReview lists every role that can log in to the cluster for a periodic access review
+type AccessReview struct {
+	GeneratedAt time.Time          `json:"generatedAt"`
+	Roles       []AccessReviewRole `json:"roles"`
+	// Warnings reports data that is missing from the review (e.g. password changes are not tracked)
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type AccessReviewRole struct {
+	Name       string `json:"name"`
+	Superuser  bool   `json:"superuser"`
+	CreateRole bool   `json:"createRole"`
+	CreateDb   bool   `json:"createDb"`
+	// MemberOf contains the roles that Name is a direct member of
+	MemberOf []string `json:"memberOf"`
+	// PasswordChangedAt is the last time that pg-db-admin set the password
+	// This is empty if the password was never set through pg-db-admin
+	PasswordChangedAt *time.Time `json:"passwordChangedAt"`
+	// ValidUntil is the time that the password expires (VALID UNTIL)
+	// This is empty if the password never expires
+	ValidUntil *time.Time `json:"validUntil"`
+	// ConnectDatabases contains the databases that accept connections and that Name has CONNECT privilege on
+	// pg_hba.conf is not visible to SQL, so it may still refuse the connection
+	ConnectDatabases []string `json:"connectDatabases"`
+	// OwnsObjects is true if Name owns any object in any database
+	OwnsObjects bool `json:"ownsObjects"`
+}
+
+// AccessReview reads every login role in the cluster, including system roles, sorted by name
+func (r *Roles) AccessReview() (*AccessReview, error) {
+	db, err := r.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+	passwordChanges, tracked, err := readPasswordChanges(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// pg_shdepend records the owner of objects in every database, except objects owned by the bootstrap superuser
+	sq := `SELECT r.rolname, r.rolsuper, r.rolcreaterole, r.rolcreatedb,
+	ARRAY(SELECT b.rolname FROM pg_auth_members m JOIN pg_roles b ON m.roleid = b.oid WHERE m.member = r.oid GROUP BY b.rolname ORDER BY b.rolname),
+	CASE WHEN r.rolvaliduntil = 'infinity' THEN NULL ELSE r.rolvaliduntil END,
+	ARRAY(SELECT d.datname FROM pg_database d WHERE d.datallowconn AND NOT d.datistemplate AND has_database_privilege(r.oid, d.oid, 'CONNECT') ORDER BY d.datname),
+	EXISTS(SELECT 1 FROM pg_shdepend s WHERE s.refclassid = 'pg_authid'::regclass AND s.refobjid = r.oid AND s.deptype = 'o')
+FROM pg_roles r
+WHERE r.rolcanlogin
+ORDER BY r.rolname`
+	rows, err := db.Query(sq)
+	if err != nil {
+		return nil, stepErrorf(StepList, "error reading login roles: %w", err)
+	}
+	defer rows.Close()
+
+	review := &AccessReview{GeneratedAt: time.Now().UTC(), Roles: make([]AccessReviewRole, 0)}
+	if !tracked {
+		review.Warnings = append(review.Warnings, fmt.Sprintf("passwordChangedAt is unavailable because %s does not exist; run setup to create it",
+			MetadataTable(passwordChangesTable)))
+	}
+	for rows.Next() {
+		var cur AccessReviewRole
+		var validUntil sql.NullTime
+		if err := rows.Scan(&cur.Name, &cur.Superuser, &cur.CreateRole, &cur.CreateDb, pq.Array(&cur.MemberOf), &validUntil,
+			pq.Array(&cur.ConnectDatabases), &cur.OwnsObjects); err != nil {
+			return nil, stepErrorf(StepList, "error reading login role: %w", err)
+		}
+		if validUntil.Valid {
+			cur.ValidUntil = &validUntil.Time
+		}
+		if changedAt, ok := passwordChanges[cur.Name]; ok {
+			cur.PasswordChangedAt = &changedAt
+		}
+		review.Roles = append(review.Roles, cur)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stepErrorf(StepList, "error reading login roles: %w", err)
+	}
+	return review, nil
+}
+
+// WriteCsv writes a header and a row for each role
+// Lists are separated by semicolons and times are formatted as RFC 3339
+func (a *AccessReview) WriteCsv(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(accessReviewCsvHeader); err != nil {
+		return err
+	}
+	for _, role := range a.Roles {
+		record := []string{
+			role.Name,
+			strconv.FormatBool(role.Superuser),
+			strconv.FormatBool(role.CreateRole),
+			strconv.FormatBool(role.CreateDb),
+			strings.Join(role.MemberOf, ";"),
+			csvTime(role.PasswordChangedAt),
+			csvTime(role.ValidUntil),
+			strings.Join(role.ConnectDatabases, ";"),
+			strconv.FormatBool(role.OwnsObjects),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
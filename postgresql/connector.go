@@ -0,0 +1,97 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"log"
+	"net/url"
+)
+
+const (
+	// pqInvalidPassword is the SQLSTATE returned by postgres when authentication fails
+	pqInvalidPassword = "28P01"
+)
+
+// IsAuthFailure returns true if err was caused by postgres rejecting the credentials
+func IsAuthFailure(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pqInvalidPassword
+}
+
+// AuthTokenProvider generates a short-lived password for user on host (host:port), such as an RDS IAM auth token
+// If a Store has an AuthTokenProvider, a new token replaces the password of the connection url for every new connection
+// Tokens are never reused, so they cannot expire before they are used
+type AuthTokenProvider interface {
+	AuthToken(ctx context.Context, host, user string) (string, error)
+}
+
+var _ driver.Connector = storeConnector{}
+
+// storeConnector creates new connections using the Store's current connection url
+// If postgres rejects the credentials, the connection url is re-resolved and the connection is retried once
+// This allows a warm process to recover after credentials are rotated
+type storeConnector struct {
+	store  *Store
+	dbName string
+}
+
+func (c storeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connect(ctx, false)
+	if IsAuthFailure(err) && c.store.connUrlResolver != nil {
+		log.Println("Postgres rejected credentials, refreshing connection url")
+		return c.connect(ctx, true)
+	}
+	return conn, err
+}
+
+func (c storeConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+func (c storeConnector) connect(ctx context.Context, refresh bool) (driver.Conn, error) {
+	connUrl, err := c.store.resolveConnUrl(ctx, refresh)
+	if err != nil {
+		return nil, err
+	}
+	connUrl, err = databaseConnUrl(connUrl, c.dbName)
+	if err != nil {
+		return nil, err
+	}
+	if c.store.AuthToken != nil {
+		if connUrl, err = authTokenConnUrl(ctx, c.store.AuthToken, connUrl); err != nil {
+			return nil, err
+		}
+	}
+	connector, err := pq.NewConnector(connUrl)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+// authTokenConnUrl replaces the password of connUrl with a new token from provider
+// Token authentication sends the token in cleartext, so TLS is required unless sslmode is configured
+func authTokenConnUrl(ctx context.Context, provider AuthTokenProvider, connUrl string) (string, error) {
+	u, err := url.Parse(connUrl)
+	if err != nil {
+		return "", fmt.Errorf("invalid connection url: %w", err)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = u.Host + ":5432"
+	}
+	user := u.User.Username()
+	token, err := provider.AuthToken(ctx, host, user)
+	if err != nil {
+		return "", fmt.Errorf("error generating auth token for %q: %w", user, err)
+	}
+	u.User = url.UserPassword(user, token)
+	if query := u.Query(); query.Get("sslmode") == "" {
+		query.Set("sslmode", "require")
+		u.RawQuery = query.Encode()
+	}
+	return u.String(), nil
+}
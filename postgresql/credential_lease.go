@@ -0,0 +1,420 @@
+package postgresql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/go-multierror/multierror"
+	"github.com/lib/pq"
+	"github.com/nullstone-io/go-rest-api"
+	"log"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	credentialLeasesTable = "credential_leases"
+	leaseRolePrefix       = "lease"
+
+	// DefaultLeaseTtl is the duration of a lease if a ttl is not requested
+	DefaultLeaseTtl = time.Hour
+	// MaxLeaseTtl is the longest that a lease can live since it was created, including renewals
+	MaxLeaseTtl = 24 * time.Hour
+
+	// LeaseTemplatesEnvVar configures the template role of leases for each database (see LeaseTemplatesFromEnv)
+	LeaseTemplatesEnvVar = "LEASE_TEMPLATES"
+	// AnyDatabase configures the template role of leases for databases that are not configured explicitly
+	AnyDatabase = "*"
+)
+
+// CredentialLease is a short-lived login role for Database
+//
+// The login role is generated with a unique name and random password that are valid until ExpiresAt
+// The role receives its privileges through membership in Template, which is configured by the operator (see CredentialLeases.Templates)
+// If no template is configured for Database, the role is granted DatabaseAccess at Level instead (readonly by default)
+//
+// Expired leases are removed by Sweep: sessions are terminated, owned objects are reassigned to the database owner,
+// and the role is dropped
+type CredentialLease struct {
+	// Id is the name of the generated login role
+	Id       string `json:"id"`
+	Database string `json:"database"`
+	// Template is a role whose privileges are inherited by the generated login role
+	// Template is read-only; a request that sets Template is rejected
+	Template string `json:"template,omitempty"`
+	// Level is the DatabaseAccess level that is granted if no template is configured
+	Level string `json:"level,omitempty"`
+	// Ttl is the requested duration (e.g. `15m`) of the lease; see DefaultLeaseTtl and MaxLeaseTtl
+	Ttl       string    `json:"ttl,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Password and ConnectionUrl are only returned when the lease is created
+	Password      string `json:"password,omitempty"`
+	ConnectionUrl string `json:"connectionUrl,omitempty"`
+}
+
+func (l CredentialLease) Key() CredentialLeaseKey {
+	return CredentialLeaseKey{
+		Database: l.Database,
+		Id:       l.Id,
+	}
+}
+
+type CredentialLeaseKey struct {
+	Database string
+	Id       string
+}
+
+var _ rest.DataAccess[CredentialLeaseKey, CredentialLease] = &CredentialLeases{}
+
+type CredentialLeases struct {
+	DbOpener       DbOpener
+	DatabaseAccess *DatabaseAccesses
+	RoleMembers    *RoleMembers
+	// Templates maps a database to the template role of its leases
+	// AnyDatabase applies to databases without an entry
+	Templates map[string]string
+	// ConnUrl retrieves the admin connection url that is used to build the connection url of each lease
+	ConnUrl func() string
+}
+
+// Create generates a new login role and returns its credentials
+// Create always issues a new lease; the Id of obj is ignored
+func (c *CredentialLeases) Create(obj CredentialLease) (*CredentialLease, error) {
+	if obj.Template != "" {
+		return nil, &ValidationError{Field: "template", Reason: fmt.Sprintf("cannot be requested, templates are configured with %s", LeaseTemplatesEnvVar)}
+	}
+	obj.Template = c.template(obj.Database)
+	if err := validateNames(c.DbOpener, true, obj.nameFields()...); err != nil {
+		return nil, err
+	}
+	if err := enforcePolicy(c.DbOpener, obj.policyRefs()...); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	ttl, err := leaseTtl(obj.Ttl)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Template == "" {
+		if obj.Level == "" {
+			obj.Level = AccessReadOnly
+		}
+		if err := validateAccessLevel(obj.Level); err != nil {
+			return nil, err
+		}
+	} else {
+		obj.Level = ""
+	}
+	if _, err := c.DatabaseAccess.readOwner(obj.Database); err != nil {
+		return nil, err
+	}
+
+	db, err := c.openMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	policy := passwordPolicy(c.DbOpener)
+	obj.Id, obj.Password, err = RandomRoleCreds(leaseRoleName(obj.Database), policy)
+	if err != nil {
+		return nil, fmt.Errorf("error generating lease credentials: %w", err)
+	}
+	secret, err := policy.PasswordSecret(obj.Password)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing lease password: %w", err)
+	}
+	obj.CreatedAt = now
+	obj.ExpiresAt = now.Add(ttl)
+
+	log.Printf("Creating lease role %q on %q valid until %s\n", obj.Id, obj.Database, obj.ExpiresAt.Format(time.RFC3339))
+	sq := fmt.Sprintf("CREATE ROLE %s WITH LOGIN PASSWORD %s VALID UNTIL %s",
+		pq.QuoteIdentifier(obj.Id), pq.QuoteLiteral(secret), validUntil(obj.ExpiresAt))
+	if _, err := db.Exec(sq); err != nil {
+		return nil, stepErrorf(StepCreateRole, "error creating lease role %q: %w", obj.Id, err)
+	}
+
+	// Record the lease before granting privileges so that the sweeper cleans up the role if a grant fails
+	sq = fmt.Sprintf("INSERT INTO %s (role, database, template, level, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		MetadataTable(credentialLeasesTable))
+	if _, err := db.Exec(sq, obj.Id, obj.Database, obj.Template, obj.Level, obj.ExpiresAt, obj.CreatedAt); err != nil {
+		return nil, stepErrorf(StepMetadata, "error recording lease %q: %w", obj.Id, err)
+	}
+
+	if err := c.grant(obj); err != nil {
+		if revokeErr := c.expire(obj); revokeErr != nil {
+			return nil, multierror.New([]error{err, revokeErr})
+		}
+		return nil, err
+	}
+
+	obj.Ttl = ""
+	obj.ConnectionUrl = c.connectionUrl(obj)
+	return &obj, nil
+}
+
+func (c *CredentialLeases) Read(key CredentialLeaseKey) (*CredentialLease, error) {
+	db, err := c.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+
+	obj := CredentialLease{Id: key.Id, Database: key.Database}
+	sq := fmt.Sprintf("SELECT template, level, expires_at, created_at FROM %s WHERE role = $1 AND database = $2", MetadataTable(credentialLeasesTable))
+	if err := db.QueryRow(sq, key.Id, key.Database).Scan(&obj.Template, &obj.Level, &obj.ExpiresAt, &obj.CreatedAt); err != nil {
+		if err == sql.ErrNoRows || isUndefinedTable(err) {
+			return nil, nil
+		}
+		return nil, stepError(StepMetadata, err)
+	}
+	return &obj, nil
+}
+
+// Update renews the lease for Ttl from now
+// A lease cannot be renewed past MaxLeaseTtl since it was created; ExpiresAt reports the renewed expiry
+func (c *CredentialLeases) Update(key CredentialLeaseKey, obj CredentialLease) (*CredentialLease, error) {
+	if err := enforcePolicy(c.DbOpener, databaseRef(key.Database)); err != nil {
+		return nil, err
+	}
+	ttl, err := leaseTtl(obj.Ttl)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := c.Read(key)
+	if err != nil || existing == nil {
+		return existing, err
+	}
+
+	now := time.Now().UTC()
+	if !existing.ExpiresAt.After(now) {
+		return nil, &ValidationError{Field: "id", Reason: "lease has expired and cannot be renewed"}
+	}
+	expiresAt := now.Add(ttl)
+	if maxExpiresAt := existing.CreatedAt.Add(MaxLeaseTtl); expiresAt.After(maxExpiresAt) {
+		expiresAt = maxExpiresAt.UTC()
+	}
+
+	db, err := c.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Renewing lease %q until %s\n", key.Id, expiresAt.Format(time.RFC3339))
+	sq := fmt.Sprintf("ALTER ROLE %s VALID UNTIL %s", pq.QuoteIdentifier(key.Id), validUntil(expiresAt))
+	if _, err := db.Exec(sq); err != nil {
+		return nil, stepErrorf(StepAlterRole, "error renewing lease %q: %w", key.Id, err)
+	}
+	sq = fmt.Sprintf("UPDATE %s SET expires_at = $2 WHERE role = $1", MetadataTable(credentialLeasesTable))
+	if _, err := db.Exec(sq, key.Id, expiresAt); err != nil {
+		return nil, stepErrorf(StepMetadata, "error recording lease %q: %w", key.Id, err)
+	}
+	existing.ExpiresAt = expiresAt
+	return existing, nil
+}
+
+// Drop revokes the lease immediately
+func (c *CredentialLeases) Drop(key CredentialLeaseKey) (bool, error) {
+	if err := enforcePolicy(c.DbOpener, databaseRef(key.Database)); err != nil {
+		return false, err
+	}
+	existing, err := c.Read(key)
+	if err != nil {
+		return false, err
+	} else if existing == nil {
+		return true, nil
+	}
+	if err := c.expire(*existing); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Sweep revokes every lease that expired before now
+// It returns the ids of the leases that were revoked
+// If a lease fails to be revoked, it remains recorded and is retried on the next sweep
+func (c *CredentialLeases) Sweep(now time.Time) ([]string, error) {
+	db, err := c.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+
+	sq := fmt.Sprintf("SELECT role, database, template, level, expires_at, created_at FROM %s WHERE expires_at <= $1 ORDER BY expires_at",
+		MetadataTable(credentialLeasesTable))
+	rows, err := db.Query(sq, now)
+	if err != nil {
+		if isUndefinedTable(err) {
+			return []string{}, nil
+		}
+		return nil, stepErrorf(StepMetadata, "error listing expired leases: %w", err)
+	}
+	expired := make([]CredentialLease, 0)
+	for rows.Next() {
+		var cur CredentialLease
+		if err := rows.Scan(&cur.Id, &cur.Database, &cur.Template, &cur.Level, &cur.ExpiresAt, &cur.CreatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error reading lease: %w", err)
+		}
+		expired = append(expired, cur)
+	}
+	rows.Close()
+
+	swept := make([]string, 0)
+	errs := make([]error, 0)
+	for _, cur := range expired {
+		log.Printf("[Sweep] Lease %q on %q expired at %s\n", cur.Id, cur.Database, cur.ExpiresAt.Format(time.RFC3339))
+		if err := c.expire(cur); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		swept = append(swept, cur.Id)
+	}
+	if len(errs) > 0 {
+		return swept, multierror.New(errs)
+	}
+	return swept, nil
+}
+
+// grant gives the lease role the privileges of its Template or Level
+func (c *CredentialLeases) grant(obj CredentialLease) error {
+	if obj.Template != "" {
+		log.Printf("Granting %q membership to lease %q\n", obj.Template, obj.Id)
+		_, err := c.RoleMembers.Create(RoleMember{Member: obj.Id, Target: obj.Template})
+		return err
+	}
+	_, err := c.DatabaseAccess.Create(DatabaseAccess{Role: obj.Id, Database: obj.Database, Level: obj.Level})
+	return err
+}
+
+// expire disables login for the lease role, terminates its sessions, reassigns its owned objects in every database,
+// and drops the role
+func (c *CredentialLeases) expire(obj CredentialLease) error {
+	db, err := c.DbOpener.OpenDatabase("")
+	if err != nil {
+		return err
+	}
+
+	quotedRole := pq.QuoteIdentifier(obj.Id)
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM pg_roles WHERE rolname = $1)`, obj.Id).Scan(&exists); err != nil {
+		return stepError(StepReadRole, err)
+	}
+	if exists {
+		log.Printf("Revoking lease %q\n", obj.Id)
+		if _, err := db.Exec(fmt.Sprintf("ALTER ROLE %s NOLOGIN", quotedRole)); err != nil {
+			return stepErrorf(StepAlterRole, "error disabling login for %q: %w", obj.Id, err)
+		}
+		count, err := terminateSessions(db, obj.Id)
+		if err != nil {
+			return err
+		}
+		log.Printf("Terminated %d sessions of %q\n", count, obj.Id)
+		if err := dropOwned(c.DbOpener, obj.Id); err != nil {
+			return err
+		}
+		if _, err := db.Exec(fmt.Sprintf("DROP ROLE %s", quotedRole)); err != nil {
+			return stepErrorf(StepDropRole, "error dropping lease role %q: %w", obj.Id, err)
+		}
+	}
+
+	sq := fmt.Sprintf("DELETE FROM %s WHERE role = $1", MetadataTable(credentialLeasesTable))
+	if _, err := db.Exec(sq, obj.Id); err != nil {
+		return stepErrorf(StepMetadata, "error removing lease record %q: %w", obj.Id, err)
+	}
+	return nil
+}
+
+// template retrieves the configured template role for leases on database
+// A dry-run or recording Store uses the Templates of its parent (see Store.LeaseTemplates)
+func (c *CredentialLeases) template(database string) string {
+	templates := c.Templates
+	if provider, ok := c.DbOpener.(interface{ LeaseTemplates() map[string]string }); ok {
+		templates = provider.LeaseTemplates()
+	}
+	if template, ok := templates[database]; ok {
+		return template
+	}
+	return templates[AnyDatabase]
+}
+
+// LeaseTemplates returns the template roles of credential leases that are configured on the Store
+// A dry-run or recording Store uses the templates of its parent
+func (s *Store) LeaseTemplates() map[string]string {
+	if s.parent != nil {
+		return s.parent.LeaseTemplates()
+	}
+	return s.Credentials.Templates
+}
+
+func (c *CredentialLeases) openMetadata() (DB, error) {
+	db, err := c.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+	columns := `role text PRIMARY KEY,
+	database text NOT NULL,
+	template text NOT NULL DEFAULT '',
+	level text NOT NULL DEFAULT '',
+	expires_at timestamptz NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now()`
+	if err := EnsureMetadataTable(db, credentialLeasesTable, columns); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// connectionUrl builds a connection url for the lease from the admin connection url
+// If the admin connection url is not available (e.g. a dry run), an empty string is returned
+func (c *CredentialLeases) connectionUrl(obj CredentialLease) string {
+	if c.ConnUrl == nil {
+		return ""
+	}
+	u, err := url.Parse(c.ConnUrl())
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	u.User = url.UserPassword(obj.Id, obj.Password)
+	u.Path = "/" + obj.Database
+	return u.String()
+}
+
+// LeaseTemplatesFromEnv reads the template role of leases for each database from the json object in LEASE_TEMPLATES
+// e.g. `{"app": "app_readwrite", "*": "readonly"}`
+func LeaseTemplatesFromEnv() (map[string]string, error) {
+	raw := os.Getenv(LeaseTemplatesEnvVar)
+	if raw == "" {
+		return nil, nil
+	}
+	var templates map[string]string
+	if err := json.Unmarshal([]byte(raw), &templates); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", LeaseTemplatesEnvVar, err)
+	}
+	for database, template := range templates {
+		if template == "" || len(template) > MaxIdentifierLength {
+			return nil, fmt.Errorf("invalid %s: template for %q must be a role name", LeaseTemplatesEnvVar, database)
+		}
+	}
+	return templates, nil
+}
+
+func leaseTtl(raw string) (time.Duration, error) {
+	if raw == "" {
+		return DefaultLeaseTtl, nil
+	}
+	ttl, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, &ValidationError{Field: "ttl", Reason: err.Error()}
+	}
+	if ttl <= 0 || ttl > MaxLeaseTtl {
+		return 0, &ValidationError{Field: "ttl", Reason: fmt.Sprintf("must be between 0 and %s", MaxLeaseTtl)}
+	}
+	return ttl, nil
+}
+
+// leaseRoleName produces the prefix of a lease role name for database
+// Postgres truncates identifiers to 63 bytes, so the database name is shortened to leave room for the random suffix
+func leaseRoleName(database string) string {
+	if len(database) > 48 {
+		database = database[:48]
+	}
+	return fmt.Sprintf("%s_%s", leaseRolePrefix, database)
+}
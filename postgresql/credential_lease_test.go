@@ -0,0 +1,23 @@
+package postgresql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCredentialLeases_Template(t *testing.T) {
+	store := NewStore("")
+	store.Credentials.Templates = map[string]string{"app": "app_readers", AnyDatabase: "readers"}
+
+	dry, _ := store.DryRun()
+	rec, _ := store.Recording()
+	for name, s := range map[string]*Store{"store": store, "dry run": dry, "recording": rec} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, "app_readers", s.Credentials.template("app"))
+			assert.Equal(t, "readers", s.Credentials.template("billing"))
+		})
+	}
+
+	store.Credentials.Templates = nil
+	assert.Equal(t, "", rec.Credentials.template("app"), "no template falls back to database access")
+}
@@ -11,17 +11,21 @@ import (
 	"strings"
 )
 
+// Database is a postgres database
+// Template, Encoding, Collation, and LcCtype can only be set when the database is created
+// The other attributes are altered by Update if they are set
 type Database struct {
-	Name               string `json:"name"`
-	Owner              string `json:"owner"`
-	Template           string `json:"template"`
-	Encoding           string `json:"encoding"`
-	Collation          string `json:"collation"`
-	LcCtype            string `json:"lcCtype"`
-	TablespaceName     string `json:"tablespaceName"`
-	ConnectionLimit    int    `json:"connectionLimit"`
-	IsTemplate         bool   `json:"isTemplate"`
-	DisableConnections bool   `json:"disableConnections"`
+	Name           string `json:"name"`
+	Owner          string `json:"owner"`
+	Template       string `json:"template"`
+	Encoding       string `json:"encoding"`
+	Collation      string `json:"collation"`
+	LcCtype        string `json:"lcCtype"`
+	TablespaceName string `json:"tablespaceName"`
+	// ConnectionLimit is the maximum number of concurrent connections; 0 means no limit
+	ConnectionLimit    *int  `json:"connectionLimit,omitempty"`
+	IsTemplate         *bool `json:"isTemplate,omitempty"`
+	DisableConnections *bool `json:"disableConnections,omitempty"`
 
 	// Do not error if trying to create a database that already exists
 	// Instead, read the existing and return
@@ -39,6 +43,12 @@ type Databases struct {
 }
 
 func (d *Databases) Create(obj Database) (*Database, error) {
+	if err := validateNames(d.DbOpener, true, obj.nameFields()...); err != nil {
+		return nil, err
+	}
+	if err := enforcePolicy(d.DbOpener, obj.policyRefs()...); err != nil {
+		return nil, err
+	}
 	if obj.UseExisting {
 		if existing, err := d.Read(obj.Name); err != nil {
 			return nil, err
@@ -55,7 +65,7 @@ func (d *Databases) Create(obj Database) (*Database, error) {
 
 	info, err := CalcDbConnectionInfo(db)
 	if err != nil {
-		return nil, fmt.Errorf("error analyzing existing databases: %w", err)
+		return nil, stepErrorf(StepAnalyze, "error analyzing existing databases: %w", err)
 	}
 
 	var grant Revoker = NoopRevoker{}
@@ -63,17 +73,17 @@ func (d *Databases) Create(obj Database) (*Database, error) {
 		var err error
 		grant, err = GrantRoleMembership(db, obj.Owner, info.CurrentUser)
 		if err != nil {
-			return nil, fmt.Errorf("error granting temporary membership: %w", err)
+			return nil, stepErrorf(StepGrantTemporaryMembership, "error granting temporary membership: %w", err)
 		}
 	}
 
 	log.Printf("Creating database %q, assigning owner to service user %q\n", obj.Name, obj.Owner)
 	errs := make([]error, 0)
 	if _, err := db.Exec(d.generateCreateSql(obj, info.SupportedFeatures)); err != nil {
-		errs = append(errs, fmt.Errorf("error creating database %q: %w", obj.Name, err))
+		errs = append(errs, stepErrorf(StepCreateDatabase, "error creating database %q: %w", obj.Name, err))
 	}
 	if err := grant.Revoke(db); err != nil {
-		errs = append(errs, fmt.Errorf("error revoking temporary membership: %w", err))
+		errs = append(errs, stepErrorf(StepRevokeTemporaryMembership, "error revoking temporary membership: %w", err))
 	}
 	if len(errs) > 0 {
 		return nil, multierror.New(errs)
@@ -87,22 +97,119 @@ func (d *Databases) Read(key string) (*Database, error) {
 		return nil, err
 	}
 
-	var owner string
-	row := db.QueryRow(`SELECT pg_catalog.pg_get_userbyid(d.datdba) from pg_database d WHERE datname=$1`, key)
-	if err := row.Scan(&owner); err != nil {
+	sq := `SELECT d.datname, pg_catalog.pg_get_userbyid(d.datdba), pg_catalog.pg_encoding_to_char(d.encoding),
+	d.datcollate, d.datctype, COALESCE(t.spcname, ''), d.datconnlimit, d.datistemplate, NOT d.datallowconn
+FROM pg_database d
+LEFT JOIN pg_tablespace t ON t.oid = d.dattablespace
+WHERE d.datname = $1`
+	obj, err := scanDatabase(db.QueryRow(sq, key))
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
+		return nil, stepError(StepReadDatabase, err)
+	}
+	return obj, nil
+}
+
+func scanDatabase(row interface{ Scan(dest ...any) error }) (*Database, error) {
+	var obj Database
+	var connectionLimit int
+	var isTemplate, disableConnections bool
+	err := row.Scan(&obj.Name, &obj.Owner, &obj.Encoding, &obj.Collation, &obj.LcCtype, &obj.TablespaceName,
+		&connectionLimit, &isTemplate, &disableConnections)
+	if err != nil {
 		return nil, err
 	}
-	return &Database{Name: key, Owner: owner}, nil
+	// postgres uses -1 to indicate no connection limit
+	obj.ConnectionLimit = new(max(connectionLimit, 0))
+	obj.IsTemplate = &isTemplate
+	obj.DisableConnections = &disableConnections
+	return &obj, nil
 }
 
+// Update reconciles the owner, tablespace, connection limit, template flag, and allowed connections of the database
+// Attributes that are not set are left unchanged; Encoding, Collation, and LcCtype cannot be changed
 func (d *Databases) Update(key string, obj Database) (*Database, error) {
-	return d.Read(key)
+	if err := validateNames(d.DbOpener, false, requiredName("name", key), optionalReference("owner", obj.Owner)); err != nil {
+		return nil, err
+	}
+	if err := enforcePolicy(d.DbOpener, append(obj.policyRefs(), databaseRef(key))...); err != nil {
+		return nil, err
+	}
+	existing, err := d.Read(key)
+	if err != nil || existing == nil {
+		return existing, err
+	}
+
+	db, err := d.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+	if obj.Owner != "" && obj.Owner != existing.Owner {
+		log.Printf("Changing owner of database %q to %q\n", key, obj.Owner)
+		sq := fmt.Sprintf("ALTER DATABASE %s OWNER TO %s", pq.QuoteIdentifier(key), pq.QuoteIdentifier(obj.Owner))
+		if err := execWithMembership(db, obj.Owner, StepAlterOwner, sq); err != nil {
+			return nil, err
+		}
+		existing.Owner = obj.Owner
+	}
+
+	info, err := CalcDbConnectionInfo(db)
+	if err != nil {
+		return nil, stepErrorf(StepAnalyze, "error analyzing database: %w", err)
+	}
+	// Only the owner (or a superuser) can alter a database
+	for _, sq := range d.generateAlterSql(*existing, obj, info.SupportedFeatures) {
+		log.Printf("Altering database %q\n", key)
+		if err := execWithMembership(db, existing.Owner, StepAlterDatabase, sq); err != nil {
+			return nil, err
+		}
+	}
+	if tablespace := obj.TablespaceName; tablespace != "" && !strings.EqualFold(tablespace, "DEFAULT") {
+		existing.TablespaceName = tablespace
+	}
+	if obj.ConnectionLimit != nil {
+		existing.ConnectionLimit = new(max(*obj.ConnectionLimit, 0))
+	}
+	if obj.IsTemplate != nil && info.SupportedFeatures.IsSupported(FeatureDBIsTemplate) {
+		existing.IsTemplate = obj.IsTemplate
+	}
+	if obj.DisableConnections != nil && info.SupportedFeatures.IsSupported(FeatureDBAllowConnections) {
+		existing.DisableConnections = obj.DisableConnections
+	}
+	return existing, nil
+}
+
+// generateAlterSql generates an ALTER DATABASE statement for each attribute that is set in obj and differs from existing
+// IS_TEMPLATE and ALLOW_CONNECTIONS are skipped if the server does not support them (the same as generateCreateSql)
+func (*Databases) generateAlterSql(existing, obj Database, features Features) []string {
+	prefix := "ALTER DATABASE " + pq.QuoteIdentifier(existing.Name)
+	statements := make([]string, 0)
+	if tablespace := obj.TablespaceName; tablespace != "" && !strings.EqualFold(tablespace, "DEFAULT") && tablespace != existing.TablespaceName {
+		statements = append(statements, fmt.Sprintf("%s SET TABLESPACE %s", prefix, pq.QuoteIdentifier(tablespace)))
+	}
+	if obj.ConnectionLimit != nil && max(*obj.ConnectionLimit, 0) != *existing.ConnectionLimit {
+		// postgres uses -1 to indicate no connection limit
+		limit := *obj.ConnectionLimit
+		if limit <= 0 {
+			limit = -1
+		}
+		statements = append(statements, fmt.Sprintf("%s CONNECTION LIMIT %d", prefix, limit))
+	}
+	if obj.IsTemplate != nil && *obj.IsTemplate != *existing.IsTemplate && features.IsSupported(FeatureDBIsTemplate) {
+		statements = append(statements, fmt.Sprintf("%s IS_TEMPLATE %t", prefix, *obj.IsTemplate))
+	}
+	if obj.DisableConnections != nil && *obj.DisableConnections != *existing.DisableConnections && features.IsSupported(FeatureDBAllowConnections) {
+		statements = append(statements, fmt.Sprintf("%s ALLOW_CONNECTIONS %t", prefix, !*obj.DisableConnections))
+	}
+	return statements
 }
 
 func (d *Databases) Drop(key string) (bool, error) {
+	if err := enforcePolicy(d.DbOpener, databaseRef(key)); err != nil {
+		return false, err
+	}
 	return true, nil
 }
 
@@ -154,16 +261,85 @@ func (*Databases) generateCreateSql(d Database, features Features) string {
 	}
 
 	if features.IsSupported(FeatureDBAllowConnections) {
-		fmt.Fprintf(b, " ALLOW_CONNECTIONS %t", !d.DisableConnections)
+		fmt.Fprintf(b, " ALLOW_CONNECTIONS %t", d.DisableConnections == nil || !*d.DisableConnections)
 	}
 
-	if d.ConnectionLimit > 0 {
-		fmt.Fprint(b, " CONNECTION LIMIT ", d.ConnectionLimit)
+	if d.ConnectionLimit != nil && *d.ConnectionLimit > 0 {
+		fmt.Fprint(b, " CONNECTION LIMIT ", *d.ConnectionLimit)
 	}
 
 	if features.IsSupported(FeatureDBIsTemplate) {
-		fmt.Fprint(b, " IS_TEMPLATE ", d.IsTemplate)
+		fmt.Fprint(b, " IS_TEMPLATE ", d.IsTemplate != nil && *d.IsTemplate)
 	}
 
 	return b.String()
 }
+
+type DatabaseFilter struct {
+	ListOptions
+	Owner      string `json:"owner"`
+	NamePrefix string `json:"namePrefix"`
+}
+
+// List retrieves databases sorted by name
+// System databases (e.g. template0, rdsadmin) are excluded
+func (d *Databases) List(filter DatabaseFilter) (*Page[Database], error) {
+	db, err := d.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+
+	sq := `SELECT d.datname, pg_catalog.pg_get_userbyid(d.datdba), pg_catalog.pg_encoding_to_char(d.encoding),
+	d.datcollate, d.datctype, COALESCE(t.spcname, ''), d.datconnlimit, d.datistemplate, NOT d.datallowconn
+FROM pg_database d
+LEFT JOIN pg_tablespace t ON t.oid = d.dattablespace
+WHERE d.datname <> ALL($1) AND d.datname > $2`
+	args := []any{pq.Array(systemDatabaseNames), filter.PageToken}
+	if filter.Owner != "" {
+		args = append(args, filter.Owner)
+		sq += fmt.Sprintf(" AND pg_catalog.pg_get_userbyid(d.datdba) = $%d", len(args))
+	}
+	if filter.NamePrefix != "" {
+		args = append(args, filter.NamePrefix)
+		sq += fmt.Sprintf(" AND left(d.datname, length($%d)) = $%d", len(args), len(args))
+	}
+	sq += fmt.Sprintf(" ORDER BY d.datname LIMIT %d", filter.limit()+1)
+
+	rows, err := db.Query(sq, args...)
+	if err != nil {
+		return nil, stepErrorf(StepList, "error listing databases: %w", err)
+	}
+	defer rows.Close()
+
+	items := make([]Database, 0)
+	for rows.Next() {
+		cur, err := scanDatabase(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading database: %w", err)
+		}
+		items = append(items, *cur)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing databases: %w", err)
+	}
+	return newPage(items, filter.ListOptions, Database.Key), nil
+}
+
+// listConnectableDatabases retrieves the names of all non-system databases that allow connections
+func listConnectableDatabases(db DB) ([]string, error) {
+	rows, err := db.Query(`SELECT datname FROM pg_database WHERE datallowconn AND datname <> ALL($1) ORDER BY datname`, pq.Array(systemDatabaseNames))
+	if err != nil {
+		return nil, fmt.Errorf("error listing databases: %w", err)
+	}
+	defer rows.Close()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error reading database: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,236 @@
+package postgresql
+
+import (
+	"github.com/nullstone-io/go-rest-api"
+	"log"
+)
+
+// DatabaseAccess grants Role access to Database at Level
+//
+// AccessOwner (the default) is performed in 3 steps:
+// 1. Role is granted membership to the database owner
+// 2. Default privileges on objects created by Role are granted to the database owner
+// 3. Role is granted all privileges on the public schema and the database
+//
+// AccessReadOnly and AccessReadWrite grant Role membership to a group role for the level (see AccessGroupName)
+// The group role is granted privileges on existing objects and default privileges on future objects
+type DatabaseAccess struct {
+	Role     string `json:"role"`
+	Database string `json:"database"`
+	// Level is one of owner, readwrite, readonly
+	// If empty, owner is used
+	Level string `json:"level"`
+}
+
+func (a DatabaseAccess) Key() DatabaseAccessKey {
+	return DatabaseAccessKey{
+		Role:     a.Role,
+		Database: a.Database,
+	}
+}
+
+type DatabaseAccessKey struct {
+	Role     string
+	Database string
+}
+
+var _ rest.DataAccess[DatabaseAccessKey, DatabaseAccess] = &DatabaseAccesses{}
+
+// DatabaseAccesses composes the resources that make up a DatabaseAccess
+type DatabaseAccesses struct {
+	DbOpener         DbOpener
+	Databases        *Databases
+	RoleMembers      *RoleMembers
+	DefaultGrants    *DefaultGrants
+	SchemaPrivileges *SchemaPrivileges
+}
+
+func (a *DatabaseAccesses) Create(obj DatabaseAccess) (*DatabaseAccess, error) {
+	if err := validateNames(a.DbOpener, true, obj.Key().nameFields()...); err != nil {
+		return nil, err
+	}
+	if err := enforcePolicy(a.DbOpener, obj.Key().policyRefs()...); err != nil {
+		return nil, err
+	}
+	if obj.Level == "" {
+		obj.Level = AccessOwner
+	}
+	if err := validateAccessLevel(obj.Level); err != nil {
+		return nil, err
+	}
+	if obj.Level != AccessOwner {
+		if err := validateAccessGroupName(obj.Database, obj.Level); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("Granting %s db access to user %q on database %q\n", obj.Level, obj.Role, obj.Database)
+	owner, err := a.readOwner(obj.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	if obj.Level != AccessOwner {
+		group, err := a.ensureAccessGroup(obj.Database, owner, obj.Level)
+		if err != nil {
+			return nil, err
+		}
+		membership := RoleMember{Member: obj.Role, Target: group, UseExisting: true}
+		if _, err := a.RoleMembers.Create(membership); err != nil {
+			return nil, err
+		}
+		return &obj, nil
+	}
+
+	if obj.Role != owner {
+		log.Printf("Granting %q membership to %q\n", obj.Role, owner)
+		membership := RoleMember{Member: obj.Role, Target: owner, UseExisting: true}
+		if _, err := a.RoleMembers.Create(membership); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("Granting %q default privileges to %q\n", obj.Role, owner)
+	grant := DefaultGrant{Role: obj.Role, Database: obj.Database, Target: owner}
+	if _, err := a.DefaultGrants.Update(grant.Key(), grant); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Granting schema and database privileges on %q to %q\n", obj.Database, obj.Role)
+	privilege := SchemaPrivilege{Role: obj.Role, Database: obj.Database}
+	if _, err := a.SchemaPrivileges.Update(privilege.Key(), privilege); err != nil {
+		return nil, err
+	}
+
+	// Objects created by the new app role must be accessible to existing readonly/readwrite roles
+	if err := a.extendAccessGroups(obj.Database, obj.Role); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// Read verifies the access that Role was granted to Database and reports its Level
+// If the database does not exist or Role was not granted access, nil is returned
+func (a *DatabaseAccesses) Read(key DatabaseAccessKey) (*DatabaseAccess, error) {
+	database, err := a.Databases.Read(key.Database)
+	if err != nil || database == nil {
+		return nil, err
+	}
+
+	if ok, err := a.hasOwnerAccess(key, database.Owner); err != nil {
+		return nil, err
+	} else if ok {
+		return &DatabaseAccess{Role: key.Role, Database: key.Database, Level: AccessOwner}, nil
+	}
+
+	level, err := a.readGroupLevel(key)
+	if err != nil || level == "" {
+		return nil, err
+	}
+	return &DatabaseAccess{Role: key.Role, Database: key.Database, Level: level}, nil
+}
+
+// Update changes the Level of access
+// If the Level changes, the previous access is revoked before the new access is granted
+func (a *DatabaseAccesses) Update(key DatabaseAccessKey, obj DatabaseAccess) (*DatabaseAccess, error) {
+	if err := validateNames(a.DbOpener, false, key.nameFields()...); err != nil {
+		return nil, err
+	}
+	if err := enforcePolicy(a.DbOpener, append(obj.Key().policyRefs(), key.policyRefs()...)...); err != nil {
+		return nil, err
+	}
+	if obj.Level == "" {
+		obj.Level = AccessOwner
+	}
+	if err := validateAccessLevel(obj.Level); err != nil {
+		return nil, err
+	}
+
+	existing, err := a.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.Level != obj.Level {
+		log.Printf("Changing db access of %q on %q from %s to %s\n", key.Role, key.Database, existing.Level, obj.Level)
+		if err := a.revoke(key, existing.Level); err != nil {
+			return nil, err
+		}
+	}
+	return a.Create(obj)
+}
+
+// Drop revokes the access that Role was granted
+// For AccessOwner, each step is revoked in reverse order
+func (a *DatabaseAccesses) Drop(key DatabaseAccessKey) (bool, error) {
+	if err := enforcePolicy(a.DbOpener, key.policyRefs()...); err != nil {
+		return false, err
+	}
+	existing, err := a.Read(key)
+	if err != nil {
+		return false, err
+	}
+	level := AccessOwner
+	if existing != nil {
+		level = existing.Level
+	}
+	if err := a.revoke(key, level); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (a *DatabaseAccesses) revoke(key DatabaseAccessKey, level string) error {
+	database, err := a.Databases.Read(key.Database)
+	if err != nil || database == nil {
+		return err
+	}
+	owner := database.Owner
+
+	if level != AccessOwner {
+		return a.RoleMembers.revoke(RoleMemberKey{Member: key.Role, Target: AccessGroupName(key.Database, level)})
+	}
+
+	log.Printf("Revoking schema and database privileges on %q from %q\n", key.Database, key.Role)
+	if err := a.SchemaPrivileges.revoke(SchemaPrivilegeKey{Role: key.Role, Database: key.Database}); err != nil {
+		return err
+	}
+
+	log.Printf("Revoking %q default privileges from %q\n", key.Role, owner)
+	if err := a.DefaultGrants.revoke(DefaultGrantKey{Role: key.Role, Database: key.Database, Target: owner}); err != nil {
+		return err
+	}
+
+	if key.Role != owner {
+		if err := a.RoleMembers.revoke(RoleMemberKey{Member: key.Role, Target: owner}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasOwnerAccess verifies each step of AccessOwner
+// The owner's own default privileges are implicit and store no pg_default_acl row, so they are not checked for the owner
+func (a *DatabaseAccesses) hasOwnerAccess(key DatabaseAccessKey, owner string) (bool, error) {
+	if key.Role != owner {
+		if membership, err := a.RoleMembers.Read(RoleMemberKey{Member: key.Role, Target: owner}); err != nil || membership == nil {
+			return false, err
+		}
+		if grant, err := a.DefaultGrants.Read(DefaultGrantKey{Role: key.Role, Database: key.Database, Target: owner}); err != nil || grant == nil {
+			return false, err
+		}
+	}
+	if privilege, err := a.SchemaPrivileges.Read(SchemaPrivilegeKey{Role: key.Role, Database: key.Database}); err != nil || privilege == nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (a *DatabaseAccesses) readOwner(databaseName string) (string, error) {
+	database, err := a.Databases.Read(databaseName)
+	if err != nil {
+		return "", err
+	} else if database == nil {
+		return "", stepErrorf(StepReadDatabase, "database %q does not exist", databaseName)
+	}
+	return database.Owner, nil
+}
@@ -0,0 +1,314 @@
+package postgresql
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"log"
+	"sort"
+	"strings"
+)
+
+const (
+	// AccessOwner grants membership to the database owner (i.e. all privileges)
+	AccessOwner = "owner"
+	// AccessReadWrite grants read and write access to data, but does not permit changing the schema
+	AccessReadWrite = "readwrite"
+	// AccessReadOnly grants read access to data
+	AccessReadOnly = "readonly"
+)
+
+// accessProfile defines the privileges that are granted to the group role of an access level
+type accessProfile struct {
+	Database  string
+	Schemas   string
+	Tables    string
+	Sequences string
+}
+
+var accessProfiles = map[string]accessProfile{
+	AccessReadOnly: {
+		Database:  "CONNECT",
+		Schemas:   "USAGE",
+		Tables:    "SELECT",
+		Sequences: "SELECT",
+	},
+	AccessReadWrite: {
+		Database:  "CONNECT, TEMPORARY",
+		Schemas:   "USAGE",
+		Tables:    "SELECT, INSERT, UPDATE, DELETE",
+		Sequences: "USAGE, SELECT, UPDATE",
+	},
+}
+
+// groupLevels are the access levels that are granted through a group role, in order of precedence
+var groupLevels = []string{AccessReadWrite, AccessReadOnly}
+
+// AccessGroupName is the name of the group role that holds the privileges for level in database
+// Roles are granted readonly or readwrite access by becoming a member of this group role
+func AccessGroupName(database, level string) string {
+	return fmt.Sprintf("%s_%s", database, level)
+}
+
+// accessGroupComment is the comment on an access group role
+// A role with the group name is only used as the access group if it has this comment (see readAccessGroup)
+func accessGroupComment(database, level string) string {
+	return fmt.Sprintf("pg-db-admin %s access group for database %s", level, database)
+}
+
+// validateAccessGroupName verifies that the name of the access group for level in database is not truncated by postgres
+func validateAccessGroupName(database, level string) error {
+	if group := AccessGroupName(database, level); len(group) > MaxIdentifierLength {
+		return &ValidationError{
+			Field:  "database",
+			Reason: fmt.Sprintf("%q is too long for %s access; the group role %q must be at most %d bytes", database, level, group, MaxIdentifierLength),
+		}
+	}
+	return nil
+}
+
+// readAccessGroup reports whether the access group for level in database exists
+// verified is false if a role with the group name exists, but it was not created by pg-db-admin as an access group
+// (e.g. an app role named <database>_readonly); such a role is never used as an access group
+func readAccessGroup(db DB, database, level string) (exists bool, verified bool, err error) {
+	var canLogin bool
+	var comment sql.NullString
+	sq := `SELECT rolcanlogin, shobj_description(oid, 'pg_authid') FROM pg_roles WHERE rolname = $1`
+	if err := db.QueryRow(sq, AccessGroupName(database, level)).Scan(&canLogin, &comment); err == sql.ErrNoRows {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, stepError(StepReadRole, err)
+	}
+	return true, !canLogin && comment.String == accessGroupComment(database, level), nil
+}
+
+func validateAccessLevel(level string) error {
+	if level == AccessOwner {
+		return nil
+	}
+	if _, ok := accessProfiles[level]; ok {
+		return nil
+	}
+	return &ValidationError{
+		Field:  "level",
+		Reason: fmt.Sprintf("%q is not one of %s, %s, %s", level, AccessOwner, AccessReadWrite, AccessReadOnly),
+	}
+}
+
+// ensureAccessGroup creates the group role for level in database and grants the privileges of its profile
+// Privileges are granted on every existing object
+// Default privileges are granted on future objects that are created by the database owner or an app role (see appRoles)
+// This is safe to run multiple times; running it again grants privileges on objects that were created since
+func (a *DatabaseAccesses) ensureAccessGroup(database, owner, level string) (string, error) {
+	group := AccessGroupName(database, level)
+	profile := accessProfiles[level]
+
+	db, err := a.DbOpener.OpenDatabase(database)
+	if err != nil {
+		return "", err
+	}
+
+	exists, verified, err := readAccessGroup(db, database, level)
+	if err != nil {
+		return "", err
+	}
+	if exists && !verified {
+		return "", &ValidationError{
+			Field:  "database",
+			Reason: fmt.Sprintf("role %q already exists and is not a pg-db-admin %s access group for %q", group, level, database),
+		}
+	}
+	if !exists {
+		log.Printf("Creating %s group role %q\n", level, group)
+		sq := fmt.Sprintf("CREATE ROLE %[1]s NOLOGIN; COMMENT ON ROLE %[1]s IS %[2]s", pq.QuoteIdentifier(group), pq.QuoteLiteral(accessGroupComment(database, level)))
+		if _, err := db.Exec(sq); err != nil {
+			return "", stepErrorf(StepCreateRole, "error creating group role %q: %w", group, err)
+		}
+	}
+	info, err := CalcDbConnectionInfo(db)
+	if err != nil {
+		return "", stepErrorf(StepAnalyze, "error analyzing database: %w", err)
+	}
+
+	quotedGroup := pq.QuoteIdentifier(group)
+	log.Printf("Granting %s privileges on %q to %q\n", level, database, group)
+	sq := fmt.Sprintf("GRANT %s ON DATABASE %s TO %s", profile.Database, pq.QuoteIdentifier(database), quotedGroup)
+	if err := execWithMembership(db, owner, StepGrantPrivileges, sq); err != nil {
+		return "", err
+	}
+
+	// Grants on existing objects must be performed by (or on behalf of) the object owner
+	statementsByOwner, err := existingObjectGrants(db, owner, profile, quotedGroup)
+	if err != nil {
+		return "", err
+	}
+	for _, objOwner := range sortedKeys(statementsByOwner) {
+		if err := execWithMembership(db, objOwner, StepGrantPrivileges, strings.Join(statementsByOwner[objOwner], " ")); err != nil {
+			return "", err
+		}
+	}
+
+	creators, err := appRoles(db, owner)
+	if err != nil {
+		return "", err
+	}
+	for _, creator := range append([]string{owner}, creators...) {
+		if err := alterGroupDefaultPrivileges(db, info.SupportedFeatures, creator, group, profile); err != nil {
+			return "", err
+		}
+	}
+	return group, nil
+}
+
+// existingObjectGrants generates GRANT statements for every schema, table, and sequence in the database
+// The statements are grouped by the owner of each object
+// Objects owned by pg_database_owner (e.g. the public schema since postgres 15) are granted by the database owner
+// Objects owned by other system roles are skipped
+func existingObjectGrants(db DB, dbOwner string, profile accessProfile, quotedGroup string) (map[string][]string, error) {
+	sq := `SELECT n.nspname, '', 'n', pg_get_userbyid(n.nspowner) FROM pg_namespace n
+WHERE n.nspname <> 'information_schema' AND left(n.nspname, 3) <> 'pg_'
+UNION ALL
+SELECT n.nspname, c.relname, c.relkind, pg_get_userbyid(c.relowner)
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind IN ('r', 'p', 'v', 'm', 'f', 'S') AND n.nspname <> 'information_schema' AND left(n.nspname, 3) <> 'pg_'`
+	rows, err := db.Query(sq)
+	if err != nil {
+		return nil, stepErrorf(StepReadPrivileges, "error listing schema objects: %w", err)
+	}
+	defer rows.Close()
+
+	statements := map[string][]string{}
+	for rows.Next() {
+		var schema, name, kind, owner string
+		if err := rows.Scan(&schema, &name, &kind, &owner); err != nil {
+			return nil, fmt.Errorf("error reading schema object: %w", err)
+		}
+		if owner == "pg_database_owner" {
+			owner = dbOwner
+		} else if IsSystemRole(owner) {
+			continue
+		}
+		var stmt string
+		switch kind {
+		case "n":
+			stmt = fmt.Sprintf("GRANT %s ON SCHEMA %s TO %s;", profile.Schemas, pq.QuoteIdentifier(schema), quotedGroup)
+		case "S":
+			stmt = fmt.Sprintf("GRANT %s ON SEQUENCE %s.%s TO %s;", profile.Sequences, pq.QuoteIdentifier(schema), pq.QuoteIdentifier(name), quotedGroup)
+		default:
+			stmt = fmt.Sprintf("GRANT %s ON TABLE %s.%s TO %s;", profile.Tables, pq.QuoteIdentifier(schema), pq.QuoteIdentifier(name), quotedGroup)
+		}
+		statements[owner] = append(statements[owner], stmt)
+	}
+	return statements, rows.Err()
+}
+
+// alterGroupDefaultPrivileges grants the privileges of profile on future objects created by creator to group
+// Before postgres 10, default privileges cannot be granted on schemas, so new schemas must be granted by running Create again
+func alterGroupDefaultPrivileges(db DB, features Features, creator, group string, profile accessProfile) error {
+	quotedCreator := pq.QuoteIdentifier(creator)
+	quotedGroup := pq.QuoteIdentifier(group)
+	statements := make([]string, 0)
+	if features.IsSupported(FeatureDefaultPrivilegesOnSchemas) {
+		statements = append(statements, fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s GRANT %s ON SCHEMAS TO %s;", quotedCreator, profile.Schemas, quotedGroup))
+	}
+	statements = append(statements,
+		fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s GRANT %s ON TABLES TO %s;", quotedCreator, profile.Tables, quotedGroup),
+		fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s GRANT %s ON SEQUENCES TO %s;", quotedCreator, profile.Sequences, quotedGroup),
+	)
+	sq := strings.Join(statements, " ")
+	log.Printf("Granting default privileges on objects created by %q to %q\n", creator, group)
+	return execWithMembership(db, creator, StepAlterDefaultPrivileges, sq)
+}
+
+// extendAccessGroups grants the privileges of every existing access group in database on future objects created by role
+// This keeps readonly/readwrite roles working when a new app role is granted owner access
+func (a *DatabaseAccesses) extendAccessGroups(database, role string) error {
+	db, err := a.DbOpener.OpenDatabase(database)
+	if err != nil {
+		return err
+	}
+	info, err := CalcDbConnectionInfo(db)
+	if err != nil {
+		return stepErrorf(StepAnalyze, "error analyzing database: %w", err)
+	}
+	for _, level := range groupLevels {
+		if _, verified, err := readAccessGroup(db, database, level); err != nil {
+			return err
+		} else if verified {
+			if err := alterGroupDefaultPrivileges(db, info.SupportedFeatures, role, AccessGroupName(database, level), accessProfiles[level]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// appRoles retrieves the roles that have owner access to the database (i.e. direct members of owner)
+// These roles create schema objects on behalf of the owner
+// System roles and the current user are excluded
+func appRoles(db DB, owner string) ([]string, error) {
+	sq := `SELECT DISTINCT pg_get_userbyid(m.member)
+FROM pg_auth_members m
+WHERE pg_get_userbyid(m.roleid) = $1 AND pg_get_userbyid(m.member) <> CURRENT_USER AND ` + excludeSystemRolesSql("pg_get_userbyid(m.member)") + `
+ORDER BY 1`
+	rows, err := db.Query(sq, owner)
+	if err != nil {
+		return nil, stepErrorf(StepReadMembership, "error listing members of %q: %w", owner, err)
+	}
+	defer rows.Close()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error reading role member: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// IsAccessGroup returns true if the access group for level in database was created by pg-db-admin
+func (a *DatabaseAccesses) IsAccessGroup(database, level string) (bool, error) {
+	db, err := a.DbOpener.OpenDatabase("")
+	if err != nil {
+		return false, err
+	}
+	_, verified, err := readAccessGroup(db, database, level)
+	return verified, err
+}
+
+// readGroupLevel determines whether role is a member of an access group in database
+// If role is not a member of any access group, an empty string is returned
+func (a *DatabaseAccesses) readGroupLevel(key DatabaseAccessKey) (string, error) {
+	db, err := a.DbOpener.OpenDatabase("")
+	if err != nil {
+		return "", err
+	}
+	for _, level := range groupLevels {
+		_, verified, err := readAccessGroup(db, key.Database, level)
+		if err != nil {
+			return "", err
+		}
+		if !verified {
+			continue
+		}
+		membership, err := a.RoleMembers.Read(RoleMemberKey{Member: key.Role, Target: AccessGroupName(key.Database, level)})
+		if err != nil {
+			return "", err
+		}
+		if membership != nil {
+			return level, nil
+		}
+	}
+	return "", nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -8,14 +8,23 @@ import (
 	"unicode"
 )
 
+const (
+	FlavorPostgres = "postgres"
+	FlavorRds      = "rds"
+	FlavorCloudSql = "cloudsql"
+	FlavorAzure    = "azure"
+)
+
 type DbInfo struct {
 	DbVersion         semver.Version
 	SupportedFeatures Features
 	IsSuperuser       bool
 	CurrentUser       string
+	// Flavor is the managed service that hosts the server (see detectFlavor)
+	Flavor string
 }
 
-func CalcDbConnectionInfo(db *sql.DB) (*DbInfo, error) {
+func CalcDbConnectionInfo(db DB) (*DbInfo, error) {
 	dci := &DbInfo{}
 
 	var superuser bool
@@ -33,11 +42,14 @@ func CalcDbConnectionInfo(db *sql.DB) (*DbInfo, error) {
 	}
 	dci.SupportedFeatures = CalcSupportedFeatures(dci.DbVersion)
 	dci.CurrentUser, err = getCurrentUser(db)
+	if dci.Flavor, err = detectFlavor(db); err != nil {
+		return nil, err
+	}
 
 	return dci, nil
 }
 
-func detectDbVersion(db *sql.DB) (semver.Version, error) {
+func detectDbVersion(db DB) (semver.Version, error) {
 	var pgVersion string
 	err := db.QueryRow(`SELECT VERSION()`).Scan(&pgVersion)
 	if err != nil {
@@ -61,7 +73,21 @@ func detectDbVersion(db *sql.DB) (semver.Version, error) {
 	return version, nil
 }
 
-func getCurrentUser(db *sql.DB) (string, error) {
+// detectFlavor identifies the managed service from the roles that it creates in every instance
+func detectFlavor(db DB) (string, error) {
+	var flavor string
+	sq := `SELECT CASE
+	WHEN EXISTS(SELECT 1 FROM pg_roles WHERE rolname = 'rdsadmin') THEN 'rds'
+	WHEN EXISTS(SELECT 1 FROM pg_roles WHERE rolname = 'cloudsqladmin') THEN 'cloudsql'
+	WHEN EXISTS(SELECT 1 FROM pg_roles WHERE rolname = 'azure_superuser') THEN 'azure'
+	ELSE 'postgres' END`
+	if err := db.QueryRow(sq).Scan(&flavor); err != nil {
+		return "", fmt.Errorf("error detecting database flavor: %w", err)
+	}
+	return flavor, nil
+}
+
+func getCurrentUser(db DB) (string, error) {
 	var currentUser string
 	err := db.QueryRow("SELECT CURRENT_USER").Scan(&currentUser)
 	switch {
@@ -5,6 +5,7 @@ import (
 	"github.com/go-multierror/multierror"
 	"github.com/lib/pq"
 	"github.com/nullstone-io/go-rest-api"
+	"sort"
 	"strings"
 )
 
@@ -42,11 +43,35 @@ type DefaultGrants struct {
 }
 
 func (g *DefaultGrants) Create(grant DefaultGrant) (*DefaultGrant, error) {
+	if err := validateNames(g.DbOpener, true, grant.Key().nameFields()...); err != nil {
+		return nil, err
+	}
+	if err := enforcePolicy(g.DbOpener, grant.Key().policyRefs()...); err != nil {
+		return nil, err
+	}
 	return g.Update(grant.Key(), grant)
 }
 
+// Read verifies that default privileges for tables, sequences, functions, and types created by Role
+// are granted to Target in Database
+// If any default privilege is missing, nil is returned
 func (g *DefaultGrants) Read(key DefaultGrantKey) (*DefaultGrant, error) {
-	// TODO: Introspect
+	db, err := g.DbOpener.OpenDatabase(key.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	// defaclobjtype: r = tables, S = sequences, f = functions, T = types
+	sq := `SELECT count(DISTINCT acl.defaclobjtype)
+FROM (SELECT defaclrole, defaclobjtype, (aclexplode(defaclacl)).grantee FROM pg_default_acl WHERE defaclnamespace = 0) acl
+WHERE pg_get_userbyid(acl.defaclrole) = $1 AND pg_get_userbyid(acl.grantee) = $2 AND acl.defaclobjtype IN ('r', 'S', 'f', 'T')`
+	var objTypes int
+	if err := db.QueryRow(sq, key.Role, key.Target).Scan(&objTypes); err != nil {
+		return nil, stepError(StepReadPrivileges, err)
+	}
+	if objTypes < 4 {
+		return nil, nil
+	}
 	grant := DefaultGrant{
 		Role:     key.Role,
 		Database: key.Database,
@@ -56,53 +81,136 @@ func (g *DefaultGrants) Read(key DefaultGrantKey) (*DefaultGrant, error) {
 	return &grant, nil
 }
 
+// Update grants the default privileges of the role, target, and database in key
+// The policy is also enforced on grant so that a body cannot refer to a different, protected object
 func (g *DefaultGrants) Update(key DefaultGrantKey, grant DefaultGrant) (*DefaultGrant, error) {
-	db, err := g.DbOpener.OpenDatabase(grant.Database)
-	if err != nil {
+	if err := validateNames(g.DbOpener, false, key.nameFields()...); err != nil {
 		return nil, err
 	}
+	if err := enforcePolicy(g.DbOpener, append(grant.Key().policyRefs(), key.policyRefs()...)...); err != nil {
+		return nil, err
+	}
+	grant.Role, grant.Target, grant.Database = key.Role, key.Target, key.Database
+	if err := g.alterDefaultPrivileges(key, "GRANT ALL PRIVILEGES ON %s TO %s;"); err != nil {
+		return nil, err
+	}
+	grant.SetId()
+	return &grant, nil
+}
+
+// revoke removes the default privileges that were granted by Update
+func (g *DefaultGrants) revoke(key DefaultGrantKey) error {
+	return g.alterDefaultPrivileges(key, "REVOKE ALL PRIVILEGES ON %s FROM %s;")
+}
+
+// alterDefaultPrivileges alters the default privileges for objects created by key.Role for every object type
+// action is a format string that receives the object type and the quoted Target (e.g. `GRANT ALL PRIVILEGES ON %s TO %s;`)
+func (g *DefaultGrants) alterDefaultPrivileges(key DefaultGrantKey, action string) error {
+	db, err := g.DbOpener.OpenDatabase(key.Database)
+	if err != nil {
+		return err
+	}
 
 	info, err := CalcDbConnectionInfo(db)
 	if err != nil {
-		return nil, fmt.Errorf("error analyzing database: %w", err)
+		return stepErrorf(StepAnalyze, "error analyzing database: %w", err)
 	}
 
 	var revoker Revoker = NoopRevoker{}
 	var tempErr error
 	if !info.IsSuperuser {
-		revoker, tempErr = GrantRoleMembership(db, grant.Role, info.CurrentUser)
+		revoker, tempErr = GrantRoleMembership(db, key.Role, info.CurrentUser)
 		// We only care about this error if the privilege sql didn't work down below
 	}
 
-	quotedUserName := pq.QuoteIdentifier(grant.Role)
-	quotedTarget := pq.QuoteIdentifier(grant.Target)
+	quotedUserName := pq.QuoteIdentifier(key.Role)
+	quotedTarget := pq.QuoteIdentifier(key.Target)
 
-	sq := strings.Join([]string{
-		fmt.Sprintf(`ALTER DEFAULT PRIVILEGES FOR ROLE %s GRANT ALL PRIVILEGES ON TABLES TO %s;`, quotedUserName, quotedTarget),
-		fmt.Sprintf(`ALTER DEFAULT PRIVILEGES FOR ROLE %s GRANT ALL PRIVILEGES ON SEQUENCES TO %s;`, quotedUserName, quotedTarget),
-		fmt.Sprintf(`ALTER DEFAULT PRIVILEGES FOR ROLE %s GRANT ALL PRIVILEGES ON FUNCTIONS TO %s;`, quotedUserName, quotedTarget),
-		fmt.Sprintf(`ALTER DEFAULT PRIVILEGES FOR ROLE %s GRANT ALL PRIVILEGES ON TYPES TO %s;`, quotedUserName, quotedTarget),
-		fmt.Sprintf(`ALTER DEFAULT PRIVILEGES FOR ROLE %s GRANT ALL PRIVILEGES ON SCHEMAS TO %s;`, quotedUserName, quotedTarget),
-	}, " ")
+	statements := make([]string, 0)
+	for _, objType := range []string{"TABLES", "SEQUENCES", "FUNCTIONS", "TYPES", "SCHEMAS"} {
+		statements = append(statements, fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s "+action, quotedUserName, objType, quotedTarget))
+	}
+	sq := strings.Join(statements, " ")
 	errs := make([]error, 0)
 	if _, err := db.Exec(sq); err != nil {
 		if tempErr != nil {
-			errs = append(errs, fmt.Errorf("error granting temporary membership: %w", tempErr))
+			errs = append(errs, stepErrorf(StepGrantTemporaryMembership, "error granting temporary membership: %w", tempErr))
 		}
-		errs = append(errs, fmt.Errorf("error altering default privileges: %w", err))
+		errs = append(errs, stepErrorf(StepAlterDefaultPrivileges, "error altering default privileges: %w", err))
 	}
 	if revoker != nil {
 		if revokeErr := revoker.Revoke(db); revokeErr != nil {
-			errs = append(errs, fmt.Errorf("error revoking temporary membership: %w", revokeErr))
+			errs = append(errs, stepErrorf(StepRevokeTemporaryMembership, "error revoking temporary membership: %w", revokeErr))
 		}
 	}
 	if len(errs) > 0 {
-		return nil, multierror.New(errs)
+		return multierror.New(errs)
 	}
-	grant.SetId()
-	return &grant, nil
+	return nil
 }
 
 func (g *DefaultGrants) Drop(key DefaultGrantKey) (bool, error) {
+	if err := enforcePolicy(g.DbOpener, key.policyRefs()...); err != nil {
+		return false, err
+	}
 	return true, nil
 }
+
+type DefaultGrantFilter struct {
+	ListOptions
+	// Role limits results to default privileges for objects created by Role
+	// If empty, default privileges of every non-system role are listed
+	Role string `json:"role"`
+	// Database limits results to a single database
+	// If empty, every database that allows connections is inspected
+	Database string `json:"database"`
+}
+
+// List retrieves the default grants for schema objects created by Role sorted by Role and Id
+// Default privileges are stored per database, so this connects to each database that is inspected
+func (g *DefaultGrants) List(filter DefaultGrantFilter) (*Page[DefaultGrant], error) {
+	databases := []string{filter.Database}
+	if filter.Database == "" {
+		db, err := g.DbOpener.OpenDatabase("")
+		if err != nil {
+			return nil, err
+		}
+		if databases, err = listConnectableDatabases(db); err != nil {
+			return nil, err
+		}
+	}
+
+	items := make([]DefaultGrant, 0)
+	for _, database := range databases {
+		db, err := g.DbOpener.OpenDatabase(database)
+		if err != nil {
+			return nil, err
+		}
+		// We only inspect default privileges that are not scoped to a schema
+		// This matches the privileges that are configured by Update
+		sq := `SELECT DISTINCT pg_get_userbyid(acl.defaclrole), pg_get_userbyid(acl.grantee)
+FROM (SELECT defaclrole, (aclexplode(defaclacl)).grantee FROM pg_default_acl WHERE defaclnamespace = 0) acl
+WHERE ($1 = '' OR pg_get_userbyid(acl.defaclrole) = $1) AND acl.grantee <> acl.defaclrole AND acl.grantee <> 0
+	AND ` + excludeSystemRolesSql("pg_get_userbyid(acl.defaclrole)")
+		rows, err := db.Query(sq, filter.Role)
+		if err != nil {
+			return nil, stepErrorf(StepList, "error listing default grants in database %q: %w", database, err)
+		}
+		for rows.Next() {
+			grant := DefaultGrant{Database: database}
+			if err := rows.Scan(&grant.Role, &grant.Target); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error reading default grant: %w", err)
+			}
+			grant.SetId()
+			items = append(items, grant)
+		}
+		rows.Close()
+	}
+
+	keyFn := func(g DefaultGrant) string { return g.Role + "/" + g.Id }
+	sort.Slice(items, func(i, j int) bool {
+		return keyFn(items[i]) < keyFn(items[j])
+	})
+	return paginate(items, filter.ListOptions, keyFn), nil
+}
@@ -0,0 +1,308 @@
+package postgresql
+
+import (
+	"database/sql"
+	"github.com/lib/pq"
+	"sort"
+)
+
+const (
+	// PublicRole is the pseudo-role that every role is a member of
+	PublicRole = "PUBLIC"
+)
+
+// userNamespaceFilter excludes the schemas that are managed by postgres
+const userNamespaceFilter = `n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'`
+
+// aclObjectsSql lists every object in the current database that has privileges with its owner and ACL
+// A NULL ACL means the object has the default privileges of its type (see acldefault)
+const aclObjectsSql = `SELECT 'database' AS object_type, '' AS schema_name, datname::text AS object_name, datdba AS owner,
+	COALESCE(datacl, acldefault('d', datdba)) AS acl
+FROM pg_database WHERE datname = current_database()
+UNION ALL
+SELECT 'schema', '', n.nspname::text, n.nspowner, COALESCE(n.nspacl, acldefault('n', n.nspowner))
+FROM pg_namespace n WHERE ` + userNamespaceFilter + `
+UNION ALL
+SELECT CASE WHEN c.relkind = 'S' THEN 'sequence' ELSE 'table' END, n.nspname::text, c.relname::text, c.relowner,
+	COALESCE(c.relacl, acldefault((CASE WHEN c.relkind = 'S' THEN 's' ELSE 'r' END)::"char", c.relowner))
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind IN ('r', 'p', 'v', 'm', 'f', 'S') AND ` + userNamespaceFilter + `
+UNION ALL
+SELECT 'function', n.nspname::text, p.proname || '(' || pg_get_function_identity_arguments(p.oid) || ')', p.proowner,
+	COALESCE(p.proacl, acldefault('f', p.proowner))
+FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+WHERE ` + userNamespaceFilter
+
+// defaultAclObjectTypes maps pg_default_acl.defaclobjtype to the type of object that receives the default privileges
+var defaultAclObjectTypes = map[string]string{
+	"r": "table",
+	"S": "sequence",
+	"f": "function",
+	"T": "type",
+	"n": "schema",
+}
+
+// EffectivePrivileges is everything that Role is able to do in Database
+// Privileges of other roles are included if Role inherits them through its memberships
+type EffectivePrivileges struct {
+	Role     string `json:"role"`
+	Database string `json:"database"`
+	// Superuser bypasses every privilege check, so a superuser can do more than Privileges reports
+	Superuser bool `json:"superuser"`
+	// Roles contains Role, PUBLIC, and every role whose privileges Role inherits
+	Roles             []InheritedRole        `json:"roles"`
+	Privileges        []ObjectPrivilege      `json:"privileges"`
+	DefaultPrivileges []DefaultPrivilegeRule `json:"defaultPrivileges"`
+	Ownership         []OwnedObject          `json:"ownership"`
+}
+
+// InheritedRole is a role whose privileges are inherited
+// Path is the chain of memberships from the inspected role (e.g. [app, readers])
+type InheritedRole struct {
+	Role string   `json:"role"`
+	Path []string `json:"path"`
+}
+
+// ObjectPrivilege contains the privileges on an object that are granted to Grantee
+type ObjectPrivilege struct {
+	// ObjectType is database, schema, table, sequence, or function
+	ObjectType string   `json:"objectType"`
+	Schema     string   `json:"schema,omitempty"`
+	Name       string   `json:"name"`
+	Privileges []string `json:"privileges"`
+	// GrantOption contains the Privileges that Grantee may grant to other roles
+	GrantOption []string `json:"grantOption"`
+	Grantee     string   `json:"grantee"`
+	// Inherited is true if Grantee is not the inspected role
+	Inherited bool     `json:"inherited"`
+	Path      []string `json:"path"`
+}
+
+// DefaultPrivilegeRule contains the privileges that Grantee receives on new objects created by Creator
+type DefaultPrivilegeRule struct {
+	Creator string `json:"creator"`
+	// Schema is empty if the rule applies to every schema
+	Schema string `json:"schema,omitempty"`
+	// ObjectType is table, sequence, function, type, or schema
+	ObjectType  string   `json:"objectType"`
+	Privileges  []string `json:"privileges"`
+	GrantOption []string `json:"grantOption"`
+	Grantee     string   `json:"grantee"`
+	Inherited   bool     `json:"inherited"`
+	Path        []string `json:"path"`
+}
+
+// OwnedObject is an object owned by Owner
+// An owner holds every privilege on the object and can grant them to other roles
+type OwnedObject struct {
+	ObjectType string   `json:"objectType"`
+	Schema     string   `json:"schema,omitempty"`
+	Name       string   `json:"name"`
+	Owner      string   `json:"owner"`
+	Inherited  bool     `json:"inherited"`
+	Path       []string `json:"path"`
+}
+
+// LoadInheritanceGraph reads the role memberships whose privileges are inherited by the member
+// Before postgres 16, a member inherits every membership if the member has INHERIT
+// Since postgres 16, each membership is granted WITH INHERIT TRUE or FALSE
+func LoadInheritanceGraph(db DB, info *DbInfo) (*MembershipGraph, error) {
+	sq := `SELECT pg_get_userbyid(am.member), pg_get_userbyid(am.roleid)
+FROM pg_auth_members am JOIN pg_roles m ON m.oid = am.member
+WHERE m.rolinherit`
+	if info.SupportedFeatures.IsSupported(FeatureMembershipInheritOption) {
+		sq = `SELECT pg_get_userbyid(am.member), pg_get_userbyid(am.roleid)
+FROM pg_auth_members am
+GROUP BY am.member, am.roleid HAVING bool_or(am.inherit_option)`
+	}
+	rows, err := db.Query(sq)
+	if err != nil {
+		return nil, stepErrorf(StepReadMembership, "error reading role memberships: %w", err)
+	}
+	defer rows.Close()
+
+	g := &MembershipGraph{memberOf: map[string][]string{}}
+	for rows.Next() {
+		var member, target string
+		if err := rows.Scan(&member, &target); err != nil {
+			return nil, stepErrorf(StepReadMembership, "error reading role membership: %w", err)
+		}
+		g.Add(member, target)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stepErrorf(StepReadMembership, "error reading role memberships: %w", err)
+	}
+	return g, nil
+}
+
+// EffectivePrivileges reads the privileges that role has in database, directly or through inherited memberships
+// If role or database does not exist, nil is returned
+func (r *Roles) EffectivePrivileges(role, database string) (*EffectivePrivileges, error) {
+	if database == "" {
+		return nil, &ValidationError{Field: "database", Reason: "is required"}
+	}
+	db, err := r.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+	result := &EffectivePrivileges{Role: role, Database: database}
+	if err := db.QueryRow(`SELECT rolsuper FROM pg_roles WHERE rolname = $1`, role).Scan(&result.Superuser); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, stepError(StepReadRole, err)
+	}
+	var dbExists bool
+	if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM pg_database WHERE datname = $1)`, database).Scan(&dbExists); err != nil {
+		return nil, stepError(StepReadDatabase, err)
+	} else if !dbExists {
+		return nil, nil
+	}
+
+	info, err := CalcDbConnectionInfo(db)
+	if err != nil {
+		return nil, stepErrorf(StepAnalyze, "error analyzing database: %w", err)
+	}
+	g, err := LoadInheritanceGraph(db, info)
+	if err != nil {
+		return nil, err
+	}
+	paths := g.Paths(role)
+	paths[PublicRole] = []string{role, PublicRole}
+	grantees := make([]string, 0, len(paths))
+	for name := range paths {
+		grantees = append(grantees, name)
+	}
+	sort.Strings(grantees)
+	result.Roles = make([]InheritedRole, 0, len(grantees))
+	for _, name := range grantees {
+		result.Roles = append(result.Roles, InheritedRole{Role: name, Path: paths[name]})
+	}
+
+	targetDb, err := r.DbOpener.OpenDatabase(database)
+	if err != nil {
+		return nil, err
+	}
+	if result.Privileges, err = readObjectPrivileges(targetDb, role, paths, grantees); err != nil {
+		return nil, err
+	}
+	if result.DefaultPrivileges, err = readDefaultPrivilegeRules(targetDb, role, paths, grantees); err != nil {
+		return nil, err
+	}
+	if result.Ownership, err = readOwnedObjects(targetDb, role, paths, grantees); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func readObjectPrivileges(db DB, role string, paths map[string][]string, grantees []string) ([]ObjectPrivilege, error) {
+	sq := `SELECT object_type, schema_name, object_name, grantee, privilege_type, is_grantable
+FROM (SELECT o.object_type, o.schema_name, o.object_name, a.privilege_type, a.is_grantable,
+		CASE WHEN a.grantee = 0 THEN 'PUBLIC' ELSE pg_get_userbyid(a.grantee) END AS grantee
+	FROM (` + aclObjectsSql + `) o, aclexplode(o.acl) a) acl
+WHERE grantee = ANY($1)
+ORDER BY 1, 2, 3, 4, 5`
+	rows, err := db.Query(sq, pq.Array(grantees))
+	if err != nil {
+		return nil, stepErrorf(StepReadPrivileges, "error reading privileges: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]ObjectPrivilege, 0)
+	for rows.Next() {
+		var cur ObjectPrivilege
+		var privilege string
+		var grantable bool
+		if err := rows.Scan(&cur.ObjectType, &cur.Schema, &cur.Name, &cur.Grantee, &privilege, &grantable); err != nil {
+			return nil, stepErrorf(StepReadPrivileges, "error reading privileges: %w", err)
+		}
+		// Rows are ordered so that the privileges of the same object and grantee are adjacent
+		if n := len(result); n == 0 || !result[n-1].sameGrant(cur) {
+			cur.Privileges, cur.GrantOption = make([]string, 0), make([]string, 0)
+			cur.Inherited, cur.Path = cur.Grantee != role, paths[cur.Grantee]
+			result = append(result, cur)
+		}
+		last := &result[len(result)-1]
+		last.Privileges = append(last.Privileges, privilege)
+		if grantable {
+			last.GrantOption = append(last.GrantOption, privilege)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stepErrorf(StepReadPrivileges, "error reading privileges: %w", err)
+	}
+	return result, nil
+}
+
+func (p ObjectPrivilege) sameGrant(other ObjectPrivilege) bool {
+	return p.ObjectType == other.ObjectType && p.Schema == other.Schema && p.Name == other.Name && p.Grantee == other.Grantee
+}
+
+func readDefaultPrivilegeRules(db DB, role string, paths map[string][]string, grantees []string) ([]DefaultPrivilegeRule, error) {
+	sq := `SELECT creator, schema_name, objtype, grantee, privilege_type, is_grantable
+FROM (SELECT pg_get_userbyid(d.defaclrole) AS creator, COALESCE(n.nspname::text, '') AS schema_name, d.defaclobjtype::text AS objtype,
+		a.privilege_type, a.is_grantable, CASE WHEN a.grantee = 0 THEN 'PUBLIC' ELSE pg_get_userbyid(a.grantee) END AS grantee
+	FROM pg_default_acl d LEFT JOIN pg_namespace n ON n.oid = d.defaclnamespace, aclexplode(d.defaclacl) a) acl
+WHERE grantee = ANY($1)
+ORDER BY 1, 2, 3, 4, 5`
+	rows, err := db.Query(sq, pq.Array(grantees))
+	if err != nil {
+		return nil, stepErrorf(StepReadPrivileges, "error reading default privileges: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]DefaultPrivilegeRule, 0)
+	for rows.Next() {
+		var cur DefaultPrivilegeRule
+		var objType, privilege string
+		var grantable bool
+		if err := rows.Scan(&cur.Creator, &cur.Schema, &objType, &cur.Grantee, &privilege, &grantable); err != nil {
+			return nil, stepErrorf(StepReadPrivileges, "error reading default privileges: %w", err)
+		}
+		cur.ObjectType = defaultAclObjectTypes[objType]
+		if n := len(result); n == 0 || !result[n-1].sameRule(cur) {
+			cur.Privileges, cur.GrantOption = make([]string, 0), make([]string, 0)
+			cur.Inherited, cur.Path = cur.Grantee != role, paths[cur.Grantee]
+			result = append(result, cur)
+		}
+		last := &result[len(result)-1]
+		last.Privileges = append(last.Privileges, privilege)
+		if grantable {
+			last.GrantOption = append(last.GrantOption, privilege)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stepErrorf(StepReadPrivileges, "error reading default privileges: %w", err)
+	}
+	return result, nil
+}
+
+func (p DefaultPrivilegeRule) sameRule(other DefaultPrivilegeRule) bool {
+	return p.Creator == other.Creator && p.Schema == other.Schema && p.ObjectType == other.ObjectType && p.Grantee == other.Grantee
+}
+
+func readOwnedObjects(db DB, role string, paths map[string][]string, owners []string) ([]OwnedObject, error) {
+	sq := `SELECT object_type, schema_name, object_name, owner_name
+FROM (SELECT o.object_type, o.schema_name, o.object_name, pg_get_userbyid(o.owner) AS owner_name FROM (` + aclObjectsSql + `) o) owned
+WHERE owner_name = ANY($1)
+ORDER BY 1, 2, 3`
+	rows, err := db.Query(sq, pq.Array(owners))
+	if err != nil {
+		return nil, stepErrorf(StepReadPrivileges, "error reading owned objects: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]OwnedObject, 0)
+	for rows.Next() {
+		var cur OwnedObject
+		if err := rows.Scan(&cur.ObjectType, &cur.Schema, &cur.Name, &cur.Owner); err != nil {
+			return nil, stepErrorf(StepReadPrivileges, "error reading owned objects: %w", err)
+		}
+		cur.Inherited, cur.Path = cur.Owner != role, paths[cur.Owner]
+		result = append(result, cur)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stepErrorf(StepReadPrivileges, "error reading owned objects: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,74 @@
+package postgresql
+
+import (
+	"fmt"
+)
+
+const (
+	StepConnect                   = "connect"
+	StepAnalyze                   = "analyze"
+	StepGrantTemporaryMembership  = "grant-temporary-membership"
+	StepRevokeTemporaryMembership = "revoke-temporary-membership"
+	StepCreateDatabase            = "create-database"
+	StepReadDatabase              = "read-database"
+	StepAlterOwner                = "alter-owner"
+	StepAlterDatabase             = "alter-database"
+	StepCreateSchema              = "create-schema"
+	StepReadSchema                = "read-schema"
+	StepCreateRole                = "create-role"
+	StepReadRole                  = "read-role"
+	StepAlterRole                 = "alter-role"
+	StepSetPassword               = "set-password"
+	StepGrantMembership           = "grant-membership"
+	StepReadMembership            = "read-membership"
+	StepRevokeMembership          = "revoke-membership"
+	StepAlterDefaultPrivileges    = "alter-default-privileges"
+	StepGrantPrivileges           = "grant-privileges"
+	StepReadPrivileges            = "read-privileges"
+	StepRevokePrivileges          = "revoke-privileges"
+	StepList                      = "list"
+	StepMetadata                  = "metadata"
+	StepDropRole                  = "drop-role"
+	StepTerminateSessions         = "terminate-sessions"
+)
+
+// StepError identifies the step of an operation that failed
+// The message of the wrapped error is not altered
+type StepError struct {
+	// Step is a short, stable identifier of the step that failed (e.g. create-database)
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// stepErrorf produces a StepError that wraps an error formatted with fmt.Errorf
+func stepErrorf(step string, format string, a ...any) error {
+	return &StepError{Step: step, Err: fmt.Errorf(format, a...)}
+}
+
+// stepError attaches step to err
+// If err is nil, nil is returned
+func stepError(step string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &StepError{Step: step, Err: err}
+}
+
+// ValidationError indicates that the input for an operation is invalid
+// It is reported before any statements are executed
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
@@ -18,6 +18,8 @@ const (
 	FeaturePrivileges
 	FeatureForceDropDatabase
 	FeaturePid
+	FeatureMembershipInheritOption
+	FeatureDefaultPrivilegesOnSchemas
 )
 
 type Features map[FeatureName]bool
@@ -59,6 +61,14 @@ func CalcSupportedFeatures(dbVersion semver.Version) Features {
 		// Column procpid was replaced by pid in pg_stat_activity
 		// for Postgresql >= 9.2 and above
 		FeaturePid: semver.MustParseRange(">=9.2.0")(dbVersion),
+
+		// pg_auth_members.inherit_option replaced pg_roles.rolinherit for deciding whether a membership is inherited
+		// for Postgresql >= 16
+		FeatureMembershipInheritOption: semver.MustParseRange(">=16.0.0")(dbVersion),
+
+		// ALTER DEFAULT PRIVILEGES ... ON SCHEMAS
+		// for Postgresql >= 10
+		FeatureDefaultPrivilegesOnSchemas: semver.MustParseRange(">=10.0.0")(dbVersion),
 	}
 }
 
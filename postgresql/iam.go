@@ -0,0 +1,111 @@
+package postgresql
+
+import (
+	"fmt"
+	"github.com/lib/pq"
+	"log"
+	"slices"
+	"strings"
+)
+
+const (
+	// RdsIamRole grants IAM database authentication on AWS RDS
+	RdsIamRole = "rds_iam"
+	// CloudSqlIamServiceAccountRole and CloudSqlIamUserRole mark IAM principals on Cloud SQL
+	CloudSqlIamServiceAccountRole = "cloudsqliamserviceaccount"
+	CloudSqlIamUserRole           = "cloudsqliamuser"
+
+	cloudSqlServiceAccountSuffix = ".gserviceaccount.com"
+)
+
+var iamRoles = []string{RdsIamRole, CloudSqlIamServiceAccountRole, CloudSqlIamUserRole}
+
+// iamRolesSql produces a sql list of the roles that enable IAM authentication
+func iamRolesSql() string {
+	quoted := make([]string, 0, len(iamRoles))
+	for _, name := range iamRoles {
+		quoted = append(quoted, pq.QuoteLiteral(name))
+	}
+	return "(" + strings.Join(quoted, ", ") + ")"
+}
+
+// IamRoleName converts name into the role name of an IAM principal
+// Cloud SQL names a service account role after its email without the .gserviceaccount.com suffix
+// (e.g. app@project.iam.gserviceaccount.com becomes app@project.iam)
+func IamRoleName(name string) string {
+	return strings.TrimSuffix(name, cloudSqlServiceAccountSuffix)
+}
+
+// iamGroup returns the role that grants IAM authentication to roleName on the flavor
+func iamGroup(flavor, roleName string) (string, error) {
+	switch flavor {
+	case FlavorRds:
+		return RdsIamRole, nil
+	case FlavorCloudSql:
+		if !strings.Contains(roleName, "@") {
+			return "", &ValidationError{Field: "name", Reason: "an IAM role on Cloud SQL must be named after the email of a user or service account"}
+		}
+		if strings.HasSuffix(roleName, ".iam") {
+			return CloudSqlIamServiceAccountRole, nil
+		}
+		return CloudSqlIamUserRole, nil
+	default:
+		return "", &ValidationError{Field: "iam", Reason: fmt.Sprintf("IAM authentication is only supported on AWS RDS and Cloud SQL (detected %s)", flavor)}
+	}
+}
+
+// reconcileIam grants or revokes the role that enables IAM authentication for role
+// A role that lists an IAM role in MemberOf (e.g. the setup admin role) keeps IAM authentication
+func (r *Roles) reconcileIam(db DB, existing Role, role Role) error {
+	enabled := role.Iam || slices.ContainsFunc(role.MemberOf, func(m string) bool { return slices.Contains(iamRoles, m) })
+	if existing.Iam == enabled {
+		return nil
+	}
+	if !enabled {
+		if role.SkipIamRevoke {
+			return nil
+		}
+		// The IAM role differs by flavor, so every IAM role that the role is a member of is revoked
+		log.Printf("Disabling IAM authentication for %q\n", role.Name)
+		sq := fmt.Sprintf(`SELECT b.rolname FROM pg_auth_members m JOIN pg_roles b ON m.roleid = b.oid JOIN pg_roles r ON m.member = r.oid
+WHERE r.rolname = $1 AND b.rolname IN %s`, iamRolesSql())
+		rows, err := db.Query(sq, role.Name)
+		if err != nil {
+			return stepErrorf(StepReadRole, "error reading IAM roles of %q: %w", role.Name, err)
+		}
+		groups := make([]string, 0)
+		for rows.Next() {
+			var group string
+			if err := rows.Scan(&group); err != nil {
+				rows.Close()
+				return stepErrorf(StepReadRole, "error reading IAM roles of %q: %w", role.Name, err)
+			}
+			groups = append(groups, group)
+		}
+		rows.Close()
+		for _, group := range groups {
+			if _, err := db.Exec(fmt.Sprintf("REVOKE %s FROM %s", pq.QuoteIdentifier(group), pq.QuoteIdentifier(role.Name))); err != nil {
+				return stepErrorf(StepRevokeMembership, "error revoking %q membership from %q: %w", group, role.Name, err)
+			}
+		}
+		return nil
+	}
+	if !role.Iam {
+		// The IAM role in MemberOf is granted by reconcile
+		return nil
+	}
+
+	info, err := CalcDbConnectionInfo(db)
+	if err != nil {
+		return stepErrorf(StepAnalyze, "error analyzing database: %w", err)
+	}
+	group, err := iamGroup(info.Flavor, role.Name)
+	if err != nil {
+		return err
+	}
+	log.Printf("Enabling IAM authentication for %q\n", role.Name)
+	if _, err := db.Exec(fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(group), pq.QuoteIdentifier(role.Name))); err != nil {
+		return stepErrorf(StepGrantMembership, "error granting %q membership to %q: %w", group, role.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,421 @@
+package postgresql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-multierror/multierror"
+	"github.com/lib/pq"
+	"github.com/nullstone-io/go-rest-api"
+	"log"
+	"slices"
+	"time"
+)
+
+const jitAccessTable = "jit_access"
+
+// JitAccess grants Role temporary access until ExpiresAt
+//
+// If Role does not exist, a login role is created with Password that is valid until ExpiresAt
+// Password is rejected if Role already exists
+// Role is granted membership to each role in MemberOf
+// Expired access is removed by Sweep: memberships are revoked, sessions are terminated, and a created role is dropped
+//
+// The expiry is recorded in the pg_db_admin.jit_access table of the admin database
+type JitAccess struct {
+	Role     string `json:"role"`
+	Password string `json:"password,omitempty"`
+	// MemberOf are the roles that Role is granted until ExpiresAt
+	// When read, this only contains the memberships that were granted by JitAccess
+	MemberOf []string `json:"memberOf"`
+	// ExpiresAt is the time that access is revoked
+	// If empty, Ttl is used to calculate ExpiresAt
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Ttl is a duration (e.g. `4h`) from now that access is granted
+	Ttl string `json:"ttl,omitempty"`
+	// CreatedRole is true if Role was created by JitAccess and will be dropped on expiry
+	CreatedRole bool `json:"createdRole"`
+}
+
+func (j JitAccess) Key() string {
+	return j.Role
+}
+
+var _ rest.DataAccess[string, JitAccess] = &JitAccesses{}
+
+type JitAccesses struct {
+	DbOpener DbOpener
+}
+
+func (j *JitAccesses) Create(obj JitAccess) (*JitAccess, error) {
+	if err := validateNames(j.DbOpener, true, obj.nameFields()...); err != nil {
+		return nil, err
+	}
+	if err := enforcePolicy(j.DbOpener, obj.policyRefs()...); err != nil {
+		return nil, err
+	}
+	if err := obj.resolveExpiry(time.Now()); err != nil {
+		return nil, err
+	}
+	if existing, err := j.Read(obj.Role); err != nil {
+		return nil, err
+	} else if existing != nil {
+		log.Printf("[Create] JIT access for %q already exists, updating...\n", obj.Role)
+		return j.Update(obj.Role, obj)
+	}
+
+	db, err := j.openMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	var roleExists bool
+	if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM pg_roles WHERE rolname = $1)`, obj.Role).Scan(&roleExists); err != nil {
+		return nil, stepError(StepReadRole, err)
+	}
+	if roleExists && obj.Password != "" {
+		return nil, &ValidationError{Field: "password", Reason: fmt.Sprintf("role %q already exists, a password can only be set when creating a temporary role", obj.Role)}
+	}
+	if !roleExists {
+		if obj.Password == "" {
+			return nil, &ValidationError{Field: "password", Reason: "a password is required to create a temporary login role"}
+		}
+		if err := validatePassword(j.DbOpener, obj.Role, obj.Password); err != nil {
+			return nil, err
+		}
+		log.Printf("Creating temporary role %q valid until %s\n", obj.Role, obj.ExpiresAt.Format(time.RFC3339))
+		sq := fmt.Sprintf("CREATE ROLE %s WITH LOGIN PASSWORD %s VALID UNTIL %s",
+			pq.QuoteIdentifier(obj.Role), pq.QuoteLiteral(obj.Password), validUntil(obj.ExpiresAt))
+		if _, err := db.Exec(sq); err != nil {
+			return nil, stepErrorf(StepCreateRole, "error creating temporary role %q: %w", obj.Role, err)
+		}
+		obj.CreatedRole = true
+	}
+
+	granted, err := j.grantMemberships(db, obj.Role, obj.MemberOf, nil)
+	if err != nil {
+		return nil, err
+	}
+	obj.MemberOf = granted
+
+	sq := fmt.Sprintf("INSERT INTO %s (role, member_of, created_role, expires_at) VALUES ($1, $2, $3, $4)", MetadataTable(jitAccessTable))
+	if _, err := db.Exec(sq, obj.Role, pq.Array(obj.MemberOf), obj.CreatedRole, obj.ExpiresAt); err != nil {
+		return nil, stepErrorf(StepMetadata, "error recording JIT access for %q: %w", obj.Role, err)
+	}
+	obj.Password = ""
+	obj.Ttl = ""
+	return &obj, nil
+}
+
+func (j *JitAccesses) Read(key string) (*JitAccess, error) {
+	db, err := j.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+
+	obj := JitAccess{Role: key}
+	sq := fmt.Sprintf("SELECT member_of, created_role, expires_at FROM %s WHERE role = $1", MetadataTable(jitAccessTable))
+	if err := db.QueryRow(sq, key).Scan(pq.Array(&obj.MemberOf), &obj.CreatedRole, &obj.ExpiresAt); err != nil {
+		if err == sql.ErrNoRows || isUndefinedTable(err) {
+			return nil, nil
+		}
+		return nil, stepError(StepMetadata, err)
+	}
+	return &obj, nil
+}
+
+// Update extends (or shortens) the expiry and grants any additional MemberOf roles
+func (j *JitAccesses) Update(key string, obj JitAccess) (*JitAccess, error) {
+	if err := validateNames(j.DbOpener, false, append(memberOfNames(obj.MemberOf), requiredName("role", key))...); err != nil {
+		return nil, err
+	}
+	if err := enforcePolicy(j.DbOpener, append(obj.policyRefs(), roleRefs(key)...)...); err != nil {
+		return nil, err
+	}
+	if obj.Password != "" {
+		return nil, &ValidationError{Field: "password", Reason: "a password can only be set when creating a temporary role"}
+	}
+	if err := obj.resolveExpiry(time.Now()); err != nil {
+		return nil, err
+	}
+	existing, err := j.Read(key)
+	if err != nil || existing == nil {
+		return existing, err
+	}
+
+	db, err := j.openMetadata()
+	if err != nil {
+		return nil, err
+	}
+	if existing.CreatedRole {
+		log.Printf("Changing expiry of temporary role %q to %s\n", key, obj.ExpiresAt.Format(time.RFC3339))
+		sq := fmt.Sprintf("ALTER ROLE %s VALID UNTIL %s", pq.QuoteIdentifier(key), validUntil(obj.ExpiresAt))
+		if _, err := db.Exec(sq); err != nil {
+			return nil, stepErrorf(StepAlterRole, "error changing expiry of %q: %w", key, err)
+		}
+	}
+	granted, err := j.grantMemberships(db, key, obj.MemberOf, existing.MemberOf)
+	if err != nil {
+		return nil, err
+	}
+	existing.MemberOf = granted
+	existing.ExpiresAt = obj.ExpiresAt
+
+	sq := fmt.Sprintf("UPDATE %s SET member_of = $2, expires_at = $3 WHERE role = $1", MetadataTable(jitAccessTable))
+	if _, err := db.Exec(sq, key, pq.Array(existing.MemberOf), existing.ExpiresAt); err != nil {
+		return nil, stepErrorf(StepMetadata, "error recording JIT access for %q: %w", key, err)
+	}
+	return existing, nil
+}
+
+// Drop expires the access immediately
+func (j *JitAccesses) Drop(key string) (bool, error) {
+	if err := enforcePolicy(j.DbOpener, roleRefs(key)...); err != nil {
+		return false, err
+	}
+	existing, err := j.Read(key)
+	if err != nil {
+		return false, err
+	} else if existing == nil {
+		return true, nil
+	}
+	if err := j.expire(*existing); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Sweep expires every JIT access whose expiry is before now
+// It returns the roles that were expired
+// If a role fails to expire, it remains recorded and is retried on the next sweep
+func (j *JitAccesses) Sweep(now time.Time) ([]string, error) {
+	db, err := j.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+
+	sq := fmt.Sprintf("SELECT role, member_of, created_role, expires_at FROM %s WHERE expires_at <= $1 ORDER BY expires_at", MetadataTable(jitAccessTable))
+	rows, err := db.Query(sq, now)
+	if err != nil {
+		if isUndefinedTable(err) {
+			return []string{}, nil
+		}
+		return nil, stepErrorf(StepMetadata, "error listing expired JIT access: %w", err)
+	}
+	expired := make([]JitAccess, 0)
+	for rows.Next() {
+		var cur JitAccess
+		if err := rows.Scan(&cur.Role, pq.Array(&cur.MemberOf), &cur.CreatedRole, &cur.ExpiresAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error reading JIT access: %w", err)
+		}
+		expired = append(expired, cur)
+	}
+	rows.Close()
+
+	swept := make([]string, 0)
+	errs := make([]error, 0)
+	for _, cur := range expired {
+		log.Printf("[Sweep] JIT access for %q expired at %s\n", cur.Role, cur.ExpiresAt.Format(time.RFC3339))
+		if err := j.expire(cur); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		swept = append(swept, cur.Role)
+	}
+	if len(errs) > 0 {
+		return swept, multierror.New(errs)
+	}
+	return swept, nil
+}
+
+// expire revokes the memberships granted by obj, terminates the sessions of the role, and drops a created role
+// If the role was already dropped (e.g. by a DBA), only the record is removed
+func (j *JitAccesses) expire(obj JitAccess) error {
+	db, err := j.DbOpener.OpenDatabase("")
+	if err != nil {
+		return err
+	}
+
+	quotedRole := pq.QuoteIdentifier(obj.Role)
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM pg_roles WHERE rolname = $1)`, obj.Role).Scan(&exists); err != nil {
+		return stepError(StepReadRole, err)
+	}
+	if !exists {
+		log.Printf("Role %q no longer exists, removing JIT access record\n", obj.Role)
+	} else {
+		if obj.CreatedRole {
+			// Prevent new sessions before terminating existing sessions
+			if _, err := db.Exec(fmt.Sprintf("ALTER ROLE %s NOLOGIN", quotedRole)); err != nil {
+				return stepErrorf(StepAlterRole, "error disabling login for %q: %w", obj.Role, err)
+			}
+		}
+		for _, target := range obj.MemberOf {
+			log.Printf("Revoking temporary %q membership from %q\n", target, obj.Role)
+			if _, err := db.Exec(fmt.Sprintf("REVOKE %s FROM %s", pq.QuoteIdentifier(target), quotedRole)); err != nil {
+				return stepErrorf(StepRevokeMembership, "error revoking %q membership from %q: %w", target, obj.Role, err)
+			}
+		}
+		count, err := terminateSessions(db, obj.Role)
+		if err != nil {
+			return err
+		}
+		log.Printf("Terminated %d sessions of %q\n", count, obj.Role)
+		if obj.CreatedRole {
+			if err := dropOwned(j.DbOpener, obj.Role); err != nil {
+				return err
+			}
+			log.Printf("Dropping temporary role %q\n", obj.Role)
+			if _, err := db.Exec(fmt.Sprintf("DROP ROLE IF EXISTS %s", quotedRole)); err != nil {
+				return stepErrorf(StepDropRole, "error dropping temporary role %q: %w", obj.Role, err)
+			}
+		}
+	}
+
+	sq := fmt.Sprintf("DELETE FROM %s WHERE role = $1", MetadataTable(jitAccessTable))
+	if _, err := db.Exec(sq, obj.Role); err != nil {
+		return stepErrorf(StepMetadata, "error removing JIT access record for %q: %w", obj.Role, err)
+	}
+	return nil
+}
+
+// dropOwned transfers the objects owned by role in every database to the owner of that database
+// Remaining privileges (including default privileges) of role are dropped so that role can be dropped
+func dropOwned(opener DbOpener, role string) error {
+	db, err := opener.OpenDatabase("")
+	if err != nil {
+		return err
+	}
+	info, err := CalcDbConnectionInfo(db)
+	if err != nil {
+		return stepErrorf(StepAnalyze, "error analyzing database: %w", err)
+	}
+	databases, err := listConnectableDatabases(db)
+	if err != nil {
+		return err
+	}
+
+	// REASSIGN OWNED and DROP OWNED require the privileges of role
+	// Role memberships are shared across databases, so a single grant covers every database
+	quotedRole := pq.QuoteIdentifier(role)
+	granted := false
+	if !info.IsSuperuser {
+		isMember, err := isMemberOfRole(db, info.CurrentUser, role)
+		if err != nil {
+			return stepError(StepReadMembership, err)
+		}
+		if !isMember {
+			if _, err := db.Exec(fmt.Sprintf("GRANT %s TO CURRENT_USER", quotedRole)); err != nil {
+				return stepErrorf(StepGrantTemporaryMembership, "error granting temporary membership: %w", err)
+			}
+			granted = true
+		}
+	}
+
+	errs := make([]error, 0)
+	for _, database := range databases {
+		if err := dropOwnedInDatabase(opener, database, role); err != nil {
+			errs = append(errs, err)
+			break
+		}
+	}
+	if granted {
+		if _, err := db.Exec(fmt.Sprintf("REVOKE %s FROM CURRENT_USER", quotedRole)); err != nil {
+			errs = append(errs, stepErrorf(StepRevokeTemporaryMembership, "error revoking temporary membership: %w", err))
+		}
+	}
+	if len(errs) > 0 {
+		return multierror.New(errs)
+	}
+	return nil
+}
+
+func dropOwnedInDatabase(opener DbOpener, database, role string) error {
+	db, err := opener.OpenDatabase(database)
+	if err != nil {
+		return err
+	}
+	var owner string
+	if err := db.QueryRow(`SELECT pg_get_userbyid(datdba) FROM pg_database WHERE datname = current_database()`).Scan(&owner); err != nil {
+		return stepErrorf(StepReadDatabase, "error reading owner of database %q: %w", database, err)
+	}
+
+	log.Printf("Reassigning objects owned by %q in database %q to %q\n", role, database, owner)
+	sq := fmt.Sprintf("REASSIGN OWNED BY %[1]s TO %[2]s; DROP OWNED BY %[1]s", pq.QuoteIdentifier(role), pq.QuoteIdentifier(owner))
+	return execWithMembership(db, owner, StepDropRole, sq)
+}
+
+// grantMemberships grants each role in memberOf to role
+// Roles that role is already a member of are skipped unless they were granted previously by JitAccess (previous)
+// This ensures that permanent memberships are not revoked on expiry
+func (j *JitAccesses) grantMemberships(db DB, role string, memberOf []string, previous []string) ([]string, error) {
+	granted := append([]string{}, previous...)
+	for _, target := range memberOf {
+		if slices.Contains(granted, target) {
+			continue
+		}
+		isMember, err := isMemberOfRole(db, role, target)
+		if err != nil {
+			return nil, stepError(StepReadMembership, err)
+		}
+		if isMember {
+			log.Printf("%q is already a member of %q, skipping temporary membership\n", role, target)
+			continue
+		}
+		if err := checkMembershipCycle(db, role, target); err != nil {
+			return nil, err
+		}
+		log.Printf("Granting temporary %q membership to %q\n", target, role)
+		if _, err := db.Exec(fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(target), pq.QuoteIdentifier(role))); err != nil {
+			return nil, stepErrorf(StepGrantMembership, "error granting %q membership to %q: %w", target, role, err)
+		}
+		granted = append(granted, target)
+	}
+	return granted, nil
+}
+
+func (j *JitAccesses) openMetadata() (DB, error) {
+	db, err := j.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+	columns := `role text PRIMARY KEY,
+	member_of text[] NOT NULL DEFAULT '{}',
+	created_role boolean NOT NULL DEFAULT false,
+	expires_at timestamptz NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now()`
+	if err := EnsureMetadataTable(db, jitAccessTable, columns); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// resolveExpiry calculates ExpiresAt from Ttl and verifies that it is in the future
+func (j *JitAccess) resolveExpiry(now time.Time) error {
+	if j.Ttl != "" {
+		ttl, err := time.ParseDuration(j.Ttl)
+		if err != nil {
+			return &ValidationError{Field: "ttl", Reason: err.Error()}
+		}
+		j.ExpiresAt = now.Add(ttl)
+	}
+	if j.ExpiresAt.IsZero() {
+		return &ValidationError{Field: "expiresAt", Reason: "expiresAt or ttl is required"}
+	}
+	if !j.ExpiresAt.After(now) {
+		return &ValidationError{Field: "expiresAt", Reason: "must be in the future"}
+	}
+	j.ExpiresAt = j.ExpiresAt.UTC()
+	return nil
+}
+
+func validUntil(t time.Time) string {
+	return pq.QuoteLiteral(t.UTC().Format(time.RFC3339))
+}
+
+// isUndefinedTable returns true if err is caused by a table that does not exist (e.g. a metadata table before first use)
+func isUndefinedTable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "42P01"
+}
@@ -0,0 +1,104 @@
+package postgresql
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+)
+
+var (
+	// systemDatabaseNames are databases managed by postgres or the cloud provider that are excluded from list results
+	systemDatabaseNames = []string{"template0", "template1", "rdsadmin", "cloudsqladmin", "azure_maintenance", "azure_sys"}
+	// excludedSchemaNames are schemas that exist in every database and are excluded from list results
+	// Schemas prefixed with pg_ are excluded as well
+	excludedSchemaNames = []string{"public", "information_schema"}
+	// systemRolePrefixes are prefixes of roles managed by postgres or the cloud provider that are excluded from list results
+	systemRolePrefixes = []string{"pg_", "rds_", "rdsadmin", "rdsrepladmin", "rdstopmgr", "cloudsql", "azure_"}
+)
+
+// ListOptions configures keyset pagination for list operations
+// Results are sorted by key; PageToken is the last key of the previous page
+type ListOptions struct {
+	Limit     int    `json:"limit"`
+	PageToken string `json:"pageToken"`
+}
+
+func (o ListOptions) limit() int {
+	switch {
+	case o.Limit <= 0:
+		return DefaultListLimit
+	case o.Limit > MaxListLimit:
+		return MaxListLimit
+	default:
+		return o.Limit
+	}
+}
+
+type Page[T any] struct {
+	Items []T `json:"items"`
+	// NextPageToken is empty if there are no more results
+	NextPageToken string `json:"nextPageToken,omitempty"`
+}
+
+// newPage builds a Page from items that were queried with a limit of opts.limit()+1
+// The extra item signals that another page exists
+func newPage[T any](items []T, opts ListOptions, keyFn func(T) string) *Page[T] {
+	page := &Page[T]{Items: items}
+	if page.Items == nil {
+		page.Items = make([]T, 0)
+	}
+	if limit := opts.limit(); len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		page.NextPageToken = keyFn(page.Items[limit-1])
+	}
+	return page
+}
+
+// paginate applies opts to items that are already sorted by keyFn
+// This is used when the results cannot be paginated in SQL (e.g. they span multiple databases)
+func paginate[T any](items []T, opts ListOptions, keyFn func(T) string) *Page[T] {
+	start := 0
+	if opts.PageToken != "" {
+		for start < len(items) && keyFn(items[start]) <= opts.PageToken {
+			start++
+		}
+	}
+	end := start + opts.limit() + 1
+	if end > len(items) {
+		end = len(items)
+	}
+	return newPage(items[start:end], opts, keyFn)
+}
+
+// IsSystemDatabase returns true if name refers to a database managed by postgres or the cloud provider
+func IsSystemDatabase(name string) bool {
+	for _, sys := range systemDatabaseNames {
+		if name == sys {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSystemRole returns true if name refers to a role managed by postgres or the cloud provider
+func IsSystemRole(name string) bool {
+	for _, prefix := range systemRolePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludeSystemRolesSql produces a sql condition that excludes system roles for the column
+func excludeSystemRolesSql(column string) string {
+	conditions := make([]string, 0)
+	for _, prefix := range systemRolePrefixes {
+		conditions = append(conditions, fmt.Sprintf("left(%s, %d) <> '%s'", column, len(prefix), prefix))
+	}
+	return strings.Join(conditions, " AND ")
+}
@@ -0,0 +1,166 @@
+package postgresql
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// MembershipGraph contains every role membership in pg_auth_members
+// An edge from member to target means that member is a member of target
+type MembershipGraph struct {
+	memberOf map[string][]string
+}
+
+// LoadMembershipGraph reads every role membership
+func LoadMembershipGraph(db DB) (*MembershipGraph, error) {
+	// Since postgres 16, a membership may be granted multiple times by different grantors
+	sq := `SELECT pg_get_userbyid(member), pg_get_userbyid(roleid) FROM pg_auth_members GROUP BY member, roleid ORDER BY 1, 2`
+	rows, err := db.Query(sq)
+	if err != nil {
+		return nil, stepErrorf(StepReadMembership, "error reading role memberships: %w", err)
+	}
+	defer rows.Close()
+
+	g := &MembershipGraph{memberOf: map[string][]string{}}
+	for rows.Next() {
+		var member, target string
+		if err := rows.Scan(&member, &target); err != nil {
+			return nil, stepErrorf(StepReadMembership, "error reading role membership: %w", err)
+		}
+		g.Add(member, target)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stepErrorf(StepReadMembership, "error reading role memberships: %w", err)
+	}
+	return g, nil
+}
+
+// Add records that member is a member of target
+func (g *MembershipGraph) Add(member, target string) {
+	if !slices.Contains(g.memberOf[member], target) {
+		g.memberOf[member] = append(g.memberOf[member], target)
+	}
+}
+
+// CyclePath returns the loop that would form if member were granted membership in target
+// The path starts and ends with member (e.g. [admin, app, admin])
+// If the grant would not form a cycle, nil is returned
+func (g *MembershipGraph) CyclePath(member, target string) []string {
+	if member == target {
+		return []string{member, member}
+	}
+	// A cycle forms if target is already a member of member, directly or through other roles
+	path := g.findPath(target, member, map[string]bool{})
+	if path == nil {
+		return nil
+	}
+	return append([]string{member}, path...)
+}
+
+// findPath returns the chain of memberships from role to goal using a depth-first search
+func (g *MembershipGraph) findPath(role, goal string, visited map[string]bool) []string {
+	if role == goal {
+		return []string{role}
+	}
+	if visited[role] {
+		return nil
+	}
+	visited[role] = true
+	for _, next := range g.memberOf[role] {
+		if path := g.findPath(next, goal, visited); path != nil {
+			return append([]string{role}, path...)
+		}
+	}
+	return nil
+}
+
+// Paths returns every role that role is a member of, directly or transitively, including role itself
+// Each role maps to the shortest chain of memberships from role (e.g. readers => [app, readers])
+func (g *MembershipGraph) Paths(role string) map[string][]string {
+	paths := map[string][]string{role: {role}}
+	queue := []string{role}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		targets := slices.Clone(g.memberOf[cur])
+		slices.Sort(targets)
+		for _, target := range targets {
+			if _, ok := paths[target]; !ok {
+				paths[target] = slices.Concat(paths[cur], []string{target})
+				queue = append(queue, target)
+			}
+		}
+	}
+	return paths
+}
+
+// MembershipTree is a role and every role that it is a member of, directly or transitively
+type MembershipTree struct {
+	Role     string           `json:"role"`
+	MemberOf []MembershipTree `json:"memberOf"`
+}
+
+// Tree returns the transitive membership tree of role
+// A role that is reachable through multiple paths appears under each path
+func (g *MembershipGraph) Tree(role string) MembershipTree {
+	return g.tree(role, nil)
+}
+
+func (g *MembershipGraph) tree(role string, ancestors []string) MembershipTree {
+	node := MembershipTree{Role: role, MemberOf: make([]MembershipTree, 0)}
+	// Postgres prevents cycles, but a guard keeps a corrupt catalog from recursing forever
+	if slices.Contains(ancestors, role) {
+		return node
+	}
+	ancestors = slices.Concat(ancestors, []string{role})
+	targets := slices.Clone(g.memberOf[role])
+	slices.Sort(targets)
+	for _, target := range targets {
+		node.MemberOf = append(node.MemberOf, g.tree(target, ancestors))
+	}
+	return node
+}
+
+// MembershipCycleError is returned instead of granting a membership that would form a cycle
+type MembershipCycleError struct {
+	Member string
+	Target string
+	// Path is the loop that the grant would form, starting and ending with Member
+	Path []string
+}
+
+func (e *MembershipCycleError) Error() string {
+	return fmt.Sprintf("granting %q membership to %q would create a membership cycle: %s", e.Target, e.Member, strings.Join(e.Path, " -> "))
+}
+
+// checkMembershipCycle returns a MembershipCycleError if granting target to member would form a cycle
+func checkMembershipCycle(db DB, member, target string) error {
+	g, err := LoadMembershipGraph(db)
+	if err != nil {
+		return err
+	}
+	if path := g.CyclePath(member, target); path != nil {
+		return &MembershipCycleError{Member: member, Target: target, Path: path}
+	}
+	return nil
+}
+
+// MembershipTree reads the transitive membership tree of role
+// If role does not exist, nil is returned
+func (r *Roles) MembershipTree(role string) (*MembershipTree, error) {
+	existing, err := r.Read(role)
+	if err != nil || existing == nil {
+		return nil, err
+	}
+	db, err := r.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+	g, err := LoadMembershipGraph(db)
+	if err != nil {
+		return nil, err
+	}
+	tree := g.Tree(role)
+	return &tree, nil
+}
@@ -0,0 +1,19 @@
+package postgresql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMembershipGraph_CyclePath(t *testing.T) {
+	g := &MembershipGraph{memberOf: map[string][]string{}}
+	// a -> b -> c
+	g.Add("a", "b")
+	g.Add("b", "c")
+
+	assert.Equal(t, []string{"c", "a", "b", "c"}, g.CyclePath("c", "a"), "grant that closes a loop")
+	assert.Equal(t, []string{"b", "a", "b"}, g.CyclePath("b", "a"), "direct loop")
+	assert.Equal(t, []string{"a", "a"}, g.CyclePath("a", "a"), "member of itself")
+	assert.Nil(t, g.CyclePath("a", "c"), "grant that does not form a cycle")
+	assert.Nil(t, g.CyclePath("d", "a"), "unknown member")
+}
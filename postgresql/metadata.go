@@ -0,0 +1,35 @@
+package postgresql
+
+import (
+	"fmt"
+	"github.com/lib/pq"
+)
+
+// MetadataSchema is the schema that contains tables that pg-db-admin uses to track state that postgres does not
+// The schema is created in the database of the admin connection url
+const MetadataSchema = "pg_db_admin"
+
+// EnsureMetadataTable creates the metadata schema and a table using the column definitions in columns
+func EnsureMetadataTable(db DB, table, columns string) error {
+	sq := fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s; CREATE TABLE IF NOT EXISTS %s (%s)",
+		pq.QuoteIdentifier(MetadataSchema), MetadataTable(table), columns)
+	if _, err := db.Exec(sq); err != nil {
+		return stepErrorf(StepMetadata, "error creating metadata table %q: %w", table, err)
+	}
+	return nil
+}
+
+// EnsureMetadataTables creates the metadata tables that other changes write to as a side effect (e.g. password changes)
+// This runs once during setup, as the admin role, so that setting a password never runs DDL
+func (s *Store) EnsureMetadataTables() error {
+	db, err := s.OpenDatabase("")
+	if err != nil {
+		return err
+	}
+	return EnsureMetadataTable(db, passwordChangesTable, passwordChangesColumns)
+}
+
+// MetadataTable produces the quoted, schema-qualified name of a metadata table
+func MetadataTable(table string) string {
+	return pq.QuoteIdentifier(MetadataSchema) + "." + pq.QuoteIdentifier(table)
+}
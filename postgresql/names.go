@@ -0,0 +1,149 @@
+package postgresql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxIdentifierLength is the maximum length of a postgres identifier in bytes (NAMEDATALEN - 1)
+	// Postgres silently truncates longer identifiers
+	MaxIdentifierLength = 63
+)
+
+var (
+	// strictNameRegex matches lowercase snake_case names that never need to be quoted
+	strictNameRegex = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+)
+
+// nameField is a name in a resource payload that is validated before any SQL runs
+type nameField struct {
+	Field    string
+	Value    string
+	Optional bool
+	// Reference is true if the name refers to an existing object (e.g. an owner or membership target)
+	// The reserved pg_ prefix and strict names are only enforced on names that are created
+	Reference bool
+}
+
+func requiredName(field, value string) nameField {
+	return nameField{Field: field, Value: value}
+}
+
+func optionalName(field, value string) nameField {
+	return nameField{Field: field, Value: value, Optional: true}
+}
+
+func requiredReference(field, value string) nameField {
+	return nameField{Field: field, Value: value, Reference: true}
+}
+
+func optionalReference(field, value string) nameField {
+	return nameField{Field: field, Value: value, Optional: true, Reference: true}
+}
+
+// ValidateName verifies that name is a usable postgres identifier
+// If strict is true, name must also be lowercase snake_case
+func ValidateName(name string, strict bool) error {
+	if err := validateIdentifier(name); err != nil {
+		return err
+	}
+	if strings.HasPrefix(strings.ToLower(name), "pg_") {
+		return fmt.Errorf("must not start with pg_, which is reserved by postgres")
+	}
+	if strict && !strictNameRegex.MatchString(name) {
+		return fmt.Errorf("must be lowercase snake_case (letters, digits, and underscores, not starting with a digit)")
+	}
+	return nil
+}
+
+// validateIdentifier verifies that name can refer to an existing postgres object
+func validateIdentifier(name string) error {
+	if name == "" {
+		return fmt.Errorf("is required")
+	}
+	if len(name) > MaxIdentifierLength {
+		return fmt.Errorf("must be at most %d bytes; postgres truncates longer names (%d bytes)", MaxIdentifierLength, len(name))
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("must not contain control characters")
+		}
+	}
+	return nil
+}
+
+// validateNames returns a ValidationError for the first invalid name in fields
+// Strict names (see Policy.StrictNames) are only enforced when creating so that existing objects can still be managed
+func validateNames(opener DbOpener, isCreate bool, fields ...nameField) error {
+	strict := false
+	if provider, ok := opener.(interface{ ProtectionPolicy() *Policy }); ok && isCreate {
+		policy := provider.ProtectionPolicy()
+		strict = policy != nil && policy.StrictNames
+	}
+	for _, field := range fields {
+		if field.Optional && field.Value == "" {
+			continue
+		}
+		var err error
+		if field.Reference {
+			err = validateIdentifier(field.Value)
+		} else {
+			err = ValidateName(field.Value, strict)
+		}
+		if err != nil {
+			return &ValidationError{Field: field.Field, Reason: fmt.Sprintf("%q %s", field.Value, err)}
+		}
+	}
+	return nil
+}
+
+func memberOfNames(memberOf []string) []nameField {
+	fields := make([]nameField, 0, len(memberOf))
+	for i, name := range memberOf {
+		fields = append(fields, requiredReference(fmt.Sprintf("memberOf[%d]", i), name))
+	}
+	return fields
+}
+
+func (d Database) nameFields() []nameField {
+	return []nameField{requiredName("name", d.Name), optionalReference("owner", d.Owner)}
+}
+
+func (r Role) nameFields() []nameField {
+	return append([]nameField{requiredName("name", r.Name)}, memberOfNames(r.MemberOf)...)
+}
+
+func (k RoleMemberKey) nameFields() []nameField {
+	return []nameField{requiredName("member", k.Member), requiredReference("target", k.Target)}
+}
+
+func (k SchemaKey) nameFields() []nameField {
+	return []nameField{requiredName("name", k.Name), requiredReference("database", k.Database)}
+}
+
+func (s Schema) nameFields() []nameField {
+	return append(s.Key().nameFields(), optionalReference("owner", s.Owner))
+}
+
+func (k SchemaPrivilegeKey) nameFields() []nameField {
+	return []nameField{requiredReference("role", k.Role), requiredReference("database", k.Database)}
+}
+
+func (k DefaultGrantKey) nameFields() []nameField {
+	return []nameField{requiredReference("role", k.Role), requiredReference("target", k.Target), requiredReference("database", k.Database)}
+}
+
+func (k DatabaseAccessKey) nameFields() []nameField {
+	return []nameField{requiredReference("role", k.Role), requiredReference("database", k.Database)}
+}
+
+func (j JitAccess) nameFields() []nameField {
+	return append([]nameField{requiredName("role", j.Role)}, memberOfNames(j.MemberOf)...)
+}
+
+func (l CredentialLease) nameFields() []nameField {
+	return []nameField{requiredReference("database", l.Database)}
+}
@@ -0,0 +1,38 @@
+package postgresql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		strict  bool
+		wantErr bool
+	}{
+		{name: "valid", value: "app_user"},
+		{name: "empty", value: "", wantErr: true},
+		{name: "max length", value: strings.Repeat("a", MaxIdentifierLength)},
+		{name: "over-long", value: strings.Repeat("a", MaxIdentifierLength+1), wantErr: true},
+		{name: "control characters", value: "bad\nname", wantErr: true},
+		{name: "pg_ prefix", value: "pg_custom", wantErr: true},
+		{name: "uppercase pg_ prefix", value: "PG_custom", wantErr: true},
+		{name: "not strict", value: "App-User"},
+		{name: "strict", value: "App-User", strict: true, wantErr: true},
+		{name: "strict snake_case", value: "app_user", strict: true},
+		{name: "strict leading digit", value: "1app", strict: true, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateName(test.value, test.strict)
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -14,26 +14,39 @@ var (
 )
 
 func OpenDatabase(connUrl string, databaseName string) (*sql.DB, error) {
-	if databaseName != "" {
-		u, err := url.Parse(connUrl)
-		if err != nil {
-			return nil, fmt.Errorf("invalid connection url %q: %w", connUrl, err)
-		}
-		u.Path = fmt.Sprintf("/%s", url.PathEscape(databaseName))
-		log.Printf("Opening postgres connection to %s with user %q\n", u.Host, u.User.Username())
-		connUrl = u.String()
+	connUrl, err := databaseConnUrl(connUrl, databaseName)
+	if err != nil {
+		return nil, err
 	}
 
 	db, err := sql.Open("postgres", connUrl)
 	if err != nil {
 		return nil, err
 	}
+	return db, pingDatabase(db)
+}
+
+// databaseConnUrl rewrites connUrl to connect to databaseName
+// If databaseName is empty, connUrl is returned unchanged
+func databaseConnUrl(connUrl string, databaseName string) (string, error) {
+	if databaseName == "" {
+		return connUrl, nil
+	}
+	u, err := url.Parse(connUrl)
+	if err != nil {
+		return "", fmt.Errorf("invalid connection url %q: %w", connUrl, err)
+	}
+	u.Path = fmt.Sprintf("/%s", url.PathEscape(databaseName))
+	log.Printf("Opening postgres connection to %s with user %q\n", u.Host, u.User.Username())
+	return u.String(), nil
+}
 
+func pingDatabase(db *sql.DB) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbOpenConnTimeout)
 	defer cancel()
 	if err := db.PingContext(ctx); err != nil {
-		return nil, fmt.Errorf("error establishing connection to postgres: %w", err)
+		return fmt.Errorf("error establishing connection to postgres: %w", err)
 	}
 	log.Println("Postgres connection established")
-	return db, nil
+	return nil
 }
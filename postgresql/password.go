@@ -0,0 +1,194 @@
+package postgresql
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-multierror/multierror"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	// PasswordPolicyEnvVar contains a json PasswordPolicy that overrides DefaultPasswordPolicy (see PasswordPolicyFromEnv)
+	PasswordPolicyEnvVar = "PASSWORD_POLICY"
+
+	DefaultPasswordMinLength = 12
+)
+
+var (
+	// scramVerifierRegex matches a password that was hashed by the client (see https://www.postgresql.org/docs/current/auth-password.html)
+	scramVerifierRegex = regexp.MustCompile(`^SCRAM-SHA-256\$\d+:[A-Za-z0-9+/=]+\$[A-Za-z0-9+/=]+:[A-Za-z0-9+/=]+$`)
+	md5HashRegex       = regexp.MustCompile(`^md5[0-9a-f]{32}$`)
+
+	// commonPasswords are rejected by every PasswordPolicy unless the denylist is disabled
+	commonPasswords = []string{
+		"password", "password1", "password12", "password123", "password1234", "passw0rd", "p@ssw0rd", "p@ssword",
+		"123456789012", "1234567890", "qwertyuiop", "qwerty123456", "1q2w3e4r5t6y", "1qaz2wsx3edc",
+		"letmein12345", "welcome12345", "iloveyou1234", "administrator", "admin1234567", "changeme1234",
+		"postgres1234", "postgresql", "postgrespassword", "superuser", "trustno1trustno1", "abcdefghijkl",
+	}
+)
+
+// PasswordPolicy is enforced on every password that is set for a role through pg-db-admin
+// Passwords that are already hashed (SCRAM-SHA-256 or md5) cannot be inspected and only RequireScram applies
+type PasswordPolicy struct {
+	// Disabled turns off every password rule
+	Disabled bool `json:"disabled"`
+	// MinLength is the minimum number of characters
+	MinLength int `json:"minLength"`
+	// RequireUppercase, RequireLowercase, RequireDigit, and RequireSymbol require at least one character of each class
+	RequireUppercase bool `json:"requireUppercase"`
+	RequireLowercase bool `json:"requireLowercase"`
+	RequireDigit     bool `json:"requireDigit"`
+	RequireSymbol    bool `json:"requireSymbol"`
+	// RejectRoleName rejects passwords that contain the role name (case-insensitive)
+	RejectRoleName bool `json:"rejectRoleName"`
+	// Denylist contains additional passwords that are rejected (case-insensitive)
+	Denylist []string `json:"denylist"`
+	// DisableCommonDenylist stops rejecting the built-in list of common passwords
+	DisableCommonDenylist bool `json:"disableCommonDenylist"`
+	// RequireScram only accepts passwords that were hashed by the client as a SCRAM-SHA-256 verifier
+	// This keeps plaintext passwords out of statement logs and pg_stat_statements
+	RequireScram bool `json:"requireScram"`
+}
+
+// DefaultPasswordPolicy requires a minimum length and rejects common passwords and passwords containing the role name
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:      DefaultPasswordMinLength,
+		RejectRoleName: true,
+	}
+}
+
+// PasswordPolicyFromEnv creates DefaultPasswordPolicy overridden by the json PasswordPolicy in PASSWORD_POLICY
+// Fields that are omitted from PASSWORD_POLICY keep their default values (e.g. `{}` enforces DefaultPasswordPolicy)
+// If PASSWORD_POLICY is not set, no policy is enforced
+func PasswordPolicyFromEnv() (*PasswordPolicy, error) {
+	raw := os.Getenv(PasswordPolicyEnvVar)
+	if raw == "" {
+		return nil, nil
+	}
+	policy := DefaultPasswordPolicy()
+	if err := json.Unmarshal([]byte(raw), policy); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", PasswordPolicyEnvVar, err)
+	}
+	return policy, nil
+}
+
+// Validate returns a ValidationError for every rule that password breaks
+// An empty password is not validated because it does not set a password
+func (p *PasswordPolicy) Validate(roleName, password string) error {
+	if p == nil || p.Disabled || password == "" {
+		return nil
+	}
+
+	var reasons []string
+	isScram := scramVerifierRegex.MatchString(password)
+	if p.RequireScram && !isScram {
+		reasons = append(reasons, "must be a SCRAM-SHA-256 verifier hashed by the client")
+	}
+	if isScram || md5HashRegex.MatchString(password) {
+		return passwordErrors(reasons)
+	}
+
+	if len([]rune(password)) < p.MinLength {
+		reasons = append(reasons, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUppercase && !hasUpper {
+		reasons = append(reasons, "must contain an uppercase letter")
+	}
+	if p.RequireLowercase && !hasLower {
+		reasons = append(reasons, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		reasons = append(reasons, "must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		reasons = append(reasons, "must contain a symbol")
+	}
+	if p.RejectRoleName && roleName != "" && strings.Contains(strings.ToLower(password), strings.ToLower(roleName)) {
+		reasons = append(reasons, "must not contain the role name")
+	}
+	if p.isDenied(password) {
+		reasons = append(reasons, "is too common")
+	}
+	return passwordErrors(reasons)
+}
+
+// PasswordSecret returns the value to set as the password of a role with a generated plaintext password
+// If RequireScram is set, the plaintext password is hashed into a SCRAM-SHA-256 verifier (see ScramVerifier)
+func (p *PasswordPolicy) PasswordSecret(plaintext string) (string, error) {
+	if p == nil || p.Disabled || !p.RequireScram {
+		return plaintext, nil
+	}
+	return ScramVerifier(plaintext)
+}
+
+func (p *PasswordPolicy) isDenied(password string) bool {
+	lower := strings.ToLower(password)
+	for _, denied := range p.Denylist {
+		if strings.ToLower(denied) == lower {
+			return true
+		}
+	}
+	if p.DisableCommonDenylist {
+		return false
+	}
+	for _, denied := range commonPasswords {
+		if denied == lower {
+			return true
+		}
+	}
+	return false
+}
+
+func passwordErrors(reasons []string) error {
+	if len(reasons) == 0 {
+		return nil
+	}
+	if len(reasons) == 1 {
+		return &ValidationError{Field: "password", Reason: reasons[0]}
+	}
+	errs := make([]error, 0, len(reasons))
+	for _, reason := range reasons {
+		errs = append(errs, &ValidationError{Field: "password", Reason: reason})
+	}
+	return multierror.New(errs)
+}
+
+// ActivePasswordPolicy returns the PasswordPolicy that is enforced by the Store
+// A dry-run or recording Store enforces the PasswordPolicy of its parent
+func (s *Store) ActivePasswordPolicy() *PasswordPolicy {
+	if s.parent != nil {
+		return s.parent.ActivePasswordPolicy()
+	}
+	return s.PasswordPolicy
+}
+
+// passwordPolicy returns the PasswordPolicy of opener
+func passwordPolicy(opener DbOpener) *PasswordPolicy {
+	if provider, ok := opener.(interface{ ActivePasswordPolicy() *PasswordPolicy }); ok {
+		return provider.ActivePasswordPolicy()
+	}
+	return nil
+}
+
+// validatePassword returns the ValidationErrors for password from the PasswordPolicy of opener
+func validatePassword(opener DbOpener, roleName, password string) error {
+	return passwordPolicy(opener).Validate(roleName, password)
+}
@@ -0,0 +1,68 @@
+package postgresql
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// passwordChangesTable records the last time that pg-db-admin set the password of each role
+// Postgres does not track when a password changed, so passwords changed outside of pg-db-admin are not recorded
+// The oid of the role is recorded so that a role that was dropped and created again is not reported with a stale change
+// The table is created once during setup (see Store.EnsureMetadataTables) rather than when a password is set
+const (
+	passwordChangesTable   = "password_changes"
+	passwordChangesColumns = `role text PRIMARY KEY,
+	role_oid oid NOT NULL,
+	changed_at timestamptz NOT NULL DEFAULT now()`
+)
+
+// recordPasswordChange records that the password of role was set
+// The password has already been set, so a failure is logged instead of failing the operation
+// If the table does not exist, the access review reports that password changes are not tracked
+func recordPasswordChange(db DB, role string) {
+	if isDryRun(db) {
+		return
+	}
+	// This is bookkeeping rather than a change requested by the caller, so it is not recorded to an audit plan
+	if d, ok := db.(*planDB); ok {
+		db = d.DB
+	}
+	sq := fmt.Sprintf(`INSERT INTO %s (role, role_oid, changed_at) SELECT rolname, oid, now() FROM pg_roles WHERE rolname = $1
+ON CONFLICT (role) DO UPDATE SET role_oid = EXCLUDED.role_oid, changed_at = EXCLUDED.changed_at`, MetadataTable(passwordChangesTable))
+	if _, err := db.Exec(sq, role); isUndefinedTable(err) {
+		log.Printf("Unable to record password change for %q: %s does not exist, run setup to create it\n", role, MetadataTable(passwordChangesTable))
+	} else if err != nil {
+		log.Printf("Unable to record password change for %q: %s\n", role, err)
+	}
+}
+
+// readPasswordChanges reads the last time that pg-db-admin set the password of each role
+// tracked is false if the table does not exist, in which case password changes were never recorded
+func readPasswordChanges(db DB) (changes map[string]time.Time, tracked bool, err error) {
+	changes = map[string]time.Time{}
+	if err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, MetadataTable(passwordChangesTable)).Scan(&tracked); err != nil {
+		return nil, false, stepErrorf(StepMetadata, "error reading password changes: %w", err)
+	} else if !tracked {
+		return changes, false, nil
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT c.role, c.changed_at FROM %s c JOIN pg_roles r ON r.rolname = c.role AND r.oid = c.role_oid",
+		MetadataTable(passwordChangesTable)))
+	if err != nil {
+		return nil, false, stepErrorf(StepMetadata, "error reading password changes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var role string
+		var changedAt time.Time
+		if err := rows.Scan(&role, &changedAt); err != nil {
+			return nil, false, stepErrorf(StepMetadata, "error reading password change: %w", err)
+		}
+		changes[role] = changedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, stepErrorf(StepMetadata, "error reading password changes: %w", err)
+	}
+	return changes, true, nil
+}
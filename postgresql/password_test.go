@@ -0,0 +1,70 @@
+package postgresql
+
+import (
+	"github.com/go-multierror/multierror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	t.Run("reports every failed rule", func(t *testing.T) {
+		policy := &PasswordPolicy{MinLength: 12, RequireUppercase: true, RequireDigit: true, RejectRoleName: true}
+		err := policy.Validate("weak", "weak")
+		var multi multierror.MultipleErrors
+		require.ErrorAs(t, err, &multi)
+		assert.Len(t, multi, 4, err.Error())
+	})
+
+	t.Run("rejects common passwords", func(t *testing.T) {
+		err := DefaultPasswordPolicy().Validate("app", "Password1234")
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "password", validationErr.Field)
+		assert.Equal(t, "is too common", validationErr.Reason)
+	})
+
+	t.Run("require scram", func(t *testing.T) {
+		policy := &PasswordPolicy{MinLength: 12, RequireScram: true}
+		var validationErr *ValidationError
+		assert.ErrorAs(t, policy.Validate("app", "plain-long-password"), &validationErr)
+
+		verifier, err := ScramVerifier("plain-long-password")
+		require.NoError(t, err)
+		assert.NoError(t, policy.Validate("app", verifier))
+	})
+
+	t.Run("disabled or empty", func(t *testing.T) {
+		var policy *PasswordPolicy
+		assert.NoError(t, policy.Validate("app", "weak"))
+		assert.NoError(t, (&PasswordPolicy{MinLength: 12, Disabled: true}).Validate("app", "weak"))
+		assert.NoError(t, DefaultPasswordPolicy().Validate("app", ""))
+	})
+
+	t.Run("generated credentials satisfy the policy", func(t *testing.T) {
+		policy := &PasswordPolicy{MinLength: 24, RequireUppercase: true, RequireLowercase: true, RequireDigit: true, RequireSymbol: true, RejectRoleName: true}
+		name, password, err := RandomRoleCreds("password_test", policy)
+		require.NoError(t, err)
+		assert.NoError(t, policy.Validate(name, password))
+	})
+}
+
+func TestPasswordPolicyFromEnv(t *testing.T) {
+	assert.Nil(t, NewStore("").PasswordPolicy, "the password policy is opt-in")
+
+	t.Setenv(PasswordPolicyEnvVar, "")
+	policy, err := PasswordPolicyFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, policy)
+
+	t.Setenv(PasswordPolicyEnvVar, "{}")
+	policy, err = PasswordPolicyFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultPasswordPolicy(), policy)
+
+	t.Setenv(PasswordPolicyEnvVar, `{"minLength": 20}`)
+	policy, err = PasswordPolicyFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 20, policy.MinLength)
+	assert.True(t, policy.RejectRoleName)
+}
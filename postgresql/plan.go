@@ -0,0 +1,100 @@
+package postgresql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"sync"
+)
+
+var (
+	errDryRunTransaction = errors.New("transactions are not supported during a dry run")
+
+	// passwordLiteralRegex matches a PASSWORD clause with a quoted literal produced by pq.QuoteLiteral
+	// pq.QuoteLiteral produces an escape string (E'...') if the value contains a backslash
+	passwordLiteralRegex = regexp.MustCompile(`(?i)(PASSWORD\s+)E?'(?:[^']|'')*'`)
+)
+
+// RedactSql replaces password literals in sq so that the statement is safe to display or log
+func RedactSql(sq string) string {
+	return passwordLiteralRegex.ReplaceAllString(sq, "${1}'********'")
+}
+
+// Plan contains the statements that would be executed by a dry-run Store
+type Plan struct {
+	Statements []PlannedStatement `json:"statements"`
+	sync.Mutex
+}
+
+type PlannedStatement struct {
+	// Database is the database that the statement is executed against
+	// An empty Database refers to the database in the connection url
+	Database string `json:"database"`
+	// Sql is the statement with passwords redacted
+	Sql string `json:"sql"`
+}
+
+func (p *Plan) add(database, sq string) {
+	p.Lock()
+	defer p.Unlock()
+	p.Statements = append(p.Statements, PlannedStatement{Database: database, Sql: RedactSql(sq)})
+}
+
+// DryRun creates a Store that records statements to the returned Plan instead of executing them
+// Resources run through the same code paths, so the Plan contains every statement in order
+// This includes temporary GRANT/REVOKE escalations, but not the advisory lock taken while they are held
+// Queries are still executed against the database to inspect existing state; transactions are refused
+func (s *Store) DryRun() (*Store, *Plan) {
+	plan := &Plan{Statements: make([]PlannedStatement, 0)}
+	dry := NewStore("")
+	dry.parent = s
+	dry.plan = plan
+	return dry, plan
+}
+
+// Recording creates a Store that executes statements and also records them to the returned Plan
+// This is used to capture the statements executed by an operation (e.g. for an audit log)
+func (s *Store) Recording() (*Store, *Plan) {
+	rec, plan := s.DryRun()
+	rec.execute = true
+	return rec, plan
+}
+
+var _ DB = &planDB{}
+
+// planDB records statements passed to Exec instead of executing them
+type planDB struct {
+	DB
+	database string
+	plan     *Plan
+	// execute is true if statements are executed after they are recorded (see Store.Recording)
+	execute bool
+}
+
+func (d *planDB) Exec(query string, args ...any) (sql.Result, error) {
+	d.plan.add(d.database, query)
+	if d.execute {
+		return d.DB.Exec(query, args...)
+	}
+	return driver.RowsAffected(0), nil
+}
+
+// Begin refuses to start a transaction during a dry run since statements in it would bypass the plan
+func (d *planDB) Begin() (*sql.Tx, error) {
+	if !d.execute {
+		return nil, errDryRunTransaction
+	}
+	return d.DB.Begin()
+}
+
+// isDryRun returns true if statements executed against db are only recorded
+func isDryRun(db DB) bool {
+	d, ok := db.(*planDB)
+	return ok && !d.execute
+}
+
+// IsDryRun returns true if the store records statements instead of executing them
+func (s *Store) IsDryRun() bool {
+	return s.plan != nil && !s.execute
+}
@@ -0,0 +1,42 @@
+package postgresql
+
+import (
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRedactSql(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{
+			name: "create role",
+			sql:  `CREATE ROLE "app" WITH LOGIN PASSWORD ` + pq.QuoteLiteral("secret"),
+			want: `CREATE ROLE "app" WITH LOGIN PASSWORD '********'`,
+		},
+		{
+			name: "quote in password",
+			sql:  `ALTER ROLE "app" WITH PASSWORD ` + pq.QuoteLiteral("it's secret") + ` VALID UNTIL 'infinity'`,
+			want: `ALTER ROLE "app" WITH PASSWORD '********' VALID UNTIL 'infinity'`,
+		},
+		{
+			name: "backslash in password",
+			sql:  `ALTER ROLE "app" WITH password ` + pq.QuoteLiteral(`back\slash`),
+			// pq.QuoteLiteral prefixes an escape string with a space
+			want: `ALTER ROLE "app" WITH password  '********'`,
+		},
+		{
+			name: "no password",
+			sql:  `GRANT "readers" TO "app"`,
+			want: `GRANT "readers" TO "app"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, RedactSql(test.sql))
+		})
+	}
+}
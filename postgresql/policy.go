@@ -0,0 +1,260 @@
+package postgresql
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+)
+
+const (
+	// PolicyEnvVar contains a json Policy that extends DefaultPolicy (see PolicyFromEnv)
+	PolicyEnvVar = "PROTECTION_POLICY"
+
+	ObjectRole     = "role"
+	ObjectDatabase = "database"
+)
+
+// Policy protects reserved roles and databases from being changed through pg-db-admin
+// Create, Update, and Drop of every resource are refused if the resource refers to a protected object
+// Protected names are glob patterns (see path.Match)
+type Policy struct {
+	// Disabled turns off the protection of every object
+	Disabled bool `json:"disabled"`
+	// ProtectedRoles are patterns of role names that cannot be created, altered, granted, or dropped
+	ProtectedRoles []string `json:"protectedRoles"`
+	// ProtectedDatabases are patterns of database names that cannot be created, altered, granted, or dropped
+	ProtectedDatabases []string `json:"protectedDatabases"`
+	// AllowedRoles are exceptions to ProtectedRoles
+	AllowedRoles []string `json:"allowedRoles"`
+	// AllowedDatabases are exceptions to ProtectedDatabases
+	AllowedDatabases []string `json:"allowedDatabases"`
+	// GrantableRoles are patterns of protected roles that can still be granted as a membership (e.g. predefined roles)
+	// The roles themselves remain protected from being created, altered, or dropped
+	GrantableRoles []string `json:"grantableRoles"`
+	// ProtectCurrentUser protects the role that pg-db-admin uses to connect
+	ProtectCurrentUser bool `json:"protectCurrentUser"`
+	// StrictNames requires new roles, databases, and schemas to use lowercase snake_case names (see ValidateName)
+	StrictNames bool `json:"strictNames"`
+}
+
+// DefaultPolicy protects roles and databases that are managed by postgres, the cloud provider, or pg-db-admin setup
+func DefaultPolicy() *Policy {
+	return &Policy{
+		ProtectedRoles:     []string{"postgres", "pg_*", "rds*", "cloudsql*", "azure_*", "nullstone_admin_role*"},
+		ProtectedDatabases: []string{"postgres", "template*", "rdsadmin", "cloudsql*", "azure_*"},
+		GrantableRoles:     []string{"pg_*", "rds_iam"},
+		ProtectCurrentUser: true,
+	}
+}
+
+// PolicyFromEnv creates DefaultPolicy extended by the json Policy in PROTECTION_POLICY
+// Protected and allowed names are added to the defaults
+func PolicyFromEnv() (*Policy, error) {
+	policy := DefaultPolicy()
+	raw := os.Getenv(PolicyEnvVar)
+	if raw == "" {
+		return policy, nil
+	}
+	var custom Policy
+	if err := json.Unmarshal([]byte(raw), &custom); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", PolicyEnvVar, err)
+	}
+	policy.Disabled = custom.Disabled
+	policy.StrictNames = custom.StrictNames
+	policy.ProtectedRoles = append(policy.ProtectedRoles, custom.ProtectedRoles...)
+	policy.ProtectedDatabases = append(policy.ProtectedDatabases, custom.ProtectedDatabases...)
+	policy.AllowedRoles = append(policy.AllowedRoles, custom.AllowedRoles...)
+	policy.AllowedDatabases = append(policy.AllowedDatabases, custom.AllowedDatabases...)
+	policy.GrantableRoles = append(policy.GrantableRoles, custom.GrantableRoles...)
+	return policy, nil
+}
+
+// ObjectRef identifies a role or database that a resource refers to
+type ObjectRef struct {
+	Kind string
+	Name string
+	// Membership is true if the role is only referenced as the target of a membership grant (see Policy.GrantableRoles)
+	Membership bool
+}
+
+func roleRefs(names ...string) []ObjectRef {
+	refs := make([]ObjectRef, 0, len(names))
+	for _, name := range names {
+		refs = append(refs, ObjectRef{Kind: ObjectRole, Name: name})
+	}
+	return refs
+}
+
+// membershipRefs refers to roles that are granted as a membership
+func membershipRefs(names ...string) []ObjectRef {
+	refs := make([]ObjectRef, 0, len(names))
+	for _, name := range names {
+		refs = append(refs, ObjectRef{Kind: ObjectRole, Name: name, Membership: true})
+	}
+	return refs
+}
+
+func databaseRef(name string) ObjectRef {
+	return ObjectRef{Kind: ObjectDatabase, Name: name}
+}
+
+// PolicyError is returned when an operation refers to a protected object
+type PolicyError struct {
+	Ref    ObjectRef
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("%s %q is protected and cannot be managed through pg-db-admin: %s", e.Ref.Kind, e.Ref.Name, e.Reason)
+}
+
+// Check returns a PolicyError for the first ref that is protected
+// currentUser is the role that pg-db-admin uses to connect
+func (p *Policy) Check(currentUser string, refs ...ObjectRef) error {
+	if p == nil || p.Disabled {
+		return nil
+	}
+	for _, ref := range refs {
+		if ref.Name == "" {
+			continue
+		}
+		switch ref.Kind {
+		case ObjectRole:
+			if p.ProtectCurrentUser && ref.Name == currentUser {
+				return &PolicyError{Ref: ref, Reason: "it is the role that pg-db-admin uses to connect"}
+			}
+			allowed := p.AllowedRoles
+			if ref.Membership {
+				allowed = append(append([]string{}, allowed...), p.GrantableRoles...)
+			}
+			if pattern, ok := matchProtected(ref.Name, p.ProtectedRoles, allowed); ok {
+				return &PolicyError{Ref: ref, Reason: fmt.Sprintf("it matches the reserved name %q", pattern)}
+			}
+		case ObjectDatabase:
+			if pattern, ok := matchProtected(ref.Name, p.ProtectedDatabases, p.AllowedDatabases); ok {
+				return &PolicyError{Ref: ref, Reason: fmt.Sprintf("it matches the reserved name %q", pattern)}
+			}
+		}
+	}
+	return nil
+}
+
+// matchProtected returns the protected pattern that matches name unless name also matches an allowed pattern
+func matchProtected(name string, protected, allowed []string) (string, bool) {
+	for _, pattern := range allowed {
+		if ok, _ := path.Match(pattern, name); ok {
+			return "", false
+		}
+	}
+	for _, pattern := range protected {
+		if ok, _ := path.Match(pattern, name); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// ProtectionPolicy returns the Policy that is enforced by the Store
+// A dry-run or recording Store enforces the Policy of its parent
+func (s *Store) ProtectionPolicy() *Policy {
+	if s.parent != nil {
+		return s.parent.ProtectionPolicy()
+	}
+	return s.Policy
+}
+
+// enforcePolicy returns a PolicyError if refs contains an object that is protected by the Policy of opener
+func enforcePolicy(opener DbOpener, refs ...ObjectRef) error {
+	provider, ok := opener.(interface{ ProtectionPolicy() *Policy })
+	if !ok {
+		return nil
+	}
+	policy := provider.ProtectionPolicy()
+	if policy == nil || policy.Disabled || len(refs) == 0 {
+		return nil
+	}
+	var currentUser string
+	if policy.ProtectCurrentUser {
+		db, err := opener.OpenDatabase("")
+		if err != nil {
+			return err
+		}
+		if currentUser, err = getCurrentUser(db); err != nil {
+			return stepError(StepAnalyze, err)
+		}
+	}
+	return policy.Check(currentUser, refs...)
+}
+
+// PolicyChecker checks many objects against the Policy of a DbOpener
+// The current user is only looked up once, so this is used when checking many objects (e.g. export, sessions)
+type PolicyChecker struct {
+	Policy      *Policy
+	CurrentUser string
+}
+
+func NewPolicyChecker(opener DbOpener) (*PolicyChecker, error) {
+	checker := &PolicyChecker{}
+	if provider, ok := opener.(interface{ ProtectionPolicy() *Policy }); ok {
+		checker.Policy = provider.ProtectionPolicy()
+	}
+	db, err := opener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+	if checker.CurrentUser, err = getCurrentUser(db); err != nil {
+		return nil, stepError(StepAnalyze, err)
+	}
+	return checker, nil
+}
+
+// Check returns a PolicyError for the first ref that is protected (see Policy.Check)
+func (c *PolicyChecker) Check(refs ...ObjectRef) error {
+	return c.Policy.Check(c.CurrentUser, refs...)
+}
+
+// IsManagedRole returns false if name is protected by the Policy or is the role that pg-db-admin uses to connect
+func (c *PolicyChecker) IsManagedRole(name string) bool {
+	return name != c.CurrentUser && c.Check(roleRefs(name)...) == nil
+}
+
+func (d Database) policyRefs() []ObjectRef {
+	return append(roleRefs(d.Owner), databaseRef(d.Name))
+}
+
+func (r Role) policyRefs() []ObjectRef {
+	return append(roleRefs(r.Name), membershipRefs(r.MemberOf...)...)
+}
+
+func (k RoleMemberKey) policyRefs() []ObjectRef {
+	return append(roleRefs(k.Member), membershipRefs(k.Target)...)
+}
+
+func (k SchemaKey) policyRefs() []ObjectRef {
+	return []ObjectRef{databaseRef(k.Database)}
+}
+
+func (s Schema) policyRefs() []ObjectRef {
+	return append(roleRefs(s.Owner), databaseRef(s.Database))
+}
+
+func (k SchemaPrivilegeKey) policyRefs() []ObjectRef {
+	return append(roleRefs(k.Role), databaseRef(k.Database))
+}
+
+func (k DefaultGrantKey) policyRefs() []ObjectRef {
+	return append(roleRefs(k.Role, k.Target), databaseRef(k.Database))
+}
+
+func (k DatabaseAccessKey) policyRefs() []ObjectRef {
+	return append(roleRefs(k.Role), databaseRef(k.Database))
+}
+
+func (j JitAccess) policyRefs() []ObjectRef {
+	return append(roleRefs(j.Role), membershipRefs(j.MemberOf...)...)
+}
+
+func (l CredentialLease) policyRefs() []ObjectRef {
+	return []ObjectRef{databaseRef(l.Database)}
+}
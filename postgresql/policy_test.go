@@ -0,0 +1,49 @@
+package postgresql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.AllowedRoles = []string{"rds_app"}
+
+	tests := []struct {
+		name        string
+		currentUser string
+		ref         ObjectRef
+		protected   bool
+	}{
+		{name: "unprotected role", ref: ObjectRef{Kind: ObjectRole, Name: "app"}},
+		{name: "reserved role", ref: ObjectRef{Kind: ObjectRole, Name: "rds_superuser"}, protected: true},
+		{name: "allowed role", ref: ObjectRef{Kind: ObjectRole, Name: "rds_app"}},
+		{name: "predefined role", ref: ObjectRef{Kind: ObjectRole, Name: "pg_monitor"}, protected: true},
+		{name: "grantable membership", ref: ObjectRef{Kind: ObjectRole, Name: "pg_monitor", Membership: true}},
+		{name: "membership that is not grantable", ref: ObjectRef{Kind: ObjectRole, Name: "rds_superuser", Membership: true}, protected: true},
+		{name: "current user", currentUser: "pda", ref: ObjectRef{Kind: ObjectRole, Name: "pda"}, protected: true},
+		{name: "template database", ref: ObjectRef{Kind: ObjectDatabase, Name: "template1"}, protected: true},
+		{name: "unprotected database", ref: ObjectRef{Kind: ObjectDatabase, Name: "app"}},
+		{name: "empty name", ref: ObjectRef{Kind: ObjectRole, Name: ""}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := policy.Check(test.currentUser, test.ref)
+			if test.protected {
+				var policyErr *PolicyError
+				if assert.ErrorAs(t, err, &policyErr) {
+					assert.Equal(t, test.ref, policyErr.Ref)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		disabled := &Policy{Disabled: true, ProtectedRoles: []string{"*"}}
+		assert.NoError(t, disabled.Check("", ObjectRef{Kind: ObjectRole, Name: "postgres"}))
+		var nilPolicy *Policy
+		assert.NoError(t, nilPolicy.Check("", ObjectRef{Kind: ObjectRole, Name: "postgres"}))
+	})
+}
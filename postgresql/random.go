@@ -0,0 +1,145 @@
+package postgresql
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+const (
+	randomPasswordLength  = 16
+	randomPasswordSymbols = "!#$%&*()-_=+[]{}<>:?"
+	scramIterations       = 4096
+)
+
+// RandomRoleCreds generates a role name with usernamePrefix and a random suffix, and a random password
+// The password contains every character class and satisfies policy (see RandomPassword)
+func RandomRoleCreds(usernamePrefix string, policy *PasswordPolicy) (string, string, error) {
+	usernameSuffix, err := randomString(5, "")
+	if err != nil {
+		return "", "", fmt.Errorf("error generating username: %w", err)
+	}
+	username := fmt.Sprintf("%s_%s", usernamePrefix, string(usernameSuffix))
+	password, err := RandomPassword(username, policy)
+	if err != nil {
+		return "", "", err
+	}
+	return username, password, nil
+}
+
+// RandomPassword generates a random password for roleName that contains every character class and satisfies policy
+// If policy requires SCRAM, the caller must hash the password before setting it (see PasswordPolicy.PasswordSecret)
+func RandomPassword(roleName string, policy *PasswordPolicy) (string, error) {
+	var plaintext *PasswordPolicy
+	length := randomPasswordLength
+	if policy != nil {
+		copied := *policy
+		copied.RequireScram = false
+		plaintext = &copied
+		length = max(length, policy.MinLength)
+	}
+	for range 10 {
+		passwordRaw, err := randomPassword(int64(length))
+		if err != nil {
+			return "", fmt.Errorf("error generating password: %w", err)
+		}
+		if plaintext.Validate(roleName, string(passwordRaw)) == nil {
+			return string(passwordRaw), nil
+		}
+	}
+	return "", fmt.Errorf("error generating password: unable to satisfy the password policy")
+}
+
+// ScramVerifier hashes password into a SCRAM-SHA-256 verifier that postgres accepts in place of a plaintext password
+func ScramVerifier(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	salted, err := pbkdf2.Key(sha256.New, password, salt, scramIterations, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+	clientKey := hmacSha256(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	serverKey := hmacSha256(salted, "Server Key")
+	enc := base64.StdEncoding
+	return fmt.Sprintf("SCRAM-SHA-256$%d:%s$%s:%s", scramIterations, enc.EncodeToString(salt),
+		enc.EncodeToString(storedKey[:]), enc.EncodeToString(serverKey)), nil
+}
+
+func hmacSha256(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// randomPassword generates a random password with at least one uppercase letter, lowercase letter, digit, and symbol
+func randomPassword(length int64) ([]byte, error) {
+	const numChars = "0123456789"
+	const lowerChars = "abcdefghijklmnopqrstuvwxyz"
+	const upperChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	var result []byte
+	for _, charSet := range []string{upperChars, lowerChars, numChars, randomPasswordSymbols} {
+		s, err := generateRandomBytes(&charSet, 1)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, s...)
+	}
+	rest, err := randomString(length-int64(len(result)), randomPasswordSymbols)
+	if err != nil {
+		return nil, err
+	}
+	return shuffle(append(result, rest...))
+}
+
+func randomString(length int64, specialChars string) ([]byte, error) {
+	const numChars = "0123456789"
+	const lowerChars = "abcdefghijklmnopqrstuvwxyz"
+	const upperChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	var result []byte
+
+	var chars = upperChars + lowerChars + numChars + specialChars
+
+	result = make([]byte, 0, length)
+
+	s, err := generateRandomBytes(&chars, length)
+	if err != nil {
+		return nil, err
+	}
+
+	result = append(result, s...)
+	return shuffle(result)
+}
+
+func shuffle(result []byte) ([]byte, error) {
+	order := make([]byte, len(result))
+	if _, err := rand.Read(order); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return order[i] < order[j]
+	})
+
+	return result, nil
+}
+
+func generateRandomBytes(charSet *string, length int64) ([]byte, error) {
+	bytes := make([]byte, length)
+	setLen := big.NewInt(int64(len(*charSet)))
+	for i := range bytes {
+		idx, err := rand.Int(rand.Reader, setLen)
+		if err != nil {
+			return nil, err
+		}
+		bytes[i] = (*charSet)[idx.Int64()]
+	}
+	return bytes, nil
+}
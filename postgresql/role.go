@@ -7,29 +7,83 @@ import (
 	"github.com/lib/pq"
 	"github.com/nullstone-io/go-rest-api"
 	"log"
+	"slices"
 	"strings"
 )
 
 type Role struct {
 	Name     string `json:"name"`
-	Password string `json:"password"`
+	Password string `json:"password,omitempty"`
 	// Do not error if trying to create a role that already exists
 	// Instead, read the existing, set the password, and return
 	UseExisting bool `json:"useExisting"`
 	// SkipPasswordUpdate informs Create to skip updating the role's password if the role already exists
 	SkipPasswordUpdate bool `json:"-"`
+	// SkipIamRevoke informs Update to keep IAM authentication on an existing role that does not enable it
+	// This is set by setup so that re-running it without IAM does not lock out an admin role that uses IAM auth tokens
+	SkipIamRevoke bool `json:"-"`
 
 	MemberOf   []string       `json:"memberOf"`
 	Attributes RoleAttributes `json:"attributes"`
+	// ExclusiveMemberOf informs Update to revoke memberships that are not in MemberOf or RetainMemberOf
+	// This is set by manifest apply for roles that specify memberOf
+	ExclusiveMemberOf bool `json:"-"`
+	// RetainMemberOf contains memberships that are managed elsewhere (e.g. manifest role members and database access)
+	RetainMemberOf []string `json:"-"`
+
+	// Iam enables IAM database authentication instead of a password
+	// On AWS RDS, the role is granted rds_iam
+	// On Cloud SQL, the role is named after the IAM principal (see IamRoleName)
+	// and is granted cloudsqliamserviceaccount or cloudsqliamuser
+	Iam bool `json:"iam"`
 }
 
 func (r Role) Key() string {
+	if r.Iam {
+		return IamRoleName(r.Name)
+	}
 	return r.Name
 }
 
+// UnlistedMemberOf returns the memberships in live that Update revokes (see ExclusiveMemberOf)
+func (r Role) UnlistedMemberOf(live []string) []string {
+	unlisted := make([]string, 0)
+	if !r.ExclusiveMemberOf {
+		return unlisted
+	}
+	for _, m := range live {
+		if !slices.Contains(r.MemberOf, m) && !slices.Contains(r.RetainMemberOf, m) {
+			unlisted = append(unlisted, m)
+		}
+	}
+	return unlisted
+}
+
+// RoleAttributes contains optional role attributes
+// A nil attribute is not granted to a new role and is left unchanged on an existing role
 type RoleAttributes struct {
-	CreateDb   bool `json:"createDb"`
-	CreateRole bool `json:"createRole"`
+	CreateDb   *bool `json:"createDb,omitempty"`
+	CreateRole *bool `json:"createRole,omitempty"`
+}
+
+// alterKeywords returns the keywords that change existing to the attributes that are set in a
+func (a RoleAttributes) alterKeywords(existing RoleAttributes) []string {
+	keywords := make([]string, 0)
+	if a.CreateDb != nil && !isAttributeEqual(a.CreateDb, existing.CreateDb) {
+		keywords = append(keywords, attributeKeyword("CREATEDB", *a.CreateDb))
+	}
+	if a.CreateRole != nil && !isAttributeEqual(a.CreateRole, existing.CreateRole) {
+		keywords = append(keywords, attributeKeyword("CREATEROLE", *a.CreateRole))
+	}
+	return keywords
+}
+
+func isAttributeEqual(a, b *bool) bool {
+	return isAttributeEnabled(a) == isAttributeEnabled(b)
+}
+
+func isAttributeEnabled(a *bool) bool {
+	return a != nil && *a
 }
 
 var _ rest.DataAccess[string, Role] = &Roles{}
@@ -39,6 +93,19 @@ type Roles struct {
 }
 
 func (r *Roles) Create(role Role) (*Role, error) {
+	role = role.withIam()
+	if err := validateNames(r.DbOpener, true, role.nameFields()...); err != nil {
+		return nil, err
+	}
+	// An existing role keeps its password if SkipPasswordUpdate is set (see Update)
+	if !role.UseExisting || !role.SkipPasswordUpdate {
+		if err := validatePassword(r.DbOpener, role.Name, role.Password); err != nil {
+			return nil, err
+		}
+	}
+	if err := enforcePolicy(r.DbOpener, role.policyRefs()...); err != nil {
+		return nil, err
+	}
 	if role.UseExisting {
 		if existing, err := r.Read(role.Name); err != nil {
 			return nil, err
@@ -53,9 +120,25 @@ func (r *Roles) Create(role Role) (*Role, error) {
 		return nil, err
 	}
 
+	toCreate := role
+	if role.Iam {
+		info, err := CalcDbConnectionInfo(db)
+		if err != nil {
+			return nil, stepErrorf(StepAnalyze, "error analyzing database: %w", err)
+		}
+		group, err := iamGroup(info.Flavor, role.Name)
+		if err != nil {
+			return nil, err
+		}
+		toCreate.MemberOf = append(slices.Clone(role.MemberOf), group)
+	}
+
 	fmt.Printf("Creating role %q\n", role.Name)
-	if _, err := db.Exec(r.generateCreateSql(role)); err != nil {
-		return nil, fmt.Errorf("error creating user %q: %w", role.Name, err)
+	if _, err := db.Exec(r.generateCreateSql(toCreate)); err != nil {
+		return nil, stepErrorf(StepCreateRole, "error creating user %q: %w", role.Name, err)
+	}
+	if role.Password != "" {
+		recordPasswordChange(db, role.Name)
 	}
 	return &role, nil
 }
@@ -66,23 +149,62 @@ func (r *Roles) Read(key string) (*Role, error) {
 		return nil, err
 	}
 
-	var name string
-	row := db.QueryRow(`SELECT rolname from pg_roles WHERE rolname = $1`, key)
-	if err := row.Scan(&name); err != nil {
+	sq := `SELECT r.rolname, r.rolcreatedb, r.rolcreaterole,
+	ARRAY(SELECT b.rolname FROM pg_auth_members m JOIN pg_roles b ON m.roleid = b.oid WHERE m.member = r.oid AND b.rolname NOT IN ` + iamRolesSql() + ` ORDER BY b.rolname),
+	EXISTS(SELECT 1 FROM pg_auth_members m JOIN pg_roles b ON m.roleid = b.oid WHERE m.member = r.oid AND b.rolname IN ` + iamRolesSql() + `)
+FROM pg_roles r
+WHERE r.rolname = $1`
+	var role Role
+	var createDb, createRole bool
+	row := db.QueryRow(sq, key)
+	if err := row.Scan(&role.Name, &createDb, &createRole, pq.Array(&role.MemberOf), &role.Iam); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
-		return nil, err
+		return nil, stepError(StepReadRole, err)
 	}
-	return &Role{Name: name}, nil
+	role.Attributes = RoleAttributes{CreateDb: &createDb, CreateRole: &createRole}
+	return &role, nil
 }
 
+// Update sets the password of the role and grants any missing MemberOf roles
+// Attributes that are set and differ from the existing role are altered as well
+// If ExclusiveMemberOf is set, memberships that are no longer listed are revoked
+// If Iam differs from the existing role, IAM authentication is enabled or disabled
 func (r *Roles) Update(key string, role Role) (*Role, error) {
+	role = role.withIam()
+	if role.Iam {
+		key = IamRoleName(key)
+	}
+	if err := validateNames(r.DbOpener, false, role.nameFields()...); err != nil {
+		return nil, err
+	}
+	if !role.SkipPasswordUpdate {
+		if err := validatePassword(r.DbOpener, role.Name, role.Password); err != nil {
+			return nil, err
+		}
+	}
+	if err := enforcePolicy(r.DbOpener, append(role.policyRefs(), roleRefs(key)...)...); err != nil {
+		return nil, err
+	}
 	db, err := r.DbOpener.OpenDatabase("")
 	if err != nil {
 		return nil, err
 	}
 
+	existing, err := r.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if err := r.reconcile(db, *existing, role); err != nil {
+			return nil, err
+		}
+		if err := r.reconcileIam(db, *existing, role); err != nil {
+			return nil, err
+		}
+	}
+
 	if role.Password == "" {
 		return &role, nil
 	}
@@ -91,26 +213,99 @@ func (r *Roles) Update(key string, role Role) (*Role, error) {
 		role.Password = ""
 		return &role, nil
 	}
-	log.Printf("Setting password for %q\n", role.Name)
-	updateSql := fmt.Sprintf(`ALTER ROLE %s WITH PASSWORD %s`, pq.QuoteIdentifier(role.Name), pq.QuoteLiteral(role.Password))
-	if _, err := db.Exec(updateSql); err != nil {
-		return nil, fmt.Errorf("error setting password: %w", err)
+	if err := setPassword(db, role.Name, role.Password); err != nil {
+		return nil, err
 	}
-	log.Printf("Password set for %q\n", role.Name)
 	return &role, nil
 }
 
+// SetPassword changes only the password of an existing role
+// The password is not validated against the PasswordPolicy so that a previous password can be restored (see setup rotation)
+func (r *Roles) SetPassword(name, password string) error {
+	if err := enforcePolicy(r.DbOpener, roleRefs(name)...); err != nil {
+		return err
+	}
+	db, err := r.DbOpener.OpenDatabase("")
+	if err != nil {
+		return err
+	}
+	return setPassword(db, name, password)
+}
+
+func setPassword(db DB, name, password string) error {
+	log.Printf("Setting password for %q\n", name)
+	updateSql := fmt.Sprintf(`ALTER ROLE %s WITH PASSWORD %s`, pq.QuoteIdentifier(name), pq.QuoteLiteral(password))
+	if _, err := db.Exec(updateSql); err != nil {
+		return stepErrorf(StepSetPassword, "error setting password: %w", err)
+	}
+	log.Printf("Password set for %q\n", name)
+	recordPasswordChange(db, name)
+	return nil
+}
+
+func (r *Roles) reconcile(db DB, existing Role, role Role) error {
+	if keywords := role.Attributes.alterKeywords(existing.Attributes); len(keywords) > 0 {
+		log.Printf("Altering attributes of %q\n", role.Name)
+		sq := fmt.Sprintf("ALTER ROLE %s WITH %s", pq.QuoteIdentifier(role.Name), strings.Join(keywords, " "))
+		if _, err := db.Exec(sq); err != nil {
+			return stepErrorf(StepAlterRole, "error altering role %q: %w", role.Name, err)
+		}
+	}
+	for _, m := range role.MemberOf {
+		if slices.Contains(existing.MemberOf, m) {
+			continue
+		}
+		if err := checkMembershipCycle(db, role.Name, m); err != nil {
+			return err
+		}
+		log.Printf("Granting %q membership to %q\n", m, role.Name)
+		if _, err := db.Exec(fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(m), pq.QuoteIdentifier(role.Name))); err != nil {
+			return stepErrorf(StepGrantMembership, "error granting %q membership to %q: %w", m, role.Name, err)
+		}
+	}
+	for _, m := range role.UnlistedMemberOf(existing.MemberOf) {
+		log.Printf("Revoking %q membership from %q\n", m, role.Name)
+		if _, err := db.Exec(fmt.Sprintf("REVOKE %s FROM %s", pq.QuoteIdentifier(m), pq.QuoteIdentifier(role.Name))); err != nil {
+			return stepErrorf(StepRevokeMembership, "error revoking %q membership from %q: %w", m, role.Name, err)
+		}
+	}
+	return nil
+}
+
+// withIam applies the IAM naming convention and clears the password of an IAM role
+// An IAM role authenticates with tokens, so its password is neither validated nor set
+func (r Role) withIam() Role {
+	if r.Iam {
+		r.Name = IamRoleName(r.Name)
+		if r.Password != "" {
+			log.Printf("Ignoring password for IAM role %q\n", r.Name)
+			r.Password = ""
+		}
+	}
+	return r
+}
+
+func attributeKeyword(keyword string, enabled bool) string {
+	if enabled {
+		return keyword
+	}
+	return "NO" + keyword
+}
+
 func (r *Roles) Drop(key string) (bool, error) {
+	if err := enforcePolicy(r.DbOpener, roleRefs(key)...); err != nil {
+		return false, err
+	}
 	return true, nil
 }
 
 func (*Roles) generateCreateSql(role Role) string {
 	b := bytes.NewBufferString("CREATE ROLE ")
 	fmt.Fprint(b, pq.QuoteIdentifier(role.Name), " WITH LOGIN")
-	if role.Attributes.CreateRole {
+	if isAttributeEnabled(role.Attributes.CreateRole) {
 		fmt.Fprint(b, " CREATEROLE")
 	}
-	if role.Attributes.CreateDb {
+	if isAttributeEnabled(role.Attributes.CreateDb) {
 		fmt.Fprint(b, " CREATEDB")
 	}
 	if len(role.MemberOf) > 0 {
@@ -126,3 +321,54 @@ func (*Roles) generateCreateSql(role Role) string {
 	}
 	return b.String()
 }
+
+type RoleFilter struct {
+	ListOptions
+	NamePrefix string `json:"namePrefix"`
+	LoginOnly  bool   `json:"loginOnly"`
+}
+
+// List retrieves roles sorted by name
+// System roles (e.g. pg_*, rds*) are excluded
+func (r *Roles) List(filter RoleFilter) (*Page[Role], error) {
+	db, err := r.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+
+	sq := `SELECT r.rolname, r.rolcreatedb, r.rolcreaterole,
+	ARRAY(SELECT b.rolname FROM pg_auth_members m JOIN pg_roles b ON m.roleid = b.oid WHERE m.member = r.oid AND b.rolname NOT IN ` + iamRolesSql() + ` ORDER BY b.rolname),
+	EXISTS(SELECT 1 FROM pg_auth_members m JOIN pg_roles b ON m.roleid = b.oid WHERE m.member = r.oid AND b.rolname IN ` + iamRolesSql() + `)
+FROM pg_roles r
+WHERE ` + excludeSystemRolesSql("r.rolname") + ` AND r.rolname > $1`
+	args := []any{filter.PageToken}
+	if filter.NamePrefix != "" {
+		args = append(args, filter.NamePrefix)
+		sq += fmt.Sprintf(" AND left(r.rolname, length($%d)) = $%d", len(args), len(args))
+	}
+	if filter.LoginOnly {
+		sq += " AND r.rolcanlogin"
+	}
+	sq += fmt.Sprintf(" ORDER BY r.rolname LIMIT %d", filter.limit()+1)
+
+	rows, err := db.Query(sq, args...)
+	if err != nil {
+		return nil, stepErrorf(StepList, "error listing roles: %w", err)
+	}
+	defer rows.Close()
+
+	items := make([]Role, 0)
+	for rows.Next() {
+		var cur Role
+		var createDb, createRole bool
+		if err := rows.Scan(&cur.Name, &createDb, &createRole, pq.Array(&cur.MemberOf), &cur.Iam); err != nil {
+			return nil, fmt.Errorf("error reading role: %w", err)
+		}
+		cur.Attributes = RoleAttributes{CreateDb: &createDb, CreateRole: &createRole}
+		items = append(items, cur)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing roles: %w", err)
+	}
+	return newPage(items, filter.ListOptions, Role.Key), nil
+}
@@ -43,6 +43,12 @@ type RoleMembers struct {
 }
 
 func (r *RoleMembers) Create(membership RoleMember) (*RoleMember, error) {
+	if err := validateNames(r.DbOpener, true, membership.Key().nameFields()...); err != nil {
+		return nil, err
+	}
+	if err := enforcePolicy(r.DbOpener, membership.Key().policyRefs()...); err != nil {
+		return nil, err
+	}
 	if membership.UseExisting {
 		key := RoleMemberKey{
 			Member: membership.Member,
@@ -61,14 +67,19 @@ func (r *RoleMembers) Create(membership RoleMember) (*RoleMember, error) {
 		return nil, err
 	}
 
+	if err := checkMembershipCycle(db, membership.Member, membership.Target); err != nil {
+		return nil, err
+	}
 	sq := fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(membership.Target), pq.QuoteIdentifier(membership.Member))
 	if membership.WithAdminOption {
 		sq = sq + " WITH ADMIN OPTION"
 	}
 
 	log.Printf("Creating role membership (role=%s, member=%s)\n", membership.Target, membership.Member)
-	_, err = db.Exec(sq)
-	return &membership, err
+	if _, err := db.Exec(sq); err != nil {
+		return nil, stepErrorf(StepGrantMembership, "error granting %q membership to %q: %w", membership.Target, membership.Member, err)
+	}
+	return &membership, nil
 }
 
 func (r *RoleMembers) Read(key RoleMemberKey) (*RoleMember, error) {
@@ -93,15 +104,99 @@ WHERE pg_get_userbyid(member) = $1 AND pg_get_userbyid(roleid) = $2`
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
-		return nil, err
+		return nil, stepError(StepReadMembership, err)
 	}
 	return &membership, nil
 }
 
+// Update adds the admin option to an existing membership if WithAdminOption is set
+// The admin option is not revoked if WithAdminOption is false
 func (r *RoleMembers) Update(key RoleMemberKey, membership RoleMember) (*RoleMember, error) {
-	return &membership, nil
+	if err := validateNames(r.DbOpener, false, key.nameFields()...); err != nil {
+		return nil, err
+	}
+	if err := enforcePolicy(r.DbOpener, append(membership.Key().policyRefs(), key.policyRefs()...)...); err != nil {
+		return nil, err
+	}
+	if !membership.WithAdminOption {
+		return &membership, nil
+	}
+	existing, err := r.Read(key)
+	if err != nil || existing == nil || existing.WithAdminOption {
+		return existing, err
+	}
+
+	db, err := r.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Adding admin option to role membership (role=%s, member=%s)\n", key.Target, key.Member)
+	sq := fmt.Sprintf("GRANT %s TO %s WITH ADMIN OPTION", pq.QuoteIdentifier(key.Target), pq.QuoteIdentifier(key.Member))
+	if _, err := db.Exec(sq); err != nil {
+		return nil, stepErrorf(StepGrantMembership, "error granting %q membership to %q: %w", key.Target, key.Member, err)
+	}
+	existing.WithAdminOption = true
+	return existing, nil
+}
+
+// revoke removes Member from Target
+func (r *RoleMembers) revoke(key RoleMemberKey) error {
+	db, err := r.DbOpener.OpenDatabase("")
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Revoking role membership (role=%s, member=%s)\n", key.Target, key.Member)
+	sq := fmt.Sprintf("REVOKE %s FROM %s", pq.QuoteIdentifier(key.Target), pq.QuoteIdentifier(key.Member))
+	if _, err := db.Exec(sq); err != nil {
+		return stepErrorf(StepRevokeMembership, "error revoking %q membership from %q: %w", key.Target, key.Member, err)
+	}
+	return nil
 }
 
 func (r *RoleMembers) Drop(key RoleMemberKey) (bool, error) {
+	if err := enforcePolicy(r.DbOpener, key.policyRefs()...); err != nil {
+		return false, err
+	}
 	return true, nil
 }
+
+type RoleMemberFilter struct {
+	ListOptions
+	Target string `json:"target"`
+}
+
+// List retrieves the members of the Target role sorted by member name
+// System roles (e.g. pg_*, rds*) are excluded
+func (r *RoleMembers) List(filter RoleMemberFilter) (*Page[RoleMember], error) {
+	db, err := r.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+
+	// Since postgres 16, a membership may be granted multiple times by different grantors
+	sq := `SELECT pg_get_userbyid(m.member) as member, pg_get_userbyid(m.roleid) as target, bool_or(m.admin_option)
+FROM pg_auth_members m
+WHERE pg_get_userbyid(m.roleid) = $1 AND pg_get_userbyid(m.member) > $2 AND ` + excludeSystemRolesSql("pg_get_userbyid(m.member)") + `
+GROUP BY m.member, m.roleid
+ORDER BY 1` + fmt.Sprintf(" LIMIT %d", filter.limit()+1)
+
+	rows, err := db.Query(sq, filter.Target, filter.PageToken)
+	if err != nil {
+		return nil, stepErrorf(StepList, "error listing role members: %w", err)
+	}
+	defer rows.Close()
+
+	items := make([]RoleMember, 0)
+	for rows.Next() {
+		var cur RoleMember
+		if err := rows.Scan(&cur.Member, &cur.Target, &cur.WithAdminOption); err != nil {
+			return nil, fmt.Errorf("error reading role member: %w", err)
+		}
+		items = append(items, cur)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing role members: %w", err)
+	}
+	return newPage(items, filter.ListOptions, func(m RoleMember) string { return m.Member }), nil
+}
@@ -0,0 +1,153 @@
+package postgresql
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/nullstone-io/go-rest-api"
+	"log"
+)
+
+// Schema is a namespace within Database that is owned by Owner
+type Schema struct {
+	Name     string `json:"name"`
+	Database string `json:"database"`
+	Owner    string `json:"owner"`
+}
+
+func (s Schema) Key() SchemaKey {
+	return SchemaKey{
+		Database: s.Database,
+		Name:     s.Name,
+	}
+}
+
+type SchemaKey struct {
+	Database string
+	Name     string
+}
+
+var _ rest.DataAccess[SchemaKey, Schema] = &Schemas{}
+
+type Schemas struct {
+	DbOpener DbOpener
+}
+
+func (s *Schemas) Create(obj Schema) (*Schema, error) {
+	if err := validateNames(s.DbOpener, true, obj.nameFields()...); err != nil {
+		return nil, err
+	}
+	if err := enforcePolicy(s.DbOpener, obj.policyRefs()...); err != nil {
+		return nil, err
+	}
+	if existing, err := s.Read(obj.Key()); err != nil {
+		return nil, err
+	} else if existing != nil {
+		log.Printf("[Create] Schema %q already exists in %q, updating...\n", obj.Name, obj.Database)
+		return s.Update(obj.Key(), obj)
+	}
+
+	db, err := s.DbOpener.OpenDatabase(obj.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	sq := fmt.Sprintf("CREATE SCHEMA %s", pq.QuoteIdentifier(obj.Name))
+	if obj.Owner != "" {
+		sq += fmt.Sprintf(" AUTHORIZATION %s", pq.QuoteIdentifier(obj.Owner))
+	}
+	log.Printf("Creating schema %q in %q\n", obj.Name, obj.Database)
+	if err := execWithMembership(db, obj.Owner, StepCreateSchema, sq); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+func (s *Schemas) Read(key SchemaKey) (*Schema, error) {
+	db, err := s.DbOpener.OpenDatabase(key.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := Schema{Name: key.Name, Database: key.Database}
+	row := db.QueryRow(`SELECT pg_get_userbyid(nspowner) FROM pg_namespace WHERE nspname = $1`, key.Name)
+	if err := row.Scan(&obj.Owner); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, stepError(StepReadSchema, err)
+	}
+	return &obj, nil
+}
+
+func (s *Schemas) Update(key SchemaKey, obj Schema) (*Schema, error) {
+	if err := validateNames(s.DbOpener, false, append(key.nameFields(), optionalReference("owner", obj.Owner))...); err != nil {
+		return nil, err
+	}
+	if err := enforcePolicy(s.DbOpener, append(obj.policyRefs(), key.policyRefs()...)...); err != nil {
+		return nil, err
+	}
+	existing, err := s.Read(key)
+	if err != nil || existing == nil {
+		return existing, err
+	}
+	if obj.Owner == "" || obj.Owner == existing.Owner {
+		return existing, nil
+	}
+
+	db, err := s.DbOpener.OpenDatabase(key.Database)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Changing owner of schema %q in %q to %q\n", key.Name, key.Database, obj.Owner)
+	sq := fmt.Sprintf("ALTER SCHEMA %s OWNER TO %s", pq.QuoteIdentifier(key.Name), pq.QuoteIdentifier(obj.Owner))
+	if err := execWithMembership(db, obj.Owner, StepAlterOwner, sq); err != nil {
+		return nil, err
+	}
+	existing.Owner = obj.Owner
+	return existing, nil
+}
+
+func (s *Schemas) Drop(key SchemaKey) (bool, error) {
+	if err := enforcePolicy(s.DbOpener, key.policyRefs()...); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type SchemaFilter struct {
+	ListOptions
+	Database string `json:"database"`
+}
+
+// List retrieves the schemas in Database sorted by name
+// System schemas (e.g. pg_catalog, information_schema) and the default public schema are excluded
+func (s *Schemas) List(filter SchemaFilter) (*Page[Schema], error) {
+	db, err := s.DbOpener.OpenDatabase(filter.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	sq := `SELECT nspname, pg_get_userbyid(nspowner)
+FROM pg_namespace
+WHERE nspname <> ALL($1) AND left(nspname, 3) <> 'pg_' AND nspname > $2
+ORDER BY nspname` + fmt.Sprintf(" LIMIT %d", filter.limit()+1)
+	rows, err := db.Query(sq, pq.Array(excludedSchemaNames), filter.PageToken)
+	if err != nil {
+		return nil, stepErrorf(StepList, "error listing schemas in database %q: %w", filter.Database, err)
+	}
+	defer rows.Close()
+
+	items := make([]Schema, 0)
+	for rows.Next() {
+		cur := Schema{Database: filter.Database}
+		if err := rows.Scan(&cur.Name, &cur.Owner); err != nil {
+			return nil, fmt.Errorf("error reading schema: %w", err)
+		}
+		items = append(items, cur)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing schemas: %w", err)
+	}
+	return newPage(items, filter.ListOptions, func(s Schema) string { return s.Name }), nil
+}
@@ -1,6 +1,7 @@
 package postgresql
 
 import (
+	"database/sql"
 	"fmt"
 	"github.com/lib/pq"
 	"github.com/nullstone-io/go-rest-api"
@@ -35,11 +36,41 @@ type SchemaPrivileges struct {
 }
 
 func (r *SchemaPrivileges) Create(obj SchemaPrivilege) (*SchemaPrivilege, error) {
+	if err := validateNames(r.DbOpener, true, obj.Key().nameFields()...); err != nil {
+		return nil, err
+	}
+	if err := enforcePolicy(r.DbOpener, obj.Key().policyRefs()...); err != nil {
+		return nil, err
+	}
 	return r.Update(obj.Key(), obj)
 }
 
+// Read verifies that Role was granted the privileges on the public schema and Database directly
+// Privileges that Role inherits through membership are not considered
+// If any privilege is missing, nil is returned
 func (r *SchemaPrivileges) Read(key SchemaPrivilegeKey) (*SchemaPrivilege, error) {
-	// TODO: Introspect
+	db, err := r.DbOpener.OpenDatabase(key.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	sq := `SELECT
+	(SELECT count(DISTINCT a.privilege_type) FROM pg_namespace n, aclexplode(n.nspacl) a
+		WHERE n.nspname = 'public' AND a.grantee = r.oid AND a.privilege_type IN ('CREATE', 'USAGE')),
+	(SELECT count(DISTINCT a.privilege_type) FROM pg_database d, aclexplode(d.datacl) a
+		WHERE d.datname = $2 AND a.grantee = r.oid AND a.privilege_type IN ('CREATE', 'CONNECT', 'TEMPORARY'))
+FROM pg_roles r
+WHERE r.rolname = $1`
+	var schemaPrivs, dbPrivs int
+	if err := db.QueryRow(sq, key.Role, key.Database).Scan(&schemaPrivs, &dbPrivs); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, stepError(StepReadPrivileges, err)
+	}
+	if schemaPrivs < 2 || dbPrivs < 3 {
+		return nil, nil
+	}
 	obj := SchemaPrivilege{
 		Role:     key.Role,
 		Database: key.Database,
@@ -47,7 +78,16 @@ func (r *SchemaPrivileges) Read(key SchemaPrivilegeKey) (*SchemaPrivilege, error
 	return &obj, nil
 }
 
+// Update grants the privileges to the role and database in key
+// The policy is also enforced on obj so that a body cannot refer to a different, protected object
 func (r *SchemaPrivileges) Update(key SchemaPrivilegeKey, obj SchemaPrivilege) (*SchemaPrivilege, error) {
+	if err := validateNames(r.DbOpener, false, key.nameFields()...); err != nil {
+		return nil, err
+	}
+	if err := enforcePolicy(r.DbOpener, append(obj.Key().policyRefs(), key.policyRefs()...)...); err != nil {
+		return nil, err
+	}
+	obj.Role, obj.Database = key.Role, key.Database
 	db, err := r.DbOpener.OpenDatabase(obj.Database)
 	if err != nil {
 		return nil, err
@@ -59,10 +99,74 @@ func (r *SchemaPrivileges) Update(key SchemaPrivilegeKey, obj SchemaPrivilege) (
 		// CREATE | CONNECT | TEMPORARY | TEMP
 		fmt.Sprintf(`GRANT ALL PRIVILEGES ON DATABASE %s TO %s;`, pq.QuoteIdentifier(obj.Database), pq.QuoteIdentifier(obj.Role)),
 	}, " ")
-	_, err = db.Exec(sq)
-	return &obj, err
+	if _, err := db.Exec(sq); err != nil {
+		return nil, stepErrorf(StepGrantPrivileges, "error granting privileges on %q to %q: %w", obj.Database, obj.Role, err)
+	}
+	return &obj, nil
+}
+
+// revoke removes the privileges that were granted by Update
+func (r *SchemaPrivileges) revoke(key SchemaPrivilegeKey) error {
+	db, err := r.DbOpener.OpenDatabase(key.Database)
+	if err != nil {
+		return err
+	}
+
+	sq := strings.Join([]string{
+		fmt.Sprintf(`REVOKE ALL PRIVILEGES ON SCHEMA public FROM %s;`, pq.QuoteIdentifier(key.Role)),
+		fmt.Sprintf(`REVOKE ALL PRIVILEGES ON DATABASE %s FROM %s;`, pq.QuoteIdentifier(key.Database), pq.QuoteIdentifier(key.Role)),
+	}, " ")
+	if _, err := db.Exec(sq); err != nil {
+		return stepErrorf(StepRevokePrivileges, "error revoking privileges on %q from %q: %w", key.Database, key.Role, err)
+	}
+	return nil
 }
 
 func (r *SchemaPrivileges) Drop(key SchemaPrivilegeKey) (bool, error) {
+	if err := enforcePolicy(r.DbOpener, key.policyRefs()...); err != nil {
+		return false, err
+	}
 	return true, nil
 }
+
+type SchemaPrivilegeFilter struct {
+	ListOptions
+	Database string `json:"database"`
+}
+
+// List retrieves the roles that were granted privileges on the public schema and Database sorted by role
+// Like Read, only roles that were granted every privilege directly are included
+// System roles (e.g. pg_*, rds*) are excluded
+func (r *SchemaPrivileges) List(filter SchemaPrivilegeFilter) (*Page[SchemaPrivilege], error) {
+	db, err := r.DbOpener.OpenDatabase(filter.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	sq := `SELECT r.rolname
+FROM pg_roles r
+WHERE r.rolname > $2 AND ` + excludeSystemRolesSql("r.rolname") + `
+	AND (SELECT count(DISTINCT a.privilege_type) FROM pg_namespace n, aclexplode(n.nspacl) a
+		WHERE n.nspname = 'public' AND a.grantee = r.oid AND a.privilege_type IN ('CREATE', 'USAGE')) = 2
+	AND (SELECT count(DISTINCT a.privilege_type) FROM pg_database d, aclexplode(d.datacl) a
+		WHERE d.datname = $1 AND a.grantee = r.oid AND a.privilege_type IN ('CREATE', 'CONNECT', 'TEMPORARY')) = 3
+ORDER BY r.rolname` + fmt.Sprintf(" LIMIT %d", filter.limit()+1)
+	rows, err := db.Query(sq, filter.Database, filter.PageToken)
+	if err != nil {
+		return nil, stepErrorf(StepList, "error listing schema privileges in database %q: %w", filter.Database, err)
+	}
+	defer rows.Close()
+
+	items := make([]SchemaPrivilege, 0)
+	for rows.Next() {
+		cur := SchemaPrivilege{Database: filter.Database}
+		if err := rows.Scan(&cur.Role); err != nil {
+			return nil, fmt.Errorf("error reading schema privilege: %w", err)
+		}
+		items = append(items, cur)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing schema privileges: %w", err)
+	}
+	return newPage(items, filter.ListOptions, func(p SchemaPrivilege) string { return p.Role }), nil
+}
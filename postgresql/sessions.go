@@ -0,0 +1,248 @@
+package postgresql
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/go-multierror/multierror"
+	"github.com/lib/pq"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	SignalTerminate = "terminate"
+	SignalCancel    = "cancel"
+)
+
+// sessionStates are the values of pg_stat_activity.state for client sessions
+var sessionStates = []string{"active", "idle", "idle in transaction", "idle in transaction (aborted)", "fastpath function call", "disabled"}
+
+// Session is a backend in pg_stat_activity
+type Session struct {
+	Pid             int    `json:"pid"`
+	Role            string `json:"role"`
+	Database        string `json:"database"`
+	ApplicationName string `json:"applicationName"`
+	ClientAddr      string `json:"clientAddr"`
+	// State is active, idle, idle in transaction, etc.
+	// This is empty if the session belongs to a role whose activity is not visible to pg-db-admin
+	State        string     `json:"state"`
+	BackendStart time.Time  `json:"backendStart"`
+	StateChange  *time.Time `json:"stateChange"`
+	// Query is the current or last query with passwords redacted
+	Query string `json:"query"`
+}
+
+// SessionFilter selects sessions by Role and/or Database
+// Sessions of the role that pg-db-admin connects as, including its own session, are always excluded
+type SessionFilter struct {
+	Role     string `json:"role"`
+	Database string `json:"database"`
+	// State only includes sessions in this state (e.g. idle in transaction)
+	State string `json:"state"`
+	// IdleFor only includes sessions that have not been active for at least this long
+	// Sessions whose state is not visible to the current user are excluded
+	IdleFor time.Duration `json:"idleFor"`
+}
+
+func (f SessionFilter) validate() error {
+	if f.State != "" && !slices.Contains(sessionStates, f.State) {
+		return &ValidationError{Field: "state", Reason: fmt.Sprintf("%q must be one of: %s", f.State, strings.Join(sessionStates, ", "))}
+	}
+	if f.IdleFor < 0 {
+		return &ValidationError{Field: "idleFor", Reason: "must not be negative"}
+	}
+	return nil
+}
+
+func (f SessionFilter) policyRefs() []ObjectRef {
+	return append(roleRefs(f.Role), databaseRef(f.Database))
+}
+
+// SignalReport lists the sessions that were signaled
+type SignalReport struct {
+	// Signal is terminate or cancel
+	Signal   string    `json:"signal"`
+	Sessions []Session `json:"sessions"`
+	// Skipped contains sessions of protected roles, which are never signaled
+	Skipped []Session `json:"skipped"`
+	// Plan contains the statements that would be executed by a dry run
+	Plan *Plan `json:"plan,omitempty"`
+}
+
+type Sessions struct {
+	DbOpener DbOpener
+}
+
+// List reads the sessions that match filter ordered by pid
+// If the role or database in filter does not exist, nil is returned
+func (s *Sessions) List(filter SessionFilter) ([]Session, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	db, err := s.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+	if exists, err := s.targetExists(db, filter); err != nil || !exists {
+		return nil, err
+	}
+	info, err := CalcDbConnectionInfo(db)
+	if err != nil {
+		return nil, stepErrorf(StepAnalyze, "error analyzing database: %w", err)
+	}
+	return listSessions(db, info, filter)
+}
+
+// Signal terminates (pg_terminate_backend) or cancels the current query (pg_cancel_backend) of the sessions that match filter
+// Sessions of roles that are protected by the Policy are skipped
+// If the role or database in filter does not exist, nil is returned
+func (s *Sessions) Signal(filter SessionFilter, signal string) (*SignalReport, error) {
+	fn := map[string]string{SignalTerminate: "pg_terminate_backend", SignalCancel: "pg_cancel_backend"}[signal]
+	if fn == "" {
+		return nil, &ValidationError{Field: "signal", Reason: fmt.Sprintf("%q must be %s or %s", signal, SignalTerminate, SignalCancel)}
+	}
+	// The policy and current user are resolved once, then each session is checked in memory
+	checker, err := NewPolicyChecker(s.DbOpener)
+	if err != nil {
+		return nil, err
+	}
+	if err := checker.Check(filter.policyRefs()...); err != nil {
+		return nil, err
+	}
+	sessions, err := s.List(filter)
+	if err != nil || sessions == nil {
+		return nil, err
+	}
+	db, err := s.DbOpener.OpenDatabase("")
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SignalReport{Signal: signal, Sessions: make([]Session, 0), Skipped: make([]Session, 0)}
+	errs := make([]error, 0)
+	for _, session := range sessions {
+		if err := checker.Check(roleRefs(session.Role)...); err != nil {
+			report.Skipped = append(report.Skipped, session)
+			continue
+		}
+		log.Printf("Signaling %s to session %d of %q on %q\n", signal, session.Pid, session.Role, session.Database)
+		// The row count reports whether the backend was signaled; it may have exited since it was listed
+		res, err := db.Exec(fmt.Sprintf("SELECT 1 WHERE %s(%d)", fn, session.Pid))
+		if err != nil {
+			errs = append(errs, stepErrorf(StepTerminateSessions, "error signaling session %d of %q: %w", session.Pid, session.Role, err))
+			continue
+		}
+		if n, _ := res.RowsAffected(); n > 0 || isDryRun(db) {
+			report.Sessions = append(report.Sessions, session)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, multierror.New(errs)
+	}
+	return report, nil
+}
+
+func (s *Sessions) targetExists(db DB, filter SessionFilter) (bool, error) {
+	var exists bool
+	if filter.Role != "" {
+		if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM pg_roles WHERE rolname = $1)`, filter.Role).Scan(&exists); err != nil || !exists {
+			return false, stepError(StepReadRole, err)
+		}
+	}
+	if filter.Database != "" {
+		if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM pg_database WHERE datname = $1)`, filter.Database).Scan(&exists); err != nil || !exists {
+			return false, stepError(StepReadDatabase, err)
+		}
+	}
+	return true, nil
+}
+
+func listSessions(db DB, info *DbInfo, filter SessionFilter) ([]Session, error) {
+	// Before postgres 9.2, pg_stat_activity has procpid and current_query instead of pid, state, and query
+	pidColumn, stateColumn, stateChangeColumn, queryColumn := "procpid", `CASE current_query WHEN '<IDLE>' THEN 'idle'
+	WHEN '<IDLE> in transaction' THEN 'idle in transaction' WHEN '<insufficient privilege>' THEN NULL ELSE 'active' END`, "query_start", "current_query"
+	if info.SupportedFeatures.IsSupported(FeaturePid) {
+		pidColumn, stateColumn, stateChangeColumn, queryColumn = "pid", "state", "state_change", "query"
+	}
+
+	sq := fmt.Sprintf(`SELECT pid, role, database, application_name, client_addr, state, backend_start, state_change, query
+FROM (SELECT %[1]s AS pid, usename::text AS role, datname::text AS database, COALESCE(application_name, '') AS application_name,
+		COALESCE(host(client_addr), '') AS client_addr, COALESCE(%[2]s, '') AS state, backend_start,
+		%[3]s AS state_change, COALESCE(%[4]s, '') AS query
+	FROM pg_stat_activity
+	WHERE usename IS NOT NULL AND datname IS NOT NULL AND %[1]s <> pg_backend_pid() AND usename <> CURRENT_USER) a
+WHERE true`, pidColumn, stateColumn, stateChangeColumn, queryColumn)
+	args := make([]any, 0)
+	if filter.Role != "" {
+		args = append(args, filter.Role)
+		sq += fmt.Sprintf(" AND role = $%d", len(args))
+	}
+	if filter.Database != "" {
+		args = append(args, filter.Database)
+		sq += fmt.Sprintf(" AND database = $%d", len(args))
+	}
+	if filter.State != "" {
+		args = append(args, filter.State)
+		sq += fmt.Sprintf(" AND state = $%d", len(args))
+	}
+	if filter.IdleFor > 0 {
+		args = append(args, filter.IdleFor.Seconds())
+		// An empty state means that the session is not visible to the current user, so it was never observed as idle
+		sq += fmt.Sprintf(" AND state <> '' AND state <> 'active' AND state_change <= now() - $%d * interval '1 second'", len(args))
+	}
+	sq += " ORDER BY pid"
+
+	rows, err := db.Query(sq, args...)
+	if err != nil {
+		return nil, stepErrorf(StepList, "error listing sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		var cur Session
+		var stateChange sql.NullTime
+		if err := rows.Scan(&cur.Pid, &cur.Role, &cur.Database, &cur.ApplicationName, &cur.ClientAddr, &cur.State,
+			&cur.BackendStart, &stateChange, &cur.Query); err != nil {
+			return nil, stepErrorf(StepList, "error reading session: %w", err)
+		}
+		if stateChange.Valid {
+			cur.StateChange = &stateChange.Time
+		}
+		cur.Query = RedactSql(cur.Query)
+		sessions = append(sessions, cur)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stepErrorf(StepList, "error listing sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// terminateSessions terminates every session of role except the current session
+// It returns the number of sessions that were terminated
+func terminateSessions(db DB, role string) (int, error) {
+	info, err := CalcDbConnectionInfo(db)
+	if err != nil {
+		return 0, stepErrorf(StepAnalyze, "error analyzing database: %w", err)
+	}
+	pidColumn := "procpid"
+	if info.SupportedFeatures.IsSupported(FeaturePid) {
+		pidColumn = "pid"
+	}
+
+	sq := fmt.Sprintf(`SELECT count(pg_terminate_backend(%[1]s)) FROM pg_stat_activity WHERE usename = %[2]s AND %[1]s <> pg_backend_pid()`,
+		pidColumn, pq.QuoteLiteral(role))
+	// Terminating sessions is a side effect of a query, so a dry run must record it instead of executing it
+	if isDryRun(db) {
+		_, err := db.Exec(sq)
+		return 0, err
+	}
+	var count int
+	if err := db.QueryRow(sq).Scan(&count); err != nil {
+		return 0, stepErrorf(StepTerminateSessions, "error terminating sessions of %q: %w", role, err)
+	}
+	return count, nil
+}
@@ -1,7 +1,10 @@
 package postgresql
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"log"
 	"sync"
 )
 
@@ -11,28 +14,95 @@ type Store struct {
 	RoleMembers      *RoleMembers
 	DefaultGrants    *DefaultGrants
 	SchemaPrivileges *SchemaPrivileges
+	Schemas          *Schemas
+	DatabaseAccess   *DatabaseAccesses
+	JitAccess        *JitAccesses
+	Credentials      *CredentialLeases
+	Sessions         *Sessions
 
-	connUrl       string
-	connsByDbName map[string]*sql.DB
+	// Policy protects reserved roles and databases (see DefaultPolicy)
+	// If nil, no objects are protected
+	Policy *Policy
+	// PasswordPolicy is enforced on role passwords (see DefaultPasswordPolicy and PasswordPolicyFromEnv)
+	// If nil, passwords are not validated; this is the default
+	PasswordPolicy *PasswordPolicy
+	// AuthToken generates the password of every new connection (e.g. RDS IAM auth)
+	// If nil, the password of the connection url is used
+	AuthToken AuthTokenProvider
+
+	connUrl         string
+	connUrlResolver ConnUrlResolver
+	connUrlLock     sync.Mutex
+	connsByDbName   map[string]*sql.DB
 	sync.Mutex
+
+	// parent and plan are configured for a dry-run Store (see DryRun)
+	// A dry-run Store borrows connections from parent and records statements to plan
+	parent *Store
+	plan   *Plan
+	// execute is true for a recording Store (see Recording)
+	execute bool
 }
 
 type DbOpener interface {
-	OpenDatabase(dbName string) (*sql.DB, error)
+	OpenDatabase(dbName string) (DB, error)
+}
+
+// DB is the subset of *sql.DB that is used to administer postgres
+// This allows statements to be recorded instead of executed (see Store.DryRun)
+type DB interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+	Begin() (*sql.Tx, error)
 }
 
+// ConnUrlResolver retrieves the connection url for a Store (e.g. from a secret store)
+type ConnUrlResolver func(ctx context.Context) (string, error)
+
 func NewStore(connUrl string) *Store {
-	store := &Store{connUrl: connUrl, connsByDbName: map[string]*sql.DB{}}
+	store := &Store{connUrl: connUrl, connsByDbName: map[string]*sql.DB{}, Policy: DefaultPolicy()}
 	store.Databases = &Databases{DbOpener: store}
 	store.Roles = &Roles{DbOpener: store}
 	store.RoleMembers = &RoleMembers{DbOpener: store}
 	store.DefaultGrants = &DefaultGrants{DbOpener: store}
 	store.SchemaPrivileges = &SchemaPrivileges{DbOpener: store}
+	store.Schemas = &Schemas{DbOpener: store}
+	store.DatabaseAccess = &DatabaseAccesses{
+		DbOpener:         store,
+		Databases:        store.Databases,
+		RoleMembers:      store.RoleMembers,
+		DefaultGrants:    store.DefaultGrants,
+		SchemaPrivileges: store.SchemaPrivileges,
+	}
+	store.JitAccess = &JitAccesses{DbOpener: store}
+	store.Credentials = &CredentialLeases{
+		DbOpener:       store,
+		DatabaseAccess: store.DatabaseAccess,
+		RoleMembers:    store.RoleMembers,
+		ConnUrl:        store.ConnectionUrl,
+	}
+	store.Sessions = &Sessions{DbOpener: store}
+	return store
+}
+
+// NewLazyStore creates a Store that does not resolve its connection url until the first connection is made
+// The connection url is resolved again if postgres rejects the credentials or if the Store is invalidated
+func NewLazyStore(resolver ConnUrlResolver) *Store {
+	store := NewStore("")
+	store.connUrlResolver = resolver
 	return store
 }
 
 func (s *Store) ConnectionUrl() string {
-	return s.connUrl
+	if s.parent != nil {
+		return s.parent.ConnectionUrl()
+	}
+	connUrl, err := s.resolveConnUrl(context.Background(), false)
+	if err != nil {
+		log.Println(err.Error())
+	}
+	return connUrl
 }
 
 func (s *Store) Close() {
@@ -45,7 +115,27 @@ func (s *Store) Close() {
 	}
 }
 
-func (s *Store) OpenDatabase(dbName string) (*sql.DB, error) {
+// Invalidate closes all connections and discards the resolved connection url
+// The next use of the Store will resolve the connection url again
+func (s *Store) Invalidate() {
+	s.Close()
+	if s.connUrlResolver == nil {
+		return
+	}
+	s.connUrlLock.Lock()
+	defer s.connUrlLock.Unlock()
+	s.connUrl = ""
+}
+
+func (s *Store) OpenDatabase(dbName string) (DB, error) {
+	if s.parent != nil {
+		db, err := s.parent.OpenDatabase(dbName)
+		if err != nil {
+			return nil, err
+		}
+		return &planDB{DB: db, database: dbName, plan: s.plan, execute: s.execute}, nil
+	}
+
 	s.Lock()
 	defer s.Unlock()
 
@@ -54,10 +144,31 @@ func (s *Store) OpenDatabase(dbName string) (*sql.DB, error) {
 		return existing, nil
 	}
 
-	db, err := OpenDatabase(s.connUrl, dbName)
-	if err != nil {
-		return nil, err
+	db := sql.OpenDB(storeConnector{store: s, dbName: dbName})
+	if err := pingDatabase(db); err != nil {
+		db.Close()
+		return nil, stepError(StepConnect, err)
 	}
 	s.connsByDbName[dbName] = db
 	return db, nil
 }
+
+// resolveConnUrl returns the Store's connection url, resolving it if necessary
+// If refresh is true, the connection url is resolved even if one has already been resolved
+func (s *Store) resolveConnUrl(ctx context.Context, refresh bool) (string, error) {
+	s.connUrlLock.Lock()
+	defer s.connUrlLock.Unlock()
+
+	if s.connUrlResolver == nil || (s.connUrl != "" && !refresh) {
+		return s.connUrl, nil
+	}
+	connUrl, err := s.connUrlResolver(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error resolving connection url: %w", err)
+	}
+	if connUrl == "" {
+		return "", fmt.Errorf("connection url is empty")
+	}
+	s.connUrl = connUrl
+	return s.connUrl, nil
+}
@@ -3,6 +3,7 @@ package postgresql
 import (
 	"database/sql"
 	"fmt"
+	"github.com/go-multierror/multierror"
 	"github.com/lib/pq"
 	"log"
 )
@@ -12,9 +13,9 @@ import (
 // For instance, when using AWS RDS, user is not given superuser
 // It returns false if the grant is not needed because the user is already
 // a member of this role.
-func GrantRoleMembership(db *sql.DB, role string, currentUser string) (Revoker, error) {
+func GrantRoleMembership(db DB, role string, currentUser string) (Revoker, error) {
 	if currentUser == role {
-		return nil, nil
+		return NoopRevoker{}, nil
 	}
 
 	isMember, err := isMemberOfRole(db, currentUser, role)
@@ -22,19 +23,36 @@ func GrantRoleMembership(db *sql.DB, role string, currentUser string) (Revoker,
 		return nil, err
 	}
 	if isMember {
-		return nil, nil
+		return NoopRevoker{}, nil
+	}
+
+	// e.g. <admin-role> -> <app-role> -> <admin-role> if the app role was granted the admin role
+	if err := checkMembershipCycle(db, currentUser, role); err != nil {
+		return nil, err
 	}
 
 	log.Printf("Granting %q temporary access to role %q\n", currentUser, role)
 
+	sql := fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(role), pq.QuoteIdentifier(currentUser))
+	// A dry run only plans the grant, so there is nothing to lock
+	if isDryRun(db) {
+		if _, err := db.Exec(sql); err != nil {
+			return nil, err
+		}
+		return &TempGrant{Role: role, CurrentUser: currentUser}, nil
+	}
+
 	// Take a lock on db currentUser to avoid multiple database creation at the same time
 	// It can fail if they grant the same owner to current at the same time as it's not done in transaction.
 	lockTxn, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting lock transaction: %w", err)
+	}
 	if err := pgLockRole(lockTxn, currentUser); err != nil {
+		lockTxn.Rollback()
 		return nil, err
 	}
 
-	sql := fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(role), pq.QuoteIdentifier(currentUser))
 	if _, err := db.Exec(sql); err != nil {
 		lockTxn.Rollback()
 		return nil, fmt.Errorf("error granting role %s to %s: %w", role, currentUser, err)
@@ -62,17 +80,18 @@ func pgLockRole(txn *sql.Tx, role string) error {
 }
 
 type Revoker interface {
-	Revoke(db *sql.DB) error
+	Revoke(db DB) error
 }
 
 type NoopRevoker struct {
 }
 
-func (t NoopRevoker) Revoke(db *sql.DB) error {
+func (t NoopRevoker) Revoke(db DB) error {
 	return nil
 }
 
 type TempGrant struct {
+	// Tx holds the advisory lock on CurrentUser until the grant is revoked; this is nil during a dry run
 	Tx          *sql.Tx
 	Role        string
 	CurrentUser string
@@ -80,19 +99,24 @@ type TempGrant struct {
 
 // Revoke revokes the role *role* from the user *member*.
 // It returns false if the revoke is not needed because the user is not a member of this role.
-func (t TempGrant) Revoke(db *sql.DB) error {
-	defer t.Tx.Rollback()
+func (t TempGrant) Revoke(db DB) error {
+	if t.Tx != nil {
+		defer t.Tx.Rollback()
+	}
 
 	if t.CurrentUser == t.Role {
 		return nil
 	}
 
-	isMember, err := isMemberOfRole(db, t.CurrentUser, t.Role)
-	if err != nil {
-		return err
-	}
-	if !isMember {
-		return nil
+	// During a dry run, the temporary membership was never granted, so we always plan the revoke
+	if !isDryRun(db) {
+		isMember, err := isMemberOfRole(db, t.CurrentUser, t.Role)
+		if err != nil {
+			return err
+		}
+		if !isMember {
+			return nil
+		}
 	}
 
 	log.Printf("Revoking %q temporary access to role %q\n", t.CurrentUser, t.Role)
@@ -104,7 +128,7 @@ func (t TempGrant) Revoke(db *sql.DB) error {
 	return nil
 }
 
-func isMemberOfRole(db *sql.DB, member, role string) (bool, error) {
+func isMemberOfRole(db DB, member, role string) (bool, error) {
 	var noval int
 	sq := `SELECT 1 FROM pg_auth_members WHERE pg_get_userbyid(roleid) = $1 AND pg_get_userbyid(member) = $2`
 	err := db.QueryRow(sq, role, member).Scan(&noval)
@@ -118,3 +142,31 @@ func isMemberOfRole(db *sql.DB, member, role string) (bool, error) {
 
 	return true, nil
 }
+
+// execWithMembership executes sq after granting the current user temporary membership in role
+// A non-superuser must be a member of a role to assign ownership to it
+func execWithMembership(db DB, role, step, sq string) error {
+	info, err := CalcDbConnectionInfo(db)
+	if err != nil {
+		return stepErrorf(StepAnalyze, "error analyzing database: %w", err)
+	}
+
+	var revoker Revoker = NoopRevoker{}
+	if role != "" && !info.IsSuperuser {
+		if revoker, err = GrantRoleMembership(db, role, info.CurrentUser); err != nil {
+			return stepErrorf(StepGrantTemporaryMembership, "error granting temporary membership: %w", err)
+		}
+	}
+
+	errs := make([]error, 0)
+	if _, err := db.Exec(sq); err != nil {
+		errs = append(errs, stepErrorf(step, "error executing %q: %w", sq, err))
+	}
+	if err := revoker.Revoke(db); err != nil {
+		errs = append(errs, stepErrorf(StepRevokeTemporaryMembership, "error revoking temporary membership: %w", err))
+	}
+	if len(errs) > 0 {
+		return multierror.New(errs)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package postgresql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUpdate_MismatchedBody(t *testing.T) {
+	store := NewStore("")
+	store.Policy = &Policy{ProtectedRoles: []string{"admin"}, ProtectedDatabases: []string{"billing"}}
+
+	t.Run("schema privileges", func(t *testing.T) {
+		_, err := store.SchemaPrivileges.Update(SchemaPrivilegeKey{Role: "app", Database: "app"}, SchemaPrivilege{Role: "app", Database: "billing"})
+		var policyErr *PolicyError
+		if assert.ErrorAs(t, err, &policyErr) {
+			assert.Equal(t, "billing", policyErr.Ref.Name)
+		}
+
+		_, err = store.SchemaPrivileges.Update(SchemaPrivilegeKey{Role: "app\n", Database: "app"}, SchemaPrivilege{Role: "app", Database: "app"})
+		var validationErr *ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+	})
+
+	t.Run("default grants", func(t *testing.T) {
+		_, err := store.DefaultGrants.Update(DefaultGrantKey{Role: "app", Target: "app", Database: "app"}, DefaultGrant{Role: "app", Target: "admin", Database: "app"})
+		var policyErr *PolicyError
+		if assert.ErrorAs(t, err, &policyErr) {
+			assert.Equal(t, "admin", policyErr.Ref.Name)
+		}
+
+		_, err = store.DefaultGrants.Update(DefaultGrantKey{Role: "app", Target: "", Database: "app"}, DefaultGrant{Role: "app", Target: "app", Database: "app"})
+		var validationErr *ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+	})
+}
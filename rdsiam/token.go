@@ -0,0 +1,91 @@
+package rdsiam
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TokenLifetime is how long RDS accepts an auth token to open a new connection
+	// A connection stays open after the token that authenticated it expires
+	TokenLifetime = 15 * time.Minute
+
+	signingService = "rds-db"
+	// emptyPayloadHash is the sha256 of an empty body, which is signed for every auth token
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// TokenProvider builds RDS IAM auth tokens that are used as the password of a postgres connection
+// A token is a SigV4 presigned `connect` request computed locally from the credentials of the execution role
+// The AWS config is loaded on first use and reused for the life of the process
+type TokenProvider struct {
+	// Region and Credentials default to the AWS config of the environment
+	Region      string
+	Credentials aws.CredentialsProvider
+
+	signer *v4.Signer
+	sync.Mutex
+}
+
+// AuthToken builds a token that authenticates user to the RDS instance at host (host:port)
+func (p *TokenProvider) AuthToken(ctx context.Context, host, user string) (string, error) {
+	if err := p.init(ctx); err != nil {
+		return "", err
+	}
+	creds, err := p.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving aws credentials: %w", err)
+	}
+	return p.buildToken(ctx, creds, host, user, time.Now())
+}
+
+func (p *TokenProvider) init(ctx context.Context) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.signer != nil {
+		return nil
+	}
+	if p.Region == "" || p.Credentials == nil {
+		awsConfig, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return fmt.Errorf("error accessing aws: %w", err)
+		}
+		if p.Region == "" {
+			p.Region = awsConfig.Region
+		}
+		if p.Credentials == nil {
+			p.Credentials = awsConfig.Credentials
+		}
+	}
+	if p.Region == "" {
+		return fmt.Errorf("cannot build rds auth token: aws region is not configured")
+	}
+	p.signer = v4.NewSigner()
+	return nil
+}
+
+func (p *TokenProvider) buildToken(ctx context.Context, creds aws.Credentials, host, user string, signingTime time.Time) (string, error) {
+	query := url.Values{}
+	query.Set("Action", "connect")
+	query.Set("DBUser", user)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(TokenLifetime/time.Second)))
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s/?%s", host, query.Encode()), nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid rds endpoint %q: %w", host, err)
+	}
+	signed, _, err := p.signer.PresignHTTP(ctx, creds, req, emptyPayloadHash, signingService, p.Region, signingTime)
+	if err != nil {
+		return "", fmt.Errorf("error signing rds auth token: %w", err)
+	}
+	return strings.TrimPrefix(signed, "https://"), nil
+}
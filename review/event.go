@@ -0,0 +1,56 @@
+package review
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/nullstone-modules/pg-db-admin/apierror"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"log"
+	"strings"
+)
+
+const (
+	FormatJson = "json"
+	FormatCsv  = "csv"
+)
+
+// Event produces an access review of every login role in the cluster
+// e.g. `{"accessReview": true, "format": "csv"}` sent by a scheduled EventBridge rule
+type Event struct {
+	AccessReview bool `json:"accessReview"`
+	// Format is json (default) or csv
+	Format string `json:"format"`
+}
+
+func IsEvent(rawEvent json.RawMessage) (bool, Event) {
+	var event Event
+	if err := json.Unmarshal(rawEvent, &event); err != nil {
+		return false, event
+	}
+	return event.AccessReview, event
+}
+
+// Handle returns the postgresql.AccessReview
+// If Format is csv, a string containing the CSV document is returned instead
+func Handle(ctx context.Context, event Event, store *postgresql.Store) (any, error) {
+	if event.Format != "" && event.Format != FormatJson && event.Format != FormatCsv {
+		return nil, apierror.InvalidPayload(fmt.Errorf("unsupported format %q (expected json or csv)", event.Format))
+	}
+	review, err := store.Roles.AccessReview()
+	if err != nil {
+		return nil, apierror.New(err)
+	}
+	log.Printf("[AccessReview] Reviewed %d login roles\n", len(review.Roles))
+	for _, warning := range review.Warnings {
+		log.Printf("[AccessReview] Warning: %s\n", warning)
+	}
+	if event.Format != FormatCsv {
+		return review, nil
+	}
+	var sb strings.Builder
+	if err := review.WriteCsv(&sb); err != nil {
+		return nil, err
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,130 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"sync"
+)
+
+var _ SecretStore = &AwsSecretsManager{}
+
+// AwsSecretsManager is a SecretStore backed by AWS Secrets Manager
+// The AWS client is created on first use and reused for the life of the process
+type AwsSecretsManager struct {
+	client *secretsmanager.Client
+	sync.Mutex
+}
+
+func (s *AwsSecretsManager) Client(ctx context.Context) (*secretsmanager.Client, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.client != nil {
+		return s.client, nil
+	}
+	awsConfig, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error accessing aws: %w", err)
+	}
+	s.client = secretsmanager.NewFromConfig(awsConfig)
+	return s.client, nil
+}
+
+func (s *AwsSecretsManager) Get(ctx context.Context, secretId string) (string, error) {
+	return s.getValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretId)})
+}
+
+func (s *AwsSecretsManager) GetVersion(ctx context.Context, secretId, versionId string) (string, error) {
+	return s.getValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId:  aws.String(secretId),
+		VersionId: aws.String(versionId),
+	})
+}
+
+func (s *AwsSecretsManager) GetLabel(ctx context.Context, secretId, label string) (string, error) {
+	return s.getValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(secretId),
+		VersionStage: aws.String(label),
+	})
+}
+
+func (s *AwsSecretsManager) getValue(ctx context.Context, input *secretsmanager.GetSecretValueInput) (string, error) {
+	sm, err := s.Client(ctx)
+	if err != nil {
+		return "", err
+	}
+	out, err := sm.GetSecretValue(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving secret (%s): %w", aws.ToString(input.SecretId), err)
+	}
+	if out.SecretString == nil {
+		return "", nil
+	}
+	return *out.SecretString, nil
+}
+
+// Put creates a secret version containing the input value
+// The new VersionId is returned
+func (s *AwsSecretsManager) Put(ctx context.Context, secretId, value string) (string, error) {
+	sm, err := s.Client(ctx)
+	if err != nil {
+		return "", err
+	}
+	input := &secretsmanager.UpdateSecretInput{
+		SecretId:     aws.String(secretId),
+		SecretString: aws.String(value),
+	}
+	if out, err := sm.UpdateSecret(ctx, input); err != nil {
+		return "", fmt.Errorf("unable to update secret (%s) value: %w", secretId, err)
+	} else if out.VersionId != nil {
+		return *out.VersionId, nil
+	}
+	return "", nil
+}
+
+func (s *AwsSecretsManager) LatestVersionId(ctx context.Context, secretId string) (string, error) {
+	sm, err := s.Client(ctx)
+	if err != nil {
+		return "", err
+	}
+	out, err := sm.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretId)})
+	if err != nil {
+		return "", fmt.Errorf("error retrieving secret version id (%s): %w", secretId, err)
+	}
+	if out.VersionId == nil {
+		return "", nil
+	}
+	return *out.VersionId, nil
+}
+
+// SetLabel moves the version stage label to versionId
+// Secrets Manager requires the version that currently holds the stage to be specified when moving it
+func (s *AwsSecretsManager) SetLabel(ctx context.Context, secretId, versionId, label string) error {
+	sm, err := s.Client(ctx)
+	if err != nil {
+		return err
+	}
+	desc, err := sm.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(secretId)})
+	if err != nil {
+		return fmt.Errorf("error describing secret (%s): %w", secretId, err)
+	}
+	input := &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:        aws.String(secretId),
+		VersionStage:    aws.String(label),
+		MoveToVersionId: aws.String(versionId),
+	}
+	for id, stages := range desc.VersionIdsToStages {
+		for _, stage := range stages {
+			if stage == label && id != versionId {
+				input.RemoveFromVersionId = aws.String(id)
+			}
+		}
+	}
+	if _, err := sm.UpdateSecretVersionStage(ctx, input); err != nil {
+		return fmt.Errorf("unable to label secret (%s) version %s with %q: %w", secretId, versionId, label, err)
+	}
+	return nil
+}
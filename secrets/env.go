@@ -0,0 +1,59 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+var _ SecretStore = &EnvStore{}
+
+// EnvStore is a SecretStore that reads secrets from environment variables
+// The secret id is the name of the env var (e.g. `DB_ADMIN_CONN_URL`)
+// Put only updates the current process, which makes this useful for local development
+// This store does not support versions or labels beyond the current value
+type EnvStore struct {
+	versions map[string]int
+	sync.Mutex
+}
+
+func (s *EnvStore) Get(ctx context.Context, secretId string) (string, error) {
+	return os.Getenv(secretId), nil
+}
+
+func (s *EnvStore) GetVersion(ctx context.Context, secretId, versionId string) (string, error) {
+	if latest, _ := s.LatestVersionId(ctx, secretId); versionId == latest {
+		return s.Get(ctx, secretId)
+	}
+	return "", fmt.Errorf("env secret store does not retain previous versions")
+}
+
+func (s *EnvStore) GetLabel(ctx context.Context, secretId, label string) (string, error) {
+	return "", fmt.Errorf("env secret store does not support labels")
+}
+
+func (s *EnvStore) Put(ctx context.Context, secretId, value string) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := os.Setenv(secretId, value); err != nil {
+		return "", fmt.Errorf("unable to update secret (%s) value: %w", secretId, err)
+	}
+	if s.versions == nil {
+		s.versions = map[string]int{}
+	}
+	s.versions[secretId]++
+	return strconv.Itoa(s.versions[secretId]), nil
+}
+
+func (s *EnvStore) LatestVersionId(ctx context.Context, secretId string) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+	return strconv.Itoa(s.versions[secretId]), nil
+}
+
+func (s *EnvStore) SetLabel(ctx context.Context, secretId, versionId, label string) error {
+	return fmt.Errorf("env secret store does not support labels")
+}
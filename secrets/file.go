@@ -0,0 +1,164 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const (
+	// fileStorePathEnvVar is the path to the json file used by the file secret store
+	fileStorePathEnvVar = "SECRET_STORE_FILE"
+)
+
+var _ SecretStore = &FileStore{}
+
+// FileStore is a SecretStore that persists secrets to a local json file
+// This is intended for local development and tests
+// Versions are numbered sequentially starting at 1
+type FileStore struct {
+	Path string
+	sync.Mutex
+}
+
+type fileSecret struct {
+	Versions []string          `json:"versions"`
+	Labels   map[string]string `json:"labels"`
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file secret store requires %s", fileStorePathEnvVar)
+	}
+	return &FileStore{Path: path}, nil
+}
+
+func (s *FileStore) Get(ctx context.Context, secretId string) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	secrets, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	secret, ok := secrets[secretId]
+	if !ok || len(secret.Versions) == 0 {
+		return "", nil
+	}
+	return secret.Versions[len(secret.Versions)-1], nil
+}
+
+func (s *FileStore) GetVersion(ctx context.Context, secretId, versionId string) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	secrets, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	return secrets[secretId].version(secretId, versionId)
+}
+
+func (s *FileStore) GetLabel(ctx context.Context, secretId, label string) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	secrets, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	secret := secrets[secretId]
+	versionId, ok := secret.Labels[label]
+	if !ok {
+		return "", fmt.Errorf("secret (%s) does not have a version labeled %q", secretId, label)
+	}
+	return secret.version(secretId, versionId)
+}
+
+func (s *FileStore) Put(ctx context.Context, secretId, value string) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	secrets, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	secret := secrets[secretId]
+	secret.Versions = append(secret.Versions, value)
+	secrets[secretId] = secret
+	if err := s.save(secrets); err != nil {
+		return "", err
+	}
+	return strconv.Itoa(len(secret.Versions)), nil
+}
+
+func (s *FileStore) LatestVersionId(ctx context.Context, secretId string) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	secrets, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	if count := len(secrets[secretId].Versions); count > 0 {
+		return strconv.Itoa(count), nil
+	}
+	return "", nil
+}
+
+func (s *FileStore) SetLabel(ctx context.Context, secretId, versionId, label string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	secret := secrets[secretId]
+	if _, err := secret.version(secretId, versionId); err != nil {
+		return err
+	}
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+	secret.Labels[label] = versionId
+	secrets[secretId] = secret
+	return s.save(secrets)
+}
+
+func (s *FileStore) load() (map[string]fileSecret, error) {
+	secrets := map[string]fileSecret{}
+	raw, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return secrets, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading secrets file %q: %w", s.Path, err)
+	}
+	if err := json.Unmarshal(raw, &secrets); err != nil {
+		return nil, fmt.Errorf("invalid secrets file %q: %w", s.Path, err)
+	}
+	return secrets, nil
+}
+
+func (s *FileStore) save(secrets map[string]fileSecret) error {
+	raw, err := json.MarshalIndent(secrets, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.Path, raw, 0600); err != nil {
+		return fmt.Errorf("error writing secrets file %q: %w", s.Path, err)
+	}
+	return nil
+}
+
+func (f fileSecret) version(secretId, versionId string) (string, error) {
+	i, err := strconv.Atoi(versionId)
+	if err != nil || i < 1 || i > len(f.Versions) {
+		return "", fmt.Errorf("secret (%s) does not have version %q", secretId, versionId)
+	}
+	return f.Versions[i-1], nil
+}
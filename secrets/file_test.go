@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	s, err := NewFileStore(path)
+	require.NoError(t, err)
+
+	value, err := s.Get(ctx, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, "", value, "missing file has no secrets")
+	latest, err := s.LatestVersionId(ctx, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, "", latest)
+
+	v1, err := s.Put(ctx, "admin", "first")
+	require.NoError(t, err)
+	assert.Equal(t, "1", v1)
+	v2, err := s.Put(ctx, "admin", "second")
+	require.NoError(t, err)
+	assert.Equal(t, "2", v2)
+	require.NoError(t, s.SetLabel(ctx, "admin", v1, "previous"))
+
+	// A new store reads what was persisted by the first store
+	reopened, err := NewFileStore(path)
+	require.NoError(t, err)
+	value, err = reopened.Get(ctx, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, "second", value)
+	value, err = reopened.GetVersion(ctx, "admin", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "first", value)
+	value, err = reopened.GetLabel(ctx, "admin", "previous")
+	require.NoError(t, err)
+	assert.Equal(t, "first", value)
+	latest, err = reopened.LatestVersionId(ctx, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, "2", latest)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestFileStore_Errors(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := NewFileStore("")
+	assert.ErrorContains(t, err, "requires SECRET_STORE_FILE")
+
+	s, err := NewFileStore(filepath.Join(t.TempDir(), "secrets.json"))
+	require.NoError(t, err)
+	_, err = s.Put(ctx, "admin", "first")
+	require.NoError(t, err)
+	for _, versionId := range []string{"0", "2", "latest"} {
+		_, err = s.GetVersion(ctx, "admin", versionId)
+		assert.ErrorContains(t, err, "does not have version", versionId)
+	}
+	assert.ErrorContains(t, s.SetLabel(ctx, "admin", "5", "current"), `does not have version "5"`)
+	_, err = s.GetLabel(ctx, "admin", "current")
+	assert.ErrorContains(t, err, `does not have a version labeled "current"`)
+
+	invalidPath := filepath.Join(t.TempDir(), "invalid.json")
+	require.NoError(t, os.WriteFile(invalidPath, []byte("{"), 0600))
+	invalid, err := NewFileStore(invalidPath)
+	require.NoError(t, err)
+	_, err = invalid.Get(ctx, "admin")
+	assert.ErrorContains(t, err, "invalid secrets file")
+}
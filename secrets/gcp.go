@@ -0,0 +1,211 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// gcpProjectEnvVar is the project used to resolve short secret ids (e.g. `my-secret`)
+	gcpProjectEnvVar = "GCP_PROJECT"
+	// gcpAccessTokenEnvVar allows a local developer to supply an access token (e.g. `gcloud auth print-access-token`)
+	// When empty, an access token is retrieved from the metadata server
+	gcpAccessTokenEnvVar = "GOOGLE_OAUTH_ACCESS_TOKEN"
+
+	gcpSecretManagerUrl = "https://secretmanager.googleapis.com/v1"
+	gcpMetadataTokenUrl = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+var _ SecretStore = &GcpSecretManager{}
+
+// GcpSecretManager is a SecretStore backed by GCP Secret Manager
+// This uses the Secret Manager REST API to avoid pulling the grpc client into the cloud function package
+// Labels are implemented using secret version aliases
+type GcpSecretManager struct {
+	Project    string
+	HttpClient *http.Client
+
+	token       string
+	tokenExpiry time.Time
+	sync.Mutex
+}
+
+func NewGcpSecretManager(project string) *GcpSecretManager {
+	return &GcpSecretManager{
+		Project:    project,
+		HttpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *GcpSecretManager) Get(ctx context.Context, secretId string) (string, error) {
+	return s.GetVersion(ctx, secretId, "latest")
+}
+
+func (s *GcpSecretManager) GetVersion(ctx context.Context, secretId, versionId string) (string, error) {
+	var out struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	endpoint := fmt.Sprintf("%s/%s/versions/%s:access", gcpSecretManagerUrl, s.secretName(secretId), versionId)
+	if err := s.do(ctx, http.MethodGet, endpoint, nil, &out); err != nil {
+		return "", fmt.Errorf("error retrieving secret (%s): %w", secretId, err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(out.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("error decoding secret (%s): %w", secretId, err)
+	}
+	return string(raw), nil
+}
+
+// GetLabel retrieves the version that is referenced by the version alias named label
+// Secret Manager accepts an alias anywhere a version number is accepted
+func (s *GcpSecretManager) GetLabel(ctx context.Context, secretId, label string) (string, error) {
+	return s.GetVersion(ctx, secretId, label)
+}
+
+func (s *GcpSecretManager) Put(ctx context.Context, secretId, value string) (string, error) {
+	input := map[string]any{
+		"payload": map[string]any{
+			"data": base64.StdEncoding.EncodeToString([]byte(value)),
+		},
+	}
+	var out struct {
+		Name string `json:"name"`
+	}
+	endpoint := fmt.Sprintf("%s/%s:addVersion", gcpSecretManagerUrl, s.secretName(secretId))
+	if err := s.do(ctx, http.MethodPost, endpoint, input, &out); err != nil {
+		return "", fmt.Errorf("unable to update secret (%s) value: %w", secretId, err)
+	}
+	return path.Base(out.Name), nil
+}
+
+func (s *GcpSecretManager) LatestVersionId(ctx context.Context, secretId string) (string, error) {
+	var out struct {
+		Name string `json:"name"`
+	}
+	endpoint := fmt.Sprintf("%s/%s/versions/latest", gcpSecretManagerUrl, s.secretName(secretId))
+	if err := s.do(ctx, http.MethodGet, endpoint, nil, &out); err != nil {
+		return "", fmt.Errorf("error retrieving secret version id (%s): %w", secretId, err)
+	}
+	return path.Base(out.Name), nil
+}
+
+func (s *GcpSecretManager) SetLabel(ctx context.Context, secretId, versionId, label string) error {
+	version, err := strconv.ParseInt(versionId, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid secret version %q: %w", versionId, err)
+	}
+
+	var secret struct {
+		VersionAliases map[string]string `json:"versionAliases"`
+	}
+	endpoint := fmt.Sprintf("%s/%s", gcpSecretManagerUrl, s.secretName(secretId))
+	if err := s.do(ctx, http.MethodGet, endpoint, nil, &secret); err != nil {
+		return fmt.Errorf("error retrieving secret (%s): %w", secretId, err)
+	}
+	aliases := map[string]int64{}
+	for k, v := range secret.VersionAliases {
+		aliases[k], _ = strconv.ParseInt(v, 10, 64)
+	}
+	aliases[label] = version
+
+	input := map[string]any{"versionAliases": aliases}
+	if err := s.do(ctx, http.MethodPatch, endpoint+"?updateMask=versionAliases", input, nil); err != nil {
+		return fmt.Errorf("unable to label secret (%s) version %s with %q: %w", secretId, versionId, label, err)
+	}
+	return nil
+}
+
+// secretName converts secretId into a fully-qualified secret resource name
+// secretId may already be fully-qualified (projects/<project>/secrets/<name>)
+func (s *GcpSecretManager) secretName(secretId string) string {
+	if strings.HasPrefix(secretId, "projects/") {
+		return secretId
+	}
+	return fmt.Sprintf("projects/%s/secrets/%s", s.Project, secretId)
+}
+
+func (s *GcpSecretManager) do(ctx context.Context, method, endpoint string, input any, output any) error {
+	token, err := s.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if input != nil {
+		raw, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	raw, _ := io.ReadAll(res.Body)
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("secret manager returned %d: %s", res.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	if output == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, output)
+}
+
+func (s *GcpSecretManager) accessToken(ctx context.Context) (string, error) {
+	if token := os.Getenv(gcpAccessTokenEnvVar); token != "" {
+		return token, nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	// Refresh a minute early to avoid using a token that expires in-flight
+	if s.token != "" && time.Now().Add(time.Minute).Before(s.tokenExpiry) {
+		return s.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataTokenUrl, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	res, err := s.HttpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving gcp access token: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error retrieving gcp access token: metadata server returned %d", res.StatusCode)
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("error decoding gcp access token: %w", err)
+	}
+	s.token = out.AccessToken
+	s.tokenExpiry = time.Now().Add(time.Duration(out.ExpiresIn) * time.Second)
+	return s.token, nil
+}
@@ -0,0 +1,183 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func newTestGcpSecretManager(server *fakeServer) *GcpSecretManager {
+	s := NewGcpSecretManager("acme")
+	s.HttpClient = server.Client()
+	return s
+}
+
+func TestGcpSecretManager_Get(t *testing.T) {
+	t.Setenv(gcpAccessTokenEnvVar, "local-token")
+	server := newFakeServer(t, fakeResponse{Status: http.StatusOK, Body: map[string]any{
+		"payload": map[string]any{"data": base64.StdEncoding.EncodeToString([]byte("postgres://admin"))},
+	}})
+
+	value, err := newTestGcpSecretManager(server).Get(context.Background(), "admin-conn-url")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://admin", value)
+
+	requests := server.Requests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, http.MethodGet, requests[0].Method)
+	assert.Equal(t, "https://secretmanager.googleapis.com/v1/projects/acme/secrets/admin-conn-url/versions/latest:access", requests[0].Url.String())
+	assert.Equal(t, "Bearer local-token", requests[0].Header.Get("Authorization"))
+}
+
+func TestGcpSecretManager_GetVersion(t *testing.T) {
+	t.Setenv(gcpAccessTokenEnvVar, "local-token")
+	tests := []struct {
+		name      string
+		secretId  string
+		versionId string
+		wantUrl   string
+	}{
+		{
+			name:      "short secret id",
+			secretId:  "admin-conn-url",
+			versionId: "3",
+			wantUrl:   "https://secretmanager.googleapis.com/v1/projects/acme/secrets/admin-conn-url/versions/3:access",
+		},
+		{
+			name:      "fully-qualified secret id",
+			secretId:  "projects/other/secrets/admin-conn-url",
+			versionId: "3",
+			wantUrl:   "https://secretmanager.googleapis.com/v1/projects/other/secrets/admin-conn-url/versions/3:access",
+		},
+		{
+			name:      "alias",
+			secretId:  "admin-conn-url",
+			versionId: "previous",
+			wantUrl:   "https://secretmanager.googleapis.com/v1/projects/acme/secrets/admin-conn-url/versions/previous:access",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFakeServer(t, fakeResponse{Status: http.StatusOK, Body: map[string]any{
+				"payload": map[string]any{"data": base64.StdEncoding.EncodeToString([]byte("value"))},
+			}})
+			_, err := newTestGcpSecretManager(server).GetVersion(context.Background(), test.secretId, test.versionId)
+			require.NoError(t, err)
+			require.Len(t, server.Requests(), 1)
+			assert.Equal(t, test.wantUrl, server.Requests()[0].Url.String())
+		})
+	}
+}
+
+func TestGcpSecretManager_Put(t *testing.T) {
+	t.Setenv(gcpAccessTokenEnvVar, "local-token")
+	server := newFakeServer(t, fakeResponse{Status: http.StatusOK, Body: map[string]any{
+		"name": "projects/acme/secrets/admin-conn-url/versions/4",
+	}})
+
+	versionId, err := newTestGcpSecretManager(server).Put(context.Background(), "admin-conn-url", "postgres://new")
+	require.NoError(t, err)
+	assert.Equal(t, "4", versionId)
+
+	requests := server.Requests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, http.MethodPost, requests[0].Method)
+	assert.Equal(t, "https://secretmanager.googleapis.com/v1/projects/acme/secrets/admin-conn-url:addVersion", requests[0].Url.String())
+	assert.Equal(t, map[string]any{
+		"payload": map[string]any{"data": base64.StdEncoding.EncodeToString([]byte("postgres://new"))},
+	}, requests[0].Body)
+}
+
+func TestGcpSecretManager_SetLabel(t *testing.T) {
+	t.Setenv(gcpAccessTokenEnvVar, "local-token")
+
+	t.Run("merges existing aliases", func(t *testing.T) {
+		server := newFakeServer(t,
+			fakeResponse{Status: http.StatusOK, Body: map[string]any{"versionAliases": map[string]string{"stable": "1"}}},
+			fakeResponse{Status: http.StatusOK, Body: map[string]any{}},
+		)
+		err := newTestGcpSecretManager(server).SetLabel(context.Background(), "admin-conn-url", "2", "previous")
+		require.NoError(t, err)
+
+		requests := server.Requests()
+		require.Len(t, requests, 2)
+		assert.Equal(t, http.MethodPatch, requests[1].Method)
+		assert.Equal(t, "https://secretmanager.googleapis.com/v1/projects/acme/secrets/admin-conn-url?updateMask=versionAliases", requests[1].Url.String())
+		assert.Equal(t, map[string]any{"versionAliases": map[string]any{"stable": float64(1), "previous": float64(2)}}, requests[1].Body)
+	})
+
+	t.Run("rejects a non-numeric version", func(t *testing.T) {
+		server := newFakeServer(t)
+		err := newTestGcpSecretManager(server).SetLabel(context.Background(), "admin-conn-url", "latest", "previous")
+		assert.ErrorContains(t, err, `invalid secret version "latest"`)
+		assert.Empty(t, server.Requests())
+	})
+}
+
+func TestGcpSecretManager_Errors(t *testing.T) {
+	t.Setenv(gcpAccessTokenEnvVar, "local-token")
+
+	t.Run("api error", func(t *testing.T) {
+		server := newFakeServer(t, fakeResponse{Status: http.StatusForbidden, Body: `{"error": {"status": "PERMISSION_DENIED"}}`})
+		_, err := newTestGcpSecretManager(server).Get(context.Background(), "admin-conn-url")
+		assert.ErrorContains(t, err, "error retrieving secret (admin-conn-url): secret manager returned 403")
+		assert.ErrorContains(t, err, "PERMISSION_DENIED")
+	})
+
+	t.Run("invalid payload", func(t *testing.T) {
+		server := newFakeServer(t, fakeResponse{Status: http.StatusOK, Body: map[string]any{"payload": map[string]any{"data": "not base64!"}}})
+		_, err := newTestGcpSecretManager(server).Get(context.Background(), "admin-conn-url")
+		assert.ErrorContains(t, err, "error decoding secret (admin-conn-url)")
+	})
+}
+
+func TestGcpSecretManager_MetadataToken(t *testing.T) {
+	t.Setenv(gcpAccessTokenEnvVar, "")
+	secretResponse := fakeResponse{Status: http.StatusOK, Body: map[string]any{
+		"payload": map[string]any{"data": base64.StdEncoding.EncodeToString([]byte("value"))},
+	}}
+
+	t.Run("retrieves and caches the token", func(t *testing.T) {
+		server := newFakeServer(t,
+			fakeResponse{Status: http.StatusOK, Body: map[string]any{"access_token": "metadata-token", "expires_in": 3600}},
+			secretResponse,
+			secretResponse,
+		)
+		s := newTestGcpSecretManager(server)
+		for i := 0; i < 2; i++ {
+			_, err := s.Get(context.Background(), "admin-conn-url")
+			require.NoError(t, err)
+		}
+
+		requests := server.Requests()
+		require.Len(t, requests, 3, "the token is only retrieved once")
+		assert.Equal(t, gcpMetadataTokenUrl, requests[0].Url.String())
+		assert.Equal(t, "Google", requests[0].Header.Get("Metadata-Flavor"))
+		assert.Equal(t, "Bearer metadata-token", requests[1].Header.Get("Authorization"))
+		assert.Equal(t, "Bearer metadata-token", requests[2].Header.Get("Authorization"))
+	})
+
+	t.Run("refreshes an expiring token", func(t *testing.T) {
+		server := newFakeServer(t,
+			fakeResponse{Status: http.StatusOK, Body: map[string]any{"access_token": "short-token", "expires_in": 30}},
+			secretResponse,
+			fakeResponse{Status: http.StatusOK, Body: map[string]any{"access_token": "next-token", "expires_in": 3600}},
+			secretResponse,
+		)
+		s := newTestGcpSecretManager(server)
+		for i := 0; i < 2; i++ {
+			_, err := s.Get(context.Background(), "admin-conn-url")
+			require.NoError(t, err)
+		}
+		assert.Equal(t, "Bearer next-token", server.Requests()[3].Header.Get("Authorization"))
+	})
+
+	t.Run("metadata server error", func(t *testing.T) {
+		server := newFakeServer(t, fakeResponse{Status: http.StatusNotFound})
+		_, err := newTestGcpSecretManager(server).Get(context.Background(), "admin-conn-url")
+		assert.ErrorContains(t, err, "metadata server returned 404")
+	})
+}
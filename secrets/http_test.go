@@ -0,0 +1,97 @@
+package secrets
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// recordedRequest is a request received by a fakeServer
+type recordedRequest struct {
+	Method string
+	// Url is the url that the client requested before it was redirected to the fake server
+	Url    *url.URL
+	Header http.Header
+	Body   map[string]any
+}
+
+// fakeServer responds to every request with the next response in responses
+// The client returned by Client sends every request to the fake server regardless of host
+type fakeServer struct {
+	t         *testing.T
+	server    *httptest.Server
+	responses []fakeResponse
+	requests  []recordedRequest
+	sync.Mutex
+}
+
+type fakeResponse struct {
+	Status int
+	Body   any
+}
+
+func newFakeServer(t *testing.T, responses ...fakeResponse) *fakeServer {
+	f := &fakeServer{t: t, responses: responses}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeServer) handle(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	rec := recordedRequest{Method: r.Method, Header: r.Header.Clone()}
+	rec.Url, _ = url.Parse(r.Header.Get("X-Original-Url"))
+	if raw, _ := io.ReadAll(r.Body); len(raw) > 0 {
+		if err := json.Unmarshal(raw, &rec.Body); err != nil {
+			f.t.Errorf("request body is not json: %s", raw)
+		}
+	}
+	f.requests = append(f.requests, rec)
+
+	if len(f.responses) == 0 {
+		f.t.Errorf("unexpected request: %s %s", r.Method, rec.Url)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	res := f.responses[0]
+	f.responses = f.responses[1:]
+	w.WriteHeader(res.Status)
+	switch body := res.Body.(type) {
+	case nil:
+	case string:
+		io.WriteString(w, body)
+	default:
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// Client returns an http.Client that redirects every request to the fake server
+func (f *fakeServer) Client() *http.Client {
+	target, _ := url.Parse(f.server.URL)
+	return &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		redirected := req.Clone(req.Context())
+		redirected.Header.Set("X-Original-Url", req.URL.String())
+		redirected.URL.Scheme = target.Scheme
+		redirected.URL.Host = target.Host
+		redirected.Host = target.Host
+		return http.DefaultTransport.RoundTrip(redirected)
+	})}
+}
+
+func (f *fakeServer) Requests() []recordedRequest {
+	f.Lock()
+	defer f.Unlock()
+	return f.requests
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (fn roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
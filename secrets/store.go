@@ -0,0 +1,82 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	// BackendEnvVar selects the SecretStore implementation used by an entrypoint
+	// Valid values: aws, gcp, vault, file, env
+	BackendEnvVar = "SECRET_STORE_BACKEND"
+
+	BackendAws   = "aws"
+	BackendGcp   = "gcp"
+	BackendVault = "vault"
+	BackendFile  = "file"
+	BackendEnv   = "env"
+)
+
+// SecretStore abstracts a versioned secret manager
+// Each backend maps versions and labels onto its native concepts:
+//
+//	aws:   version ids and version stages (e.g. AWSCURRENT, AWSPREVIOUS)
+//	gcp:   version numbers and version aliases
+//	vault: KV v2 versions and custom metadata
+//	file:  sequential versions stored in a local json file
+type SecretStore interface {
+	// Get retrieves the current value of the secret
+	// If the secret has no value, an empty string is returned
+	Get(ctx context.Context, secretId string) (string, error)
+	// GetVersion retrieves the value of a specific version of the secret
+	GetVersion(ctx context.Context, secretId, versionId string) (string, error)
+	// GetLabel retrieves the value of the version of the secret that is labeled with label
+	GetLabel(ctx context.Context, secretId, label string) (string, error)
+	// Put creates a new version containing value that becomes the current version
+	// The new version id is returned
+	Put(ctx context.Context, secretId, value string) (string, error)
+	// LatestVersionId retrieves the version id of the current version of the secret
+	LatestVersionId(ctx context.Context, secretId string) (string, error)
+	// SetLabel attaches label to versionId, removing the label from any other version
+	SetLabel(ctx context.Context, secretId, versionId, label string) error
+}
+
+// PutJson marshals value to json and stores it as a new version of the secret
+func PutJson(ctx context.Context, store SecretStore, secretId string, value any) (string, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal secret value: %w", err)
+	}
+	return store.Put(ctx, secretId, string(raw))
+}
+
+// NewFromEnv creates a SecretStore for the backend named in SECRET_STORE_BACKEND
+// If the env var is not set, defaultBackend is used
+func NewFromEnv(defaultBackend string) (SecretStore, error) {
+	backend := os.Getenv(BackendEnvVar)
+	if backend == "" {
+		backend = defaultBackend
+	}
+	return New(backend)
+}
+
+// New creates a SecretStore for the named backend
+// Backend-specific configuration is read from env vars
+func New(backend string) (SecretStore, error) {
+	switch backend {
+	case BackendAws:
+		return &AwsSecretsManager{}, nil
+	case BackendGcp:
+		return NewGcpSecretManager(os.Getenv(gcpProjectEnvVar)), nil
+	case BackendVault:
+		return NewVaultKv(os.Getenv(vaultAddrEnvVar), os.Getenv(vaultTokenEnvVar), os.Getenv(vaultMountEnvVar))
+	case BackendFile:
+		return NewFileStore(os.Getenv(fileStorePathEnvVar))
+	case BackendEnv:
+		return &EnvStore{}, nil
+	default:
+		return nil, fmt.Errorf("unknown secret store backend %q", backend)
+	}
+}
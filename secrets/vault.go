@@ -0,0 +1,199 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	vaultAddrEnvVar      = "VAULT_ADDR"
+	vaultTokenEnvVar     = "VAULT_TOKEN"
+	vaultNamespaceEnvVar = "VAULT_NAMESPACE"
+	// vaultMountEnvVar is the mount path of the KV v2 secrets engine (default: secret)
+	vaultMountEnvVar = "VAULT_KV_MOUNT"
+
+	// vaultValueKey is the key inside the KV v2 secret data that holds the secret value
+	vaultValueKey = "value"
+	// vaultLabelPrefix prefixes custom metadata keys that hold labels
+	vaultLabelPrefix = "label:"
+)
+
+var _ SecretStore = &VaultKv{}
+
+// VaultKv is a SecretStore backed by a HashiCorp Vault KV v2 secrets engine
+// Each secret value is stored in the `value` key of the KV secret
+// Labels are stored in the secret's custom metadata as `label:<name>` => `<version>`
+type VaultKv struct {
+	Addr       string
+	Token      string
+	Namespace  string
+	Mount      string
+	HttpClient *http.Client
+}
+
+func NewVaultKv(addr, token, mount string) (*VaultKv, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("vault secret store requires %s", vaultAddrEnvVar)
+	}
+	if mount == "" {
+		mount = "secret"
+	}
+	return &VaultKv{
+		Addr:       strings.TrimSuffix(addr, "/"),
+		Token:      token,
+		Namespace:  os.Getenv(vaultNamespaceEnvVar),
+		Mount:      strings.Trim(mount, "/"),
+		HttpClient: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (v *VaultKv) Get(ctx context.Context, secretId string) (string, error) {
+	return v.read(ctx, secretId, "")
+}
+
+func (v *VaultKv) GetVersion(ctx context.Context, secretId, versionId string) (string, error) {
+	return v.read(ctx, secretId, versionId)
+}
+
+func (v *VaultKv) GetLabel(ctx context.Context, secretId, label string) (string, error) {
+	metadata, err := v.readMetadata(ctx, secretId)
+	if err != nil {
+		return "", err
+	}
+	versionId, ok := metadata.CustomMetadata[vaultLabelPrefix+label]
+	if !ok {
+		return "", fmt.Errorf("secret (%s) does not have a version labeled %q", secretId, label)
+	}
+	return v.read(ctx, secretId, versionId)
+}
+
+func (v *VaultKv) read(ctx context.Context, secretId, versionId string) (string, error) {
+	endpoint := v.endpoint("data", secretId)
+	if versionId != "" {
+		endpoint += "?version=" + url.QueryEscape(versionId)
+	}
+	var out struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if found, err := v.do(ctx, http.MethodGet, endpoint, nil, &out); err != nil {
+		return "", fmt.Errorf("error retrieving secret (%s): %w", secretId, err)
+	} else if !found {
+		return "", nil
+	}
+	value, _ := out.Data.Data[vaultValueKey].(string)
+	return value, nil
+}
+
+func (v *VaultKv) Put(ctx context.Context, secretId, value string) (string, error) {
+	input := map[string]any{
+		"data": map[string]any{vaultValueKey: value},
+	}
+	var out struct {
+		Data struct {
+			Version int `json:"version"`
+		} `json:"data"`
+	}
+	if _, err := v.do(ctx, http.MethodPost, v.endpoint("data", secretId), input, &out); err != nil {
+		return "", fmt.Errorf("unable to update secret (%s) value: %w", secretId, err)
+	}
+	return strconv.Itoa(out.Data.Version), nil
+}
+
+func (v *VaultKv) LatestVersionId(ctx context.Context, secretId string) (string, error) {
+	metadata, err := v.readMetadata(ctx, secretId)
+	if err != nil {
+		return "", err
+	}
+	if metadata.CurrentVersion == 0 {
+		return "", nil
+	}
+	return strconv.Itoa(metadata.CurrentVersion), nil
+}
+
+func (v *VaultKv) SetLabel(ctx context.Context, secretId, versionId, label string) error {
+	metadata, err := v.readMetadata(ctx, secretId)
+	if err != nil {
+		return err
+	}
+	// Writing custom_metadata replaces the entire map, so we merge with the existing
+	customMetadata := map[string]string{}
+	for k, val := range metadata.CustomMetadata {
+		customMetadata[k] = val
+	}
+	customMetadata[vaultLabelPrefix+label] = versionId
+	input := map[string]any{"custom_metadata": customMetadata}
+	if _, err := v.do(ctx, http.MethodPost, v.endpoint("metadata", secretId), input, nil); err != nil {
+		return fmt.Errorf("unable to label secret (%s) version %s with %q: %w", secretId, versionId, label, err)
+	}
+	return nil
+}
+
+type vaultMetadata struct {
+	CurrentVersion int               `json:"current_version"`
+	CustomMetadata map[string]string `json:"custom_metadata"`
+}
+
+func (v *VaultKv) readMetadata(ctx context.Context, secretId string) (vaultMetadata, error) {
+	var out struct {
+		Data vaultMetadata `json:"data"`
+	}
+	if _, err := v.do(ctx, http.MethodGet, v.endpoint("metadata", secretId), nil, &out); err != nil {
+		return out.Data, fmt.Errorf("error retrieving secret metadata (%s): %w", secretId, err)
+	}
+	return out.Data, nil
+}
+
+func (v *VaultKv) endpoint(kind, secretId string) string {
+	return fmt.Sprintf("%s/v1/%s/%s/%s", v.Addr, v.Mount, kind, strings.TrimPrefix(secretId, "/"))
+}
+
+// do executes a request against vault
+// It returns false if vault responded with 404
+func (v *VaultKv) do(ctx context.Context, method, endpoint string, input any, output any) (bool, error) {
+	var body io.Reader
+	if input != nil {
+		raw, err := json.Marshal(input)
+		if err != nil {
+			return false, err
+		}
+		body = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return false, err
+	}
+	if v.Token != "" {
+		req.Header.Set("X-Vault-Token", v.Token)
+	}
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := v.HttpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	raw, _ := io.ReadAll(res.Body)
+	if res.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if res.StatusCode >= 400 {
+		return false, fmt.Errorf("vault returned %d: %s", res.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	if output == nil || len(raw) == 0 {
+		return true, nil
+	}
+	return true, json.Unmarshal(raw, output)
+}
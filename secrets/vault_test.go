@@ -0,0 +1,166 @@
+package secrets
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func newTestVaultKv(t *testing.T, server *fakeServer) *VaultKv {
+	t.Setenv(vaultNamespaceEnvVar, "team-a")
+	v, err := NewVaultKv("https://vault.example.com/", "vault-token", "")
+	require.NoError(t, err)
+	v.HttpClient = server.Client()
+	return v
+}
+
+func TestNewVaultKv(t *testing.T) {
+	_, err := NewVaultKv("", "vault-token", "")
+	assert.ErrorContains(t, err, "requires VAULT_ADDR")
+
+	v, err := NewVaultKv("https://vault.example.com/", "vault-token", "/kv/")
+	require.NoError(t, err)
+	assert.Equal(t, "https://vault.example.com", v.Addr)
+	assert.Equal(t, "kv", v.Mount)
+}
+
+func TestVaultKv_Get(t *testing.T) {
+	tests := []struct {
+		name      string
+		versionId string
+		response  fakeResponse
+		wantUrl   string
+		want      string
+	}{
+		{
+			name:     "current version",
+			response: fakeResponse{Status: http.StatusOK, Body: map[string]any{"data": map[string]any{"data": map[string]any{"value": "postgres://admin"}}}},
+			wantUrl:  "https://vault.example.com/v1/secret/data/pg/admin",
+			want:     "postgres://admin",
+		},
+		{
+			name:      "specific version",
+			versionId: "2",
+			response:  fakeResponse{Status: http.StatusOK, Body: map[string]any{"data": map[string]any{"data": map[string]any{"value": "postgres://old"}}}},
+			wantUrl:   "https://vault.example.com/v1/secret/data/pg/admin?version=2",
+			want:      "postgres://old",
+		},
+		{
+			name:     "missing secret",
+			response: fakeResponse{Status: http.StatusNotFound, Body: `{"errors": []}`},
+			wantUrl:  "https://vault.example.com/v1/secret/data/pg/admin",
+			want:     "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFakeServer(t, test.response)
+			v := newTestVaultKv(t, server)
+			var value string
+			var err error
+			if test.versionId == "" {
+				value, err = v.Get(context.Background(), "/pg/admin")
+			} else {
+				value, err = v.GetVersion(context.Background(), "/pg/admin", test.versionId)
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, value)
+
+			requests := server.Requests()
+			require.Len(t, requests, 1)
+			assert.Equal(t, http.MethodGet, requests[0].Method)
+			assert.Equal(t, test.wantUrl, requests[0].Url.String())
+			assert.Equal(t, "vault-token", requests[0].Header.Get("X-Vault-Token"))
+			assert.Equal(t, "team-a", requests[0].Header.Get("X-Vault-Namespace"))
+		})
+	}
+}
+
+func TestVaultKv_Put(t *testing.T) {
+	server := newFakeServer(t, fakeResponse{Status: http.StatusOK, Body: map[string]any{"data": map[string]any{"version": 4}}})
+
+	versionId, err := newTestVaultKv(t, server).Put(context.Background(), "pg/admin", "postgres://new")
+	require.NoError(t, err)
+	assert.Equal(t, "4", versionId)
+
+	requests := server.Requests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, http.MethodPost, requests[0].Method)
+	assert.Equal(t, "https://vault.example.com/v1/secret/data/pg/admin", requests[0].Url.String())
+	assert.Equal(t, map[string]any{"data": map[string]any{"value": "postgres://new"}}, requests[0].Body)
+}
+
+func TestVaultKv_LatestVersionId(t *testing.T) {
+	tests := []struct {
+		name     string
+		response fakeResponse
+		want     string
+	}{
+		{
+			name:     "existing secret",
+			response: fakeResponse{Status: http.StatusOK, Body: map[string]any{"data": map[string]any{"current_version": 3}}},
+			want:     "3",
+		},
+		{
+			name:     "missing secret",
+			response: fakeResponse{Status: http.StatusNotFound},
+			want:     "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFakeServer(t, test.response)
+			versionId, err := newTestVaultKv(t, server).LatestVersionId(context.Background(), "pg/admin")
+			require.NoError(t, err)
+			assert.Equal(t, test.want, versionId)
+			assert.Equal(t, "https://vault.example.com/v1/secret/metadata/pg/admin", server.Requests()[0].Url.String())
+		})
+	}
+}
+
+func TestVaultKv_Labels(t *testing.T) {
+	metadata := fakeResponse{Status: http.StatusOK, Body: map[string]any{"data": map[string]any{
+		"current_version": 3,
+		"custom_metadata": map[string]string{"owner": "platform", "label:previous": "2"},
+	}}}
+
+	t.Run("get label", func(t *testing.T) {
+		server := newFakeServer(t,
+			metadata,
+			fakeResponse{Status: http.StatusOK, Body: map[string]any{"data": map[string]any{"data": map[string]any{"value": "postgres://old"}}}},
+		)
+		value, err := newTestVaultKv(t, server).GetLabel(context.Background(), "pg/admin", "previous")
+		require.NoError(t, err)
+		assert.Equal(t, "postgres://old", value)
+		assert.Equal(t, "https://vault.example.com/v1/secret/data/pg/admin?version=2", server.Requests()[1].Url.String())
+	})
+
+	t.Run("missing label", func(t *testing.T) {
+		server := newFakeServer(t, metadata)
+		_, err := newTestVaultKv(t, server).GetLabel(context.Background(), "pg/admin", "stable")
+		assert.ErrorContains(t, err, `does not have a version labeled "stable"`)
+	})
+
+	t.Run("set label merges custom metadata", func(t *testing.T) {
+		server := newFakeServer(t, metadata, fakeResponse{Status: http.StatusNoContent})
+		err := newTestVaultKv(t, server).SetLabel(context.Background(), "pg/admin", "3", "current")
+		require.NoError(t, err)
+
+		requests := server.Requests()
+		require.Len(t, requests, 2)
+		assert.Equal(t, http.MethodPost, requests[1].Method)
+		assert.Equal(t, "https://vault.example.com/v1/secret/metadata/pg/admin", requests[1].Url.String())
+		assert.Equal(t, map[string]any{"custom_metadata": map[string]any{
+			"owner": "platform", "label:previous": "2", "label:current": "3",
+		}}, requests[1].Body)
+	})
+}
+
+func TestVaultKv_Errors(t *testing.T) {
+	server := newFakeServer(t, fakeResponse{Status: http.StatusForbidden, Body: `{"errors": ["permission denied"]}`})
+	_, err := newTestVaultKv(t, server).Get(context.Background(), "pg/admin")
+	assert.ErrorContains(t, err, "error retrieving secret (pg/admin): vault returned 403")
+	assert.ErrorContains(t, err, "permission denied")
+}
@@ -0,0 +1,151 @@
+package main
+
+// This is the entrypoint for running pg-db-admin as a plain HTTP server (e.g. on a VM or in Kubernetes)
+// Unlike the AWS and GCP entrypoints, there is no platform authentication in front of this server
+// The server refuses to start unless an authentication method is configured (see auth.MiddlewaresFromEnv)
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/nullstone-modules/pg-db-admin/api"
+	"github.com/nullstone-modules/pg-db-admin/audit"
+	"github.com/nullstone-modules/pg-db-admin/auth"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/nullstone-modules/pg-db-admin/secrets"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	listenAddrEnvVar = "LISTEN_ADDR"
+	dbConnUrlEnvVar  = "DB_CONN_URL"
+	// dbConnUrlSecretIdEnvVar is a secret id containing the connection url
+	// If set, the connection url is retrieved from the secret store (see SECRET_STORE_BACKEND) instead of DB_CONN_URL
+	dbConnUrlSecretIdEnvVar = "DB_CONN_URL_SECRET_ID"
+
+	tlsCertFileEnvVar     = "TLS_CERT_FILE"
+	tlsKeyFileEnvVar      = "TLS_KEY_FILE"
+	tlsClientCaFileEnvVar = "TLS_CLIENT_CA_FILE"
+
+	// authDisabledEnvVar allows the server to run without authentication (only intended for local development)
+	authDisabledEnvVar = "AUTH_DISABLED"
+)
+
+func main() {
+	store, err := createStore()
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	defer store.Close()
+	if store.Policy, err = postgresql.PolicyFromEnv(); err != nil {
+		log.Fatalln(err.Error())
+	}
+	if store.PasswordPolicy, err = postgresql.PasswordPolicyFromEnv(); err != nil {
+		log.Fatalln(err.Error())
+	}
+	if store.Credentials.Templates, err = postgresql.LeaseTemplatesFromEnv(); err != nil {
+		log.Fatalln(err.Error())
+	}
+	// The server has no setup step, so metadata tables are created at startup
+	// If this fails, the access review reports that password changes are not tracked
+	if err := store.EnsureMetadataTables(); err != nil {
+		log.Printf("Unable to create metadata tables: %s\n", err)
+	}
+
+	middlewares, err := auth.MiddlewaresFromEnv()
+	if err != nil {
+		log.Fatalf("error configuring authentication: %s\n", err)
+	}
+	if len(middlewares) == 0 {
+		if disabled, _ := strconv.ParseBool(os.Getenv(authDisabledEnvVar)); !disabled {
+			log.Fatalf("no authentication configured; set %s, %s, or %s (or %s=true for local development)\n",
+				auth.JwksFileEnvVar, auth.HmacKeysFileEnvVar, auth.ClientCertEnvVar, authDisabledEnvVar)
+		}
+		log.Println("WARNING: authentication is disabled")
+	}
+	auditor, err := audit.NewFromEnv(store)
+	if err != nil {
+		log.Fatalf("error configuring audit log: %s\n", err)
+	}
+	// The audit middleware must run after authentication to identify the caller
+	middlewares = append(middlewares, api.AuditMiddleware(auditor, store))
+	router := api.CreateRouter(store, middlewares...)
+
+	addr := os.Getenv(listenAddrEnvVar)
+	if addr == "" {
+		addr = ":8080"
+	}
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if server.TLSConfig, err = createTlsConfig(); err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+		<-stop
+		log.Println("Shutting down pg-db-admin...")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	log.Printf("Listening on %s\n", addr)
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS(os.Getenv(tlsCertFileEnvVar), os.Getenv(tlsKeyFileEnvVar))
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalln(err.Error())
+	}
+}
+
+func createStore() (*postgresql.Store, error) {
+	secretId := os.Getenv(dbConnUrlSecretIdEnvVar)
+	if secretId == "" {
+		return postgresql.NewStore(os.Getenv(dbConnUrlEnvVar)), nil
+	}
+	secretStore, err := secrets.NewFromEnv(secrets.BackendEnv)
+	if err != nil {
+		return nil, err
+	}
+	return postgresql.NewLazyStore(func(ctx context.Context) (string, error) {
+		log.Printf("Retrieving connection url secret (%s)\n", secretId)
+		return secretStore.Get(ctx, secretId)
+	}), nil
+}
+
+// createTlsConfig configures TLS if a certificate is configured
+// If a client CA is configured, client certificates signed by that CA are verified for mTLS authentication
+func createTlsConfig() (*tls.Config, error) {
+	if os.Getenv(tlsCertFileEnvVar) == "" {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile := os.Getenv(tlsClientCaFileEnvVar); caFile != "" {
+		raw, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, errors.New("no certificates found in client ca file")
+		}
+		cfg.ClientCAs = pool
+		// Other authentication methods may be used, so a client certificate is verified only if presented
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
@@ -0,0 +1,296 @@
+package setup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/nullstone-modules/pg-db-admin/secrets"
+	"log"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+	// CheckSkip is reported when a check cannot run because an earlier check failed
+	CheckSkip = "skip"
+
+	diagnoseDialTimeout = 3 * time.Second
+)
+
+// DiagnoseEvent verifies the result of setup without changing anything
+// e.g. `{"diagnose": true}`
+type DiagnoseEvent struct {
+	Diagnose bool `json:"diagnose"`
+}
+
+func IsDiagnoseEvent(rawEvent json.RawMessage) (bool, DiagnoseEvent) {
+	var event DiagnoseEvent
+	if err := json.Unmarshal(rawEvent, &event); err != nil {
+		return false, event
+	}
+	return event.Diagnose, event
+}
+
+// DiagnoseReport is a checklist of the configuration that setup is responsible for
+type DiagnoseReport struct {
+	// Healthy is true if no check failed
+	Healthy bool    `json:"healthy"`
+	Checks  []Check `json:"checks"`
+}
+
+type Check struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	// Fix suggests how to resolve a check that did not pass
+	Fix string `json:"fix,omitempty"`
+}
+
+type diagnosis struct {
+	report *DiagnoseReport
+}
+
+func (d *diagnosis) add(name, status, message, fix string) {
+	log.Printf("[Diagnose] %s: %s - %s\n", name, status, message)
+	d.report.Checks = append(d.report.Checks, Check{Name: name, Status: status, Message: message, Fix: fix})
+	if status == CheckFail {
+		d.report.Healthy = false
+	}
+}
+
+func (d *diagnosis) skip(name, reason string) {
+	d.add(name, CheckSkip, reason, "")
+}
+
+// Diagnose checks that the admin connection url secret is usable and that the admin role is configured the way setup left it
+// setupStore is used to inspect the admin role if the admin role cannot log in
+// adminStore provides the authentication of the admin role (e.g. RDS IAM auth tokens)
+func Diagnose(ctx context.Context, setupStore, adminStore *postgresql.Store, secretStore secrets.SecretStore, adminConnUrlSecretId string) (*DiagnoseReport, error) {
+	d := &diagnosis{report: &DiagnoseReport{Healthy: true, Checks: make([]Check, 0)}}
+
+	adminUrl := d.checkAdminSecret(ctx, secretStore, adminConnUrlSecretId)
+	if adminUrl == nil {
+		for _, name := range []string{"network", "admin-login", "distinct-users", "admin-attributes", "admin-superuser", "membership-cycles"} {
+			d.skip(name, "the admin connection url is not available")
+		}
+		return d.report, nil
+	}
+	adminName := adminUrl.User.Username()
+
+	d.checkNetwork(adminUrl)
+
+	adminDb := postgresql.NewStore(adminUrl.String())
+	adminDb.AuthToken = adminStore.AuthToken
+	defer adminDb.Close()
+	var inspector *postgresql.Store
+	if d.checkAdminLogin(adminDb, adminName) {
+		inspector = adminDb
+	} else if setupStore.ConnectionUrl() != "" {
+		inspector = setupStore
+	}
+
+	d.checkDistinctUsers(setupStore, adminName)
+
+	if inspector == nil {
+		for _, name := range []string{"admin-attributes", "admin-superuser", "membership-cycles"} {
+			d.skip(name, "neither the admin role nor the setup connection can log in")
+		}
+		return d.report, nil
+	}
+	d.checkAdminRole(inspector, adminName)
+	d.checkMembershipCycles(inspector, adminName, urlUsername(setupStore.ConnectionUrl()))
+	return d.report, nil
+}
+
+func (d *diagnosis) checkAdminSecret(ctx context.Context, secretStore secrets.SecretStore, secretId string) *url.URL {
+	const name = "admin-secret"
+	raw, err := secretStore.Get(ctx, secretId)
+	if err != nil {
+		d.add(name, CheckFail, fmt.Sprintf("error retrieving admin connection url secret (%s): %s", secretId, err),
+			"Grant the execution role access to read the secret and verify DB_ADMIN_CONN_URL_SECRET_ID")
+		return nil
+	}
+	if raw == "" {
+		d.add(name, CheckFail, fmt.Sprintf("admin connection url secret (%s) is empty", secretId),
+			`Run setup with {"setup": true}`)
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.User.Username() == "" || u.Host == "" {
+		d.add(name, CheckFail, fmt.Sprintf("admin connection url secret (%s) is not a postgres url with a username and host", secretId),
+			`Delete the secret value and run setup with {"setup": true} to generate new admin credentials`)
+		return nil
+	}
+	d.add(name, CheckPass, fmt.Sprintf("admin connection url is valid for role %q", u.User.Username()), "")
+	return u
+}
+
+func (d *diagnosis) checkNetwork(adminUrl *url.URL) {
+	const name = "network"
+	host := adminUrl.Host
+	if adminUrl.Port() == "" {
+		host = net.JoinHostPort(adminUrl.Hostname(), "5432")
+	}
+	conn, err := net.DialTimeout("tcp", host, diagnoseDialTimeout)
+	if err == nil {
+		conn.Close()
+		d.add(name, CheckPass, fmt.Sprintf("%s is reachable", host), "")
+		return
+	}
+
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		d.add(name, CheckFail, fmt.Sprintf("cannot resolve %s: %s", adminUrl.Hostname(), err),
+			"Verify the database host and that DNS resolution is enabled for the VPC")
+	case errors.As(err, &netErr) && netErr.Timeout():
+		d.add(name, CheckFail, fmt.Sprintf("timed out connecting to %s", host),
+			"Allow ingress from the db-admin security group to the database security group and verify the subnets can route to the database")
+	default:
+		d.add(name, CheckFail, fmt.Sprintf("cannot connect to %s: %s", host, err),
+			"Verify the database port and that the database is running")
+	}
+}
+
+func (d *diagnosis) checkAdminLogin(adminDb *postgresql.Store, adminName string) bool {
+	const name = "admin-login"
+	if _, err := adminDb.OpenDatabase(""); err != nil {
+		fix := `Reset the admin password with {"setup": true, "rotate": true}`
+		if adminDb.AuthToken != nil {
+			fix = `Enable IAM database authentication on the instance and run setup with {"setup": true, "iam": true}`
+		}
+		if !postgresql.IsAuthFailure(err) {
+			fix = "Resolve the network check and verify that the database accepts connections"
+		}
+		d.add(name, CheckFail, fmt.Sprintf("admin role %q cannot log in: %s", adminName, err), fix)
+		return false
+	}
+	d.add(name, CheckPass, fmt.Sprintf("admin role %q logged in", adminName), "")
+	return true
+}
+
+func (d *diagnosis) checkDistinctUsers(setupStore *postgresql.Store, adminName string) {
+	const name = "distinct-users"
+	setupName := urlUsername(setupStore.ConnectionUrl())
+	switch {
+	case setupName == "":
+		d.skip(name, "the setup connection url is not configured")
+	case setupName == adminName:
+		d.add(name, CheckFail, fmt.Sprintf("setup and admin connections both use %q", adminName),
+			`The admin role must be created by setup; delete the admin secret value and run setup with {"setup": true}`)
+	default:
+		d.add(name, CheckPass, fmt.Sprintf("setup uses %q and admin uses %q", setupName, adminName), "")
+	}
+}
+
+func (d *diagnosis) checkAdminRole(store *postgresql.Store, adminName string) {
+	role, err := store.Roles.Read(adminName)
+	if err != nil || role == nil {
+		message := fmt.Sprintf("admin role %q does not exist", adminName)
+		if err != nil {
+			message = fmt.Sprintf("error reading admin role %q: %s", adminName, err)
+		}
+		d.add("admin-attributes", CheckFail, message, `Delete the admin secret value and run setup with {"setup": true}`)
+		d.skip("admin-superuser", "the admin role could not be read")
+		return
+	}
+
+	missing := make([]string, 0)
+	if role.Attributes.CreateRole == nil || !*role.Attributes.CreateRole {
+		missing = append(missing, "CREATEROLE")
+	}
+	if role.Attributes.CreateDb == nil || !*role.Attributes.CreateDb {
+		missing = append(missing, "CREATEDB")
+	}
+	if len(missing) > 0 {
+		d.add("admin-attributes", CheckFail, fmt.Sprintf("admin role %q is missing %s", adminName, strings.Join(missing, ", ")),
+			fmt.Sprintf("Run setup with {\"setup\": true} or ALTER ROLE %q WITH %s", adminName, strings.Join(missing, " ")))
+	} else {
+		d.add("admin-attributes", CheckPass, fmt.Sprintf("admin role %q has CREATEROLE and CREATEDB", adminName), "")
+	}
+
+	db, err := store.OpenDatabase("")
+	if err != nil {
+		d.skip("admin-superuser", err.Error())
+		return
+	}
+	info, err := postgresql.CalcDbConnectionInfo(db)
+	if err != nil {
+		d.skip("admin-superuser", err.Error())
+		return
+	}
+	group := superuserGroups[info.Flavor]
+	switch {
+	case group == "":
+		d.skip("admin-superuser", fmt.Sprintf("%s does not have a managed superuser role", info.Flavor))
+	case slices.Contains(role.MemberOf, group):
+		d.add("admin-superuser", CheckPass, fmt.Sprintf("admin role %q is a member of %s", adminName, group), "")
+	default:
+		d.add("admin-superuser", CheckFail, fmt.Sprintf("admin role %q is not a member of %s", adminName, group),
+			fmt.Sprintf("Run setup with {\"setup\": true} or GRANT %s TO %q", group, adminName))
+	}
+}
+
+// superuserGroups are the roles that grant managed superuser privileges on each flavor
+var superuserGroups = map[string]string{
+	postgresql.FlavorRds:      "rds_superuser",
+	postgresql.FlavorCloudSql: "cloudsqlsuperuser",
+	postgresql.FlavorAzure:    "azure_pg_admin",
+}
+
+// checkMembershipCycles looks for roles that contain the admin role
+// The admin role cannot be granted membership in such a role because the membership would form a cycle
+// The setup role is ignored because postgres 16 makes the creator of a role a member of it
+func (d *diagnosis) checkMembershipCycles(store *postgresql.Store, adminName, setupName string) {
+	const name = "membership-cycles"
+	containing := make([]string, 0)
+	seen := map[string]bool{adminName: true, setupName: true}
+	queue := []string{adminName}
+	for len(queue) > 0 {
+		target := queue[0]
+		queue = queue[1:]
+		opts := postgresql.ListOptions{Limit: postgresql.MaxListLimit}
+		for {
+			page, err := store.RoleMembers.List(postgresql.RoleMemberFilter{ListOptions: opts, Target: target})
+			if err != nil {
+				d.add(name, CheckWarn, fmt.Sprintf("error listing members of %q: %s", target, err), "")
+				return
+			}
+			for _, member := range page.Items {
+				if !seen[member.Member] {
+					seen[member.Member] = true
+					containing = append(containing, member.Member)
+					queue = append(queue, member.Member)
+				}
+			}
+			if page.NextPageToken == "" {
+				break
+			}
+			opts.PageToken = page.NextPageToken
+		}
+	}
+	if len(containing) == 0 {
+		d.add(name, CheckPass, fmt.Sprintf("no roles are members of admin role %q", adminName), "")
+		return
+	}
+	slices.Sort(containing)
+	d.add(name, CheckWarn, fmt.Sprintf("roles are members of admin role %q, so it cannot manage them: %s", adminName, strings.Join(containing, ", ")),
+		fmt.Sprintf("REVOKE %q FROM each role; the admin role must not be granted to application roles", adminName))
+}
+
+func urlUsername(connUrl string) string {
+	u, err := url.Parse(connUrl)
+	if err != nil || connUrl == "" {
+		return ""
+	}
+	return u.User.Username()
+}
@@ -4,8 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/nullstone-modules/pg-db-admin/aws/secrets"
 	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/nullstone-modules/pg-db-admin/secrets"
 	"log"
 	"net/url"
 )
@@ -16,6 +16,12 @@ const (
 
 type Event struct {
 	Setup bool `json:"setup"`
+	// Iam grants rds_iam to the admin role so that it can authenticate with RDS IAM auth tokens
+	// The admin role keeps its password, which remains in the admin connection url secret
+	// Setup never revokes rds_iam, so re-running it without Iam leaves IAM authentication enabled
+	Iam bool `json:"iam"`
+	// Rotate replaces the password of the existing admin role instead of creating it (see Rotate)
+	Rotate bool `json:"rotate"`
 }
 
 type EventResult struct {
@@ -37,12 +43,27 @@ func IsEvent(rawEvent json.RawMessage) (bool, Event) {
 // This happens when the db_admin user has the same name as the database that a user wants to gain access
 // In short, db_admin attempts the following membership chain (creating a cycle) <admin-role> -> <app-role> -> <admin-role>
 // This admin user alters the membership chain to be <admin-role> -> <app-role> -> <database-owner>
-func Handle(ctx context.Context, event Event, store *postgresql.Store, adminConnUrlSecretId string) (*EventResult, error) {
+func Handle(ctx context.Context, event Event, store *postgresql.Store, secretStore secrets.SecretStore, adminConnUrlSecretId string) (*EventResult, error) {
+	if event.Rotate {
+		log.Println("Rotating admin role password")
+		return Rotate(ctx, store, secretStore, adminConnUrlSecretId)
+	}
 	log.Println("Generating admin role")
-	toCreate, err := generateAdminRole(ctx, adminConnUrlSecretId)
+	toCreate, err := generateAdminRole(ctx, secretStore, adminConnUrlSecretId, store.PasswordPolicy)
 	if err != nil {
 		return nil, fmt.Errorf("unable to generate admin role: %w", err)
 	}
+	if event.Iam {
+		log.Println("Enabling IAM authentication for admin role")
+		toCreate.MemberOf = append(toCreate.MemberOf, postgresql.RdsIamRole)
+	}
+	// Setup only enables IAM authentication (see Event.Iam)
+	toCreate.SkipIamRevoke = true
+	// The connection url needs the plaintext password even if the policy requires a SCRAM verifier
+	password := toCreate.Password
+	if toCreate.Password, err = store.PasswordPolicy.PasswordSecret(password); err != nil {
+		return nil, fmt.Errorf("error hashing admin role password: %w", err)
+	}
 	log.Println("Creating admin role in database")
 	adminRole, err := store.Roles.Create(toCreate)
 	if err != nil {
@@ -50,7 +71,7 @@ func Handle(ctx context.Context, event Event, store *postgresql.Store, adminConn
 	} else if adminRole.Password == "" {
 		log.Println("Admin role already exists")
 		// The role already exists, we're done
-		versionId, err := secrets.GetLatestVersionId(ctx, adminConnUrlSecretId)
+		versionId, err := secretStore.LatestVersionId(ctx, adminConnUrlSecretId)
 		if err != nil {
 			return nil, fmt.Errorf("error retrieving admin secret version id: %w", err)
 		}
@@ -59,30 +80,30 @@ func Handle(ctx context.Context, event Event, store *postgresql.Store, adminConn
 
 	log.Printf("Saving admin role credentials to admin connection url secret (%s)\n", adminConnUrlSecretId)
 	// Build a connection url using the setup url, but with the admin role credentials
-	adminConnUrl := urlWithUserinfo(store.ConnectionUrl(), adminRole.Name, adminRole.Password)
+	adminConnUrl := urlWithUserinfo(store.ConnectionUrl(), adminRole.Name, password)
 	// Set the value of the secret in secrets manager that holds the admin credentials
-	versionId, err := secrets.SetString(ctx, adminConnUrlSecretId, adminConnUrl)
+	versionId, err := secretStore.Put(ctx, adminConnUrlSecretId, adminConnUrl)
 	if err != nil {
 		return nil, fmt.Errorf("error saving admin credentials to a secret (%s): %w", adminConnUrlSecretId, err)
 	}
 	return &EventResult{SecretVersionId: versionId}, nil
 }
 
-func generateAdminRole(ctx context.Context, adminConnUrlSecretId string) (postgresql.Role, error) {
+func generateAdminRole(ctx context.Context, secretStore secrets.SecretStore, adminConnUrlSecretId string, policy *postgresql.PasswordPolicy) (postgresql.Role, error) {
 	role := postgresql.Role{
 		UseExisting:        true,
 		SkipPasswordUpdate: true,
 		MemberOf:           []string{"rds_superuser"},
 		Attributes: postgresql.RoleAttributes{
-			CreateDb:   true,
-			CreateRole: true,
+			CreateDb:   new(true),
+			CreateRole: new(true),
 		},
 	}
 
-	existingConnUrl, err := secrets.GetString(ctx, adminConnUrlSecretId)
+	existingConnUrl, err := secretStore.Get(ctx, adminConnUrlSecretId)
 	if u, err2 := url.Parse(existingConnUrl); err != nil || existingConnUrl == "" || err2 != nil {
 		// Generate Name, Password
-		role.Name, role.Password, err = randomRoleCreds(adminRoleUsernamePrefix)
+		role.Name, role.Password, err = postgresql.RandomRoleCreds(adminRoleUsernamePrefix, policy)
 		if err != nil {
 			return role, fmt.Errorf("error generating user credentials: %w", err)
 		}
@@ -0,0 +1,74 @@
+package setup
+
+import (
+	"context"
+	"fmt"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"github.com/nullstone-modules/pg-db-admin/secrets"
+	"log"
+	"net/url"
+)
+
+// Rotate replaces the password of the admin role
+// The new password is verified by logging in before the admin connection url secret is updated
+// If verification or the secret update fails, the previous password is restored
+func Rotate(ctx context.Context, store *postgresql.Store, secretStore secrets.SecretStore, adminConnUrlSecretId string) (*EventResult, error) {
+	existingConnUrl, err := secretStore.Get(ctx, adminConnUrlSecretId)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving admin connection url secret (%s): %w", adminConnUrlSecretId, err)
+	}
+	u, err := url.Parse(existingConnUrl)
+	if existingConnUrl == "" || err != nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("cannot rotate admin password: admin connection url secret (%s) is empty or invalid, run setup first", adminConnUrlSecretId)
+	}
+	roleName := u.User.Username()
+	oldPassword, _ := u.User.Password()
+
+	log.Printf("Generating new password for admin role %q\n", roleName)
+	newPassword, err := postgresql.RandomPassword(roleName, store.PasswordPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if err := setAdminPassword(store, roleName, newPassword); err != nil {
+		return nil, fmt.Errorf("error setting new admin password: %w", err)
+	}
+
+	newConnUrl := urlWithUserinfo(existingConnUrl, roleName, newPassword)
+	log.Printf("Verifying login as %q with new password\n", roleName)
+	if err := verifyLogin(newConnUrl); err != nil {
+		return nil, rollbackPassword(store, roleName, oldPassword, fmt.Errorf("error verifying new admin password: %w", err))
+	}
+
+	log.Printf("Saving rotated admin role credentials to admin connection url secret (%s)\n", adminConnUrlSecretId)
+	versionId, err := secretStore.Put(ctx, adminConnUrlSecretId, newConnUrl)
+	if err != nil {
+		return nil, rollbackPassword(store, roleName, oldPassword, fmt.Errorf("error saving admin credentials to a secret (%s): %w", adminConnUrlSecretId, err))
+	}
+	return &EventResult{AdminRoleName: roleName, SecretVersionId: versionId}, nil
+}
+
+// setAdminPassword sets password, hashed as a SCRAM verifier if the password policy requires it
+func setAdminPassword(store *postgresql.Store, roleName, password string) error {
+	secret, err := store.PasswordPolicy.PasswordSecret(password)
+	if err != nil {
+		return fmt.Errorf("error hashing admin role password: %w", err)
+	}
+	return store.Roles.SetPassword(roleName, secret)
+}
+
+// rollbackPassword restores oldPassword after cause prevented the rotation from completing
+func rollbackPassword(store *postgresql.Store, roleName, oldPassword string, cause error) error {
+	log.Printf("Rotation failed, restoring previous password for %q: %s\n", roleName, cause)
+	if err := setAdminPassword(store, roleName, oldPassword); err != nil {
+		return fmt.Errorf("%w; error restoring previous admin password: %s", cause, err)
+	}
+	return fmt.Errorf("%w; previous admin password was restored", cause)
+}
+
+func verifyLogin(connUrl string) error {
+	db, err := postgresql.OpenDatabase(connUrl, "")
+	if db != nil {
+		defer db.Close()
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package sweeper
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-multierror/multierror"
+	"github.com/nullstone-modules/pg-db-admin/apierror"
+	"github.com/nullstone-modules/pg-db-admin/postgresql"
+	"log"
+	"time"
+)
+
+// Event removes expired temporary access
+// e.g. `{"sweep": true}` sent by a scheduled EventBridge rule
+type Event struct {
+	Sweep bool `json:"sweep"`
+}
+
+func IsEvent(rawEvent json.RawMessage) (bool, Event) {
+	var event Event
+	if err := json.Unmarshal(rawEvent, &event); err != nil {
+		return false, event
+	}
+	return event.Sweep, event
+}
+
+// Report lists the temporary access that was removed by a sweep
+type Report struct {
+	// JitAccess contains the roles whose JIT access expired
+	JitAccess []string `json:"jitAccess"`
+	// Credentials contains the ids of the credential leases that expired
+	Credentials []string `json:"credentials"`
+}
+
+// Handle expires everything in store that expired before now
+// If any resource fails to expire, the invocation fails so that it is reported by the error-rate alarm
+// Resources that failed are retried on the next sweep
+func Handle(ctx context.Context, event Event, store *postgresql.Store) (*Report, error) {
+	now := time.Now()
+	report := &Report{}
+
+	errs := make([]error, 0)
+	var err error
+	report.JitAccess, err = store.JitAccess.Sweep(now)
+	log.Printf("[Sweep] Expired JIT access for %d roles\n", len(report.JitAccess))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	report.Credentials, err = store.Credentials.Sweep(now)
+	log.Printf("[Sweep] Revoked %d credential leases\n", len(report.Credentials))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return report, apierror.New(multierror.New(errs))
+	}
+	return report, nil
+}